@@ -1,12 +1,18 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"llm-gateway/internal/admin"
+	"llm-gateway/internal/apikeys"
+	"llm-gateway/internal/batch"
 	"llm-gateway/internal/config"
 	"llm-gateway/internal/core"
 	coremw "llm-gateway/internal/core/middleware"
 	"llm-gateway/internal/core/provider"
 	"llm-gateway/internal/core/router"
+	"llm-gateway/internal/jobs"
 	"llm-gateway/internal/logging"
 	"llm-gateway/internal/ratelimit"
 	"llm-gateway/internal/transport/handlers"
@@ -22,11 +28,27 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to load configuration: %v", err)
 	}
+	// Changes made through the admin API replace the configured providers,
+	// strategies and rate limit groups
+	if cfg.Admin.Enabled {
+		state, ok, err := admin.LoadState(cfg.Admin.StateFile)
+		if err != nil {
+			logger.Fatalf("Failed to load admin state: %v", err)
+		}
+		if ok {
+			state.Apply(cfg)
+			if err := cfg.Validate(); err != nil {
+				logger.Fatalf("Invalid admin state in %s: %v", cfg.Admin.StateFile, err)
+			}
+			logger.Infof("Loaded admin state from %s", cfg.Admin.StateFile)
+		}
+	}
 
 	// 2. Initialize Components
 	providerManager := provider.NewManager(cfg.Providers)
 	modelsCache := core.NewModelsCache()
-	coreRouter := router.NewRouter(cfg.Strategies)
+	modelsCache.SetAliases(cfg.Routing.Aliases)
+	coreRouter := router.NewRouter(cfg.Strategies, cfg.Routing, providerManager)
 
 	// 2a. Setup Core Middleware (Post-Forwarding)
 	responseMiddleware := coremw.ElasticCompletionLogger
@@ -37,8 +59,25 @@ func main() {
 	modelFetcher.Start()
 	defer modelFetcher.Stop()
 
+	// 3a. Start the active Health Checker
+	healthChecker := core.NewHealthChecker(providerManager)
+	healthChecker.Start()
+	defer healthChecker.Stop()
+
 	// 4. Setup HTTP Server
-	gatewayHandler := handlers.NewGatewayHandler(modelsCache, proxy)
+	gatewayHandler := handlers.NewGatewayHandler(modelsCache, proxy, providerManager)
+	if cfg.Embeddings.Batching.Enabled {
+		gatewayHandler.SetEmbeddingBatcher(core.NewEmbeddingBatcher(proxy, cfg.Embeddings.Batching))
+		logger.Info("Embedding batching enabled")
+	}
+	var imageStore *core.ImageStore
+	if cfg.Images.Storage.Dir != "" {
+		imageStore, err = core.NewImageStore(cfg.Images.Storage)
+		if err != nil {
+			logger.Fatalf("Failed to create image storage: %v", err)
+		}
+	}
+	gatewayHandler.SetImages(cfg.Images, imageStore)
 	mux := http.NewServeMux()
 	gatewayHandler.RegisterRoutes(mux)
 
@@ -46,21 +85,57 @@ func main() {
 	transportMiddlewareManager := transportmw.NewManager(logger)
 
 	var middlewares []transportmw.Middleware
-	middlewares = append(middlewares, transportMiddlewareManager.Logging)
+	middlewares = append(middlewares, transportMiddlewareManager.Logging, transportMiddlewareManager.LimitUploads(cfg.Server.MaxUploadSize))
+	// Routes that do not name a model, such as /v1/files, skip model
+	// authorization; batches authorize each of their requests instead.
+	resourceMiddlewares := []transportmw.Middleware{transportMiddlewareManager.Logging}
+	// Batch requests run as their owner through the client routes, with the
+	// same chain minus authentication, so that each one is authorized, rate
+	// limited and checked against its endpoint.
+	batchMiddlewares := []transportmw.Middleware{transportMiddlewareManager.Logging}
+	var auth *transportmw.OIDCAuthenticator
+	var authz *transportmw.Authorizer
+	var keys *apikeys.Service
 
 	// Initialize OIDC Authenticator if enabled
 	if cfg.Auth.Enabled {
-		auth := transportmw.NewOIDCAuthenticator(logger, cfg.Auth.Issuer, cfg.Auth.Audience, cfg.Auth.CacheTTL)
+		auth = transportmw.NewOIDCAuthenticator(logger, cfg.Auth)
+		auth.Start()
+		defer auth.Stop()
+		if cfg.Auth.APIKeys.Enabled {
+			var keyStore apikeys.Store
+			switch cfg.Auth.APIKeys.Backend {
+			case config.KeyStoreFile:
+				keyStore, err = apikeys.NewFileStore(cfg.Auth.APIKeys.File)
+				if err != nil {
+					logger.Fatalf("Failed to load api keys: %v", err)
+				}
+			case config.KeyStoreRedis:
+				keyStore = apikeys.NewRedisStore(cfg.Auth.APIKeys.RedisAddress)
+			default:
+				keyStore = apikeys.NewMemoryStore()
+			}
+			keys = apikeys.NewService(keyStore)
+			if err := keys.Seed(context.Background(), cfg.Auth.APIKeys.Keys); err != nil {
+				logger.Fatalf("Failed to store configured api keys: %v", err)
+			}
+			auth.SetAPIKeys(keys)
+			logger.Infof("API keys enabled with %s store", cmp.Or(cfg.Auth.APIKeys.Backend, config.KeyStoreMemory))
+		}
 		middlewares = append(middlewares, transportMiddlewareManager.Authentication(auth))
+		resourceMiddlewares = append(resourceMiddlewares, transportMiddlewareManager.Authentication(auth))
 		logger.Info("OIDC authentication enabled")
 
 		// Add the Authorization middleware right after Authentication
-		authz := transportmw.NewAuthorizer(logger, cfg.Providers, modelsCache)
+		authz = transportmw.NewAuthorizer(logger, cfg.Providers, cfg.Routing.Aliases, modelsCache)
 		middlewares = append(middlewares, transportMiddlewareManager.Authorization(authz))
+		batchMiddlewares = append(batchMiddlewares, transportMiddlewareManager.Authorization(authz))
 		logger.Info("Model authorization enabled")
 	}
 
-	// Initialize Rate Limiter if enabled
+	// Initialize Rate Limiter if enabled. The limits are shared with the
+	// admin API, which may change them at runtime
+	rateLimits := ratelimit.NewLimits(cfg.RateLimit)
 	if cfg.RateLimit.Enabled {
 		var store ratelimit.RateLimiterStore
 		switch cfg.RateLimit.Backend {
@@ -74,16 +149,94 @@ func main() {
 			logger.Warnf("Unknown rate limit backend '%s', defaulting to in-memory", cfg.RateLimit.Backend)
 			store = ratelimit.NewMemoryStore()
 		}
-		middlewares = append(middlewares, transportMiddlewareManager.RateLimiter(store, cfg.RateLimit))
+		middlewares = append(middlewares, transportMiddlewareManager.RateLimiter(store, rateLimits))
+		resourceMiddlewares = append(resourceMiddlewares, transportMiddlewareManager.RateLimiter(store, rateLimits))
+		batchMiddlewares = append(batchMiddlewares, transportMiddlewareManager.RateLimiter(store, rateLimits))
+	}
+
+	// Accept asynchronous requests last, so that they run authenticated and
+	// count against the rate limits when they are submitted
+	var jobService *jobs.Service
+	if cfg.Jobs.Enabled {
+		jobService, err = jobs.NewService(cfg.Jobs)
+		if err != nil {
+			logger.Fatalf("Failed to open job store: %v", err)
+		}
+		jobService.Start()
+		defer jobService.Stop()
+		gatewayHandler.SetJobs(jobService)
+		middlewares = append(middlewares, transportMiddlewareManager.Async(jobService))
+		logger.Info("Asynchronous requests enabled")
 	}
 
 	chainedHandler := transportmw.Chain(middlewares...)(mux)
 
+	// 4b. Mount operational endpoints outside of the middleware chain
+	rootMux := http.NewServeMux()
+	gatewayHandler.RegisterStatusRoutes(rootMux)
+	rootMux.Handle("/", chainedHandler)
+
+	// 4c. Start the Batch Service, run at low priority through the client routes
+	resourceMux := http.NewServeMux()
+	resourceHandler := transportmw.Chain(resourceMiddlewares...)(resourceMux)
+	if cfg.Batches.Enabled {
+		batchHandler := transportmw.Chain(batchMiddlewares...)(mux)
+		batchService, err := batch.NewService(cfg.Batches, batchHandler, proxy.ActiveRequests)
+		if err != nil {
+			logger.Fatalf("Failed to open batch store: %v", err)
+		}
+		batchService.Start()
+		defer batchService.Stop()
+		gatewayHandler.SetBatches(batchService)
+
+		gatewayHandler.RegisterBatchRoutes(resourceMux)
+		for _, path := range []string{"/v1/files", "/v1/files/", "/v1/batches", "/v1/batches/"} {
+			rootMux.Handle(path, resourceHandler)
+		}
+		logger.Info("Batch API enabled")
+	}
+
+	// 4d. Mount the polling of asynchronous requests
+	if jobService != nil {
+		gatewayHandler.RegisterJobRoutes(resourceMux)
+		rootMux.Handle("/v1/jobs/", resourceHandler)
+	}
+
+	// 4e. Start the Admin API on its own listener
+	if cfg.Admin.Enabled {
+		components := admin.Components{
+			Providers: providerManager,
+			Router:    coreRouter,
+			Limits:    rateLimits,
+			Keys:      keys,
+			Models:    modelsCache,
+			Fetcher:   modelFetcher,
+			Health:    healthChecker,
+		}
+		if authz != nil {
+			components.Authorizer = authz
+		}
+		adminAPI := admin.New(*cfg, cfg.Admin.StateFile, components)
+		adminMux := http.NewServeMux()
+		adminAPI.RegisterRoutes(adminMux)
+		adminHandler := transportmw.Chain(
+			transportMiddlewareManager.Logging,
+			transportMiddlewareManager.Authentication(auth),
+			transportMiddlewareManager.RequireGroup(cfg.Admin.Group),
+		)(adminMux)
+		go func() {
+			logger.Infof("Starting admin API on %s", cfg.Admin.Listen)
+			if err := http.ListenAndServe(cfg.Admin.Listen, adminHandler); err != nil {
+				logger.Fatalf("Failed to start admin API: %v", err)
+			}
+		}()
+	}
+
 	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	logger.Infof("Starting server on %s", serverAddr)
 
 	// 5. Start the Server
-	if err := http.ListenAndServe(serverAddr, chainedHandler); err != nil {
+	if err := http.ListenAndServe(serverAddr, rootMux); err != nil {
 		logger.Fatalf("Failed to start server: %v", err)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,278 @@
+// Package admin implements the admin API, which changes the providers,
+// strategies, rate limit groups and API keys of a running gateway. Every
+// change is validated against the whole configuration, persisted to a state
+// file and only then applied to the running components.
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"llm-gateway/internal/apikeys"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/provider"
+	"llm-gateway/internal/core/router"
+	"llm-gateway/internal/ratelimit"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrNotFound is returned for resources that do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when creating a resource that already exists.
+	ErrConflict = errors.New("already exists")
+	// ErrInvalid is wrapped by errors for changes that would leave the
+	// configuration invalid.
+	ErrInvalid = errors.New("invalid configuration")
+)
+
+// State is the part of the configuration managed through the admin API.
+type State struct {
+	Providers       []config.Provider                 `yaml:"providers"`
+	Strategies      []config.Strategy                 `yaml:"strategies"`
+	RateLimitGroups map[string]config.RateLimitConfig `yaml:"ratelimit_groups"`
+}
+
+// LoadState reads a state file. ok is false if it does not exist yet.
+func LoadState(path string) (state State, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, false, nil
+	}
+	if err != nil {
+		return State{}, false, err
+	}
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return State{}, false, err
+	}
+	return state, true, nil
+}
+
+// Apply replaces the managed sections of cfg with the state.
+func (s State) Apply(cfg *config.Config) {
+	cfg.Providers = s.Providers
+	cfg.Strategies = s.Strategies
+	cfg.RateLimit.Groups = s.RateLimitGroups
+}
+
+// save writes the state to a temporary file and renames it over path.
+func (s State) save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Components are the parts of the running gateway that changes apply to.
+// Keys, Authorizer, Models, Fetcher and Health may be nil.
+type Components struct {
+	Providers  *provider.Manager
+	Router     *router.Router
+	Limits     *ratelimit.Limits
+	Authorizer interface{ SetProviders([]config.Provider) }
+	Keys       *apikeys.Service
+	// Models drops the listed models of removed providers, Fetcher fetches
+	// the models of added or changed providers, and Health matches the
+	// health probes to the updated providers.
+	Models  interface{ SetProviders([]config.Provider) }
+	Fetcher interface{ Fetch([]config.Provider) }
+	Health  interface{ Reconcile() }
+}
+
+// API serves the admin API.
+type API struct {
+	statePath string
+	c         Components
+
+	// mu serializes changes; cfg is the configuration in effect.
+	mu  sync.Mutex
+	cfg config.Config
+}
+
+// New creates the admin API for a gateway running with cfg. Changes are
+// persisted to statePath.
+func New(cfg config.Config, statePath string, c Components) *API {
+	return &API{statePath: statePath, c: c, cfg: cfg}
+}
+
+// snapshot returns the configuration in effect.
+func (a *API) snapshot() config.Config {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg
+}
+
+// update applies change to a copy of the configuration, validates the result,
+// persists it and swaps it into the running components. Nothing changes if
+// any step fails.
+func (a *API) update(change func(cfg *config.Config) error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// change replaces elements rather than modifying them, so copying the
+	// managed slices and map is enough to leave a.cfg untouched.
+	next := a.cfg
+	next.Providers = slices.Clone(a.cfg.Providers)
+	next.Strategies = slices.Clone(a.cfg.Strategies)
+	next.RateLimit.Groups = maps.Clone(a.cfg.RateLimit.Groups)
+	if err := change(&next); err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	state := State{Providers: next.Providers, Strategies: next.Strategies, RateLimitGroups: next.RateLimit.Groups}
+	if err := state.save(a.statePath); err != nil {
+		return fmt.Errorf("failed to persist the change: %w", err)
+	}
+
+	// Providers are swapped first, so that new strategies never route to a
+	// provider the manager does not know yet.
+	a.c.Providers.Update(next.Providers)
+	if a.c.Authorizer != nil {
+		a.c.Authorizer.SetProviders(next.Providers)
+	}
+	if a.c.Models != nil {
+		a.c.Models.SetProviders(next.Providers)
+	}
+	// Models of new providers are fetched before the change returns, so
+	// that they can be requested right away.
+	if a.c.Fetcher != nil {
+		a.c.Fetcher.Fetch(changedProviders(a.cfg.Providers, next.Providers))
+	}
+	if a.c.Health != nil {
+		a.c.Health.Reconcile()
+	}
+	a.c.Router.Update(next.Strategies, next.Routing)
+	a.c.Limits.Set(next.RateLimit)
+	a.cfg = next
+	return nil
+}
+
+// changedProviders returns the providers of next that are not in prev, or
+// whose configuration differs.
+func changedProviders(prev, next []config.Provider) []config.Provider {
+	var changed []config.Provider
+	for _, p := range next {
+		if i := indexOf(prev, p.Name, providerName); i < 0 || !reflect.DeepEqual(prev[i], p) {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+// indexOf returns the index of the element named name, or -1.
+func indexOf[T any](items []T, name string, nameOf func(T) string) int {
+	return slices.IndexFunc(items, func(item T) bool { return nameOf(item) == name })
+}
+
+func providerName(p config.Provider) string { return p.Name }
+func strategyName(s config.Strategy) string { return s.Name }
+
+// putProvider creates or replaces a provider. Secrets left empty keep their
+// current value, since they are never returned by the API.
+func (a *API) putProvider(p config.Provider, create bool) error {
+	return a.update(func(cfg *config.Config) error {
+		i := indexOf(cfg.Providers, p.Name, providerName)
+		switch {
+		case i >= 0 && create:
+			return ErrConflict
+		case i < 0:
+			cfg.Providers = append(cfg.Providers, p)
+		default:
+			old := cfg.Providers[i]
+			if p.APIKey == "" {
+				p.APIKey = old.APIKey
+			}
+			if p.Auth.SigV4.SecretAccessKey == "" {
+				p.Auth.SigV4.SecretAccessKey = old.Auth.SigV4.SecretAccessKey
+			}
+			if p.Auth.SigV4.SessionToken == "" {
+				p.Auth.SigV4.SessionToken = old.Auth.SigV4.SessionToken
+			}
+			cfg.Providers[i] = p
+		}
+		return nil
+	})
+}
+
+func (a *API) deleteProvider(name string) error {
+	return a.update(func(cfg *config.Config) error {
+		i := indexOf(cfg.Providers, name, providerName)
+		if i < 0 {
+			return ErrNotFound
+		}
+		cfg.Providers = slices.Delete(cfg.Providers, i, i+1)
+		return nil
+	})
+}
+
+func (a *API) putStrategy(s config.Strategy, create bool) error {
+	return a.update(func(cfg *config.Config) error {
+		i := indexOf(cfg.Strategies, s.Name, strategyName)
+		switch {
+		case i >= 0 && create:
+			return ErrConflict
+		case i < 0:
+			cfg.Strategies = append(cfg.Strategies, s)
+		default:
+			cfg.Strategies[i] = s
+		}
+		return nil
+	})
+}
+
+func (a *API) deleteStrategy(name string) error {
+	return a.update(func(cfg *config.Config) error {
+		i := indexOf(cfg.Strategies, name, strategyName)
+		if i < 0 {
+			return ErrNotFound
+		}
+		cfg.Strategies = slices.Delete(cfg.Strategies, i, i+1)
+		return nil
+	})
+}
+
+func (a *API) putRateLimitGroup(name string, limit config.RateLimitConfig) error {
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return fmt.Errorf("%w: rate limit group '%s' requires requests and a window", ErrInvalid, name)
+	}
+	return a.update(func(cfg *config.Config) error {
+		if cfg.RateLimit.Groups == nil {
+			cfg.RateLimit.Groups = make(map[string]config.RateLimitConfig)
+		}
+		limit.Name = name
+		cfg.RateLimit.Groups[name] = limit
+		return nil
+	})
+}
+
+func (a *API) deleteRateLimitGroup(name string) error {
+	return a.update(func(cfg *config.Config) error {
+		if _, ok := cfg.RateLimit.Groups[name]; !ok {
+			return ErrNotFound
+		}
+		delete(cfg.RateLimit.Groups, name)
+		return nil
+	})
+}
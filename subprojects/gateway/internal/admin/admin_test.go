@@ -0,0 +1,323 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/apikeys"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"llm-gateway/internal/core/provider"
+	"llm-gateway/internal/core/router"
+	"llm-gateway/internal/ratelimit"
+	"llm-gateway/internal/transport/middleware"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testGateway struct {
+	api       *API
+	handler   http.Handler
+	providers *provider.Manager
+	router    *router.Router
+	limits    *ratelimit.Limits
+	keys      *apikeys.Service
+	models    *core.ModelsCache
+	health    *core.HealthChecker
+	authz     *middleware.Authorizer
+}
+
+func newTestGateway(t *testing.T, cfg config.Config, statePath string) *testGateway {
+	t.Helper()
+	g := &testGateway{
+		providers: provider.NewManager(cfg.Providers),
+		limits:    ratelimit.NewLimits(cfg.RateLimit),
+		keys:      apikeys.NewService(apikeys.NewMemoryStore()),
+		models:    core.NewModelsCache(),
+	}
+	g.router = router.NewRouter(cfg.Strategies, cfg.Routing, g.providers)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	g.authz = middleware.NewAuthorizer(logger, cfg.Providers, nil, g.models)
+	fetcher := core.NewModelFetcher(g.providers, g.models, time.Hour)
+	g.health = core.NewHealthChecker(g.providers)
+	g.health.Start()
+	t.Cleanup(g.health.Stop)
+	g.api = New(cfg, statePath, Components{Providers: g.providers, Router: g.router, Limits: g.limits, Keys: g.keys, Authorizer: g.authz, Models: g.models, Fetcher: fetcher, Health: g.health})
+	mux := http.NewServeMux()
+	g.api.RegisterRoutes(mux)
+	g.handler = mux
+	return g
+}
+
+func testConfig() config.Config {
+	return config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", Enabled: true, TargetURL: "https://api.openai.com", APIKey: "sk-secret"},
+		},
+		Strategies: []config.Strategy{{Name: "default", Providers: []string{"openai"}}},
+		Routing:    config.Routing{DefaultStrategy: "default"},
+		RateLimit: config.RateLimit{
+			Default: config.RateLimitConfig{Requests: 100, Window: time.Minute},
+		},
+	}
+}
+
+// do sends a request to the admin API and decodes the JSON response into v.
+func (g *testGateway) do(t *testing.T, method, path, body string, v any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	g.handler.ServeHTTP(rec, req)
+	if v != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestProviderAndStrategyChanges(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.yaml")
+	g := newTestGateway(t, testConfig(), statePath)
+
+	var created map[string]any
+	code := g.do(t, "POST", "/admin/v1/providers", `{"name": "vllm", "enabled": true, "target_url": "http://vllm:8000", "timeout": "30s"}`, &created)
+	if code != http.StatusCreated || created["timeout"] != "30s" {
+		t.Fatalf("unexpected response %d %v", code, created)
+	}
+	if code := g.do(t, "POST", "/admin/v1/providers", `{"name": "vllm"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected a duplicate provider to conflict, got %d", code)
+	}
+	if code := g.do(t, "POST", "/admin/v1/providers", `{"name": "other", "colour": "blue"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected unknown fields to be rejected, got %d", code)
+	}
+	if code := g.do(t, "POST", "/admin/v1/strategies", `{"name": "llama", "providers": ["vllm"]}`, nil); code != http.StatusCreated {
+		t.Fatalf("failed to create strategy: %d", code)
+	}
+	if code := g.do(t, "PUT", "/admin/v1/strategies/default", `{"providers": ["vllm", "openai"]}`, nil); code != http.StatusOK {
+		t.Fatalf("failed to replace strategy: %d", code)
+	}
+
+	// Changes apply to the running components right away.
+	if cfg, ok := g.providers.GetConfig("vllm"); !ok || cfg.Timeout != 30*time.Second {
+		t.Errorf("expected the provider manager to know vllm, got %+v", cfg)
+	}
+	route, err := g.router.SelectStrategy(strings.NewReader(`{"model": "gpt-4"}`))
+	if err != nil || strings.Join(route.Strategy.Providers, ",") != "vllm,openai" {
+		t.Errorf("expected the router to use the new default strategy, got %+v, %v", route, err)
+	}
+
+	// Changes leaving the configuration invalid are rejected as a whole.
+	if code := g.do(t, "DELETE", "/admin/v1/providers/vllm", "", nil); code != http.StatusBadRequest {
+		t.Errorf("expected deleting a provider in use to fail, got %d", code)
+	}
+	if _, ok := g.providers.GetConfig("vllm"); !ok {
+		t.Error("expected a rejected change to leave the provider in place")
+	}
+	if code := g.do(t, "DELETE", "/admin/v1/strategies/missing", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected deleting a missing strategy to fail, got %d", code)
+	}
+
+	// The state file is reloaded on restart.
+	state, ok, err := LoadState(statePath)
+	if err != nil || !ok {
+		t.Fatalf("failed to load state: %v, %v", ok, err)
+	}
+	cfg := testConfig()
+	state.Apply(&cfg)
+	if len(cfg.Providers) != 2 || len(cfg.Strategies) != 2 || cfg.Providers[1].Timeout != 30*time.Second {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func TestProviderChangesReachHealthChecksAndModels(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	var probes atomic.Int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+	}))
+	defer up.Close()
+
+	g := newTestGateway(t, testConfig(), filepath.Join(t.TempDir(), "state.yaml"))
+	g.models.SetModels("openai", []core.Model{{ID: "openai/gpt-4o"}})
+
+	// A provider added at runtime is probed.
+	body := `{"name": "vllm", "enabled": true, "target_url": "` + down.URL + `", "health_check": {"enabled": true, "interval": "10ms"}}`
+	if code := g.do(t, "POST", "/admin/v1/providers", body, nil); code != http.StatusCreated {
+		t.Fatalf("failed to create provider: %d", code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for g.providers.Available("vllm") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the new provider to be probed and marked unhealthy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Fixing its URL starts its health over, probed at the new URL.
+	body = `{"enabled": true, "target_url": "` + up.URL + `", "health_check": {"enabled": true, "interval": "10ms"}}`
+	if code := g.do(t, "PUT", "/admin/v1/providers/vllm", body, nil); code != http.StatusOK {
+		t.Fatalf("failed to replace provider: %d", code)
+	}
+	if !g.providers.Available("vllm") {
+		t.Error("expected the changed provider to start over as healthy")
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for probes.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changed provider to be probed at its new URL")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !g.providers.Available("vllm") {
+		t.Error("expected the changed provider to stay healthy")
+	}
+
+	// A deleted provider is no longer listed.
+	if code := g.do(t, "DELETE", "/admin/v1/providers/openai", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected deleting a provider in use to fail, got %d", code)
+	}
+	if code := g.do(t, "PUT", "/admin/v1/strategies/default", `{"providers": ["vllm"]}`, nil); code != http.StatusOK {
+		t.Fatalf("failed to replace strategy: %d", code)
+	}
+	if code := g.do(t, "DELETE", "/admin/v1/providers/openai", "", nil); code != http.StatusNoContent {
+		t.Fatalf("failed to delete provider: %d", code)
+	}
+	if models := g.models.GetAllModels(); len(models) != 0 {
+		t.Errorf("expected the models of the deleted provider to be dropped, got %+v", models)
+	}
+}
+
+func TestProviderModelsCanBeRequestedRightAway(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			w.Write([]byte(`{"data": [{"id": "llama-3"}]}`))
+		}
+	}))
+	defer upstream.Close()
+
+	g := newTestGateway(t, testConfig(), filepath.Join(t.TempDir(), "state.yaml"))
+	body := `{"name": "vllm", "enabled": true, "target_url": "` + upstream.URL + `"}`
+	if code := g.do(t, "POST", "/admin/v1/providers", body, nil); code != http.StatusCreated {
+		t.Fatalf("failed to create provider: %d", code)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	handler := middleware.NewManager(logger).Authorization(g.authz)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "vllm/llama-3"}`))
+	req = req.WithContext(context.WithValue(req.Context(), "user_groups", []string{"users"}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the new provider's model to be authorized, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProviderSecretsAreRedacted(t *testing.T) {
+	g := newTestGateway(t, testConfig(), filepath.Join(t.TempDir(), "state.yaml"))
+
+	var got map[string]any
+	g.do(t, "GET", "/admin/v1/providers/openai", "", &got)
+	if got["api_key"] != redacted {
+		t.Fatalf("expected the api key to be redacted, got %v", got)
+	}
+
+	// Sending the redacted provider back keeps its secret.
+	got["target_url"] = "https://proxy.example.com"
+	body, _ := json.Marshal(got)
+	if code := g.do(t, "PUT", "/admin/v1/providers/openai", string(body), nil); code != http.StatusOK {
+		t.Fatalf("failed to replace provider: %d", code)
+	}
+	if cfg, _ := g.providers.GetConfig("openai"); cfg.APIKey != "sk-secret" || cfg.TargetURL != "https://proxy.example.com" {
+		t.Errorf("unexpected provider %+v", cfg)
+	}
+
+	// A provider created from a redacted copy does not store the placeholder.
+	got["name"] = "openai-proxy"
+	body, _ = json.Marshal(got)
+	if code := g.do(t, "POST", "/admin/v1/providers", string(body), nil); code != http.StatusCreated {
+		t.Fatalf("failed to create provider: %d", code)
+	}
+	if cfg, _ := g.providers.GetConfig("openai-proxy"); cfg.APIKey != "" {
+		t.Errorf("expected the redacted api key not to be stored, got %q", cfg.APIKey)
+	}
+}
+
+func TestRateLimitGroupChanges(t *testing.T) {
+	g := newTestGateway(t, testConfig(), filepath.Join(t.TempDir(), "state.yaml"))
+
+	if code := g.do(t, "PUT", "/admin/v1/ratelimit-groups/interns", `{"requests": 10, "window": "1m"}`, nil); code != http.StatusOK {
+		t.Fatalf("failed to set group: %d", code)
+	}
+	if limit := g.limits.Get().Groups["interns"]; limit.Requests != 10 || limit.Window != time.Minute || limit.Name != "interns" {
+		t.Errorf("unexpected limit %+v", limit)
+	}
+	if code := g.do(t, "PUT", "/admin/v1/ratelimit-groups/interns", `{"requests": 0}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected an empty limit to be rejected, got %d", code)
+	}
+	if code := g.do(t, "DELETE", "/admin/v1/ratelimit-groups/interns", "", nil); code != http.StatusNoContent {
+		t.Fatalf("failed to delete group: %d", code)
+	}
+	if _, ok := g.limits.Get().Groups["interns"]; ok {
+		t.Error("expected the group to be removed")
+	}
+}
+
+func TestKeyChanges(t *testing.T) {
+	g := newTestGateway(t, testConfig(), filepath.Join(t.TempDir(), "state.yaml"))
+
+	var created struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	code := g.do(t, "POST", "/admin/v1/keys", `{"subject": "ci", "groups": ["ci"], "expires_at": "2030-01-01T00:00:00Z"}`, &created)
+	if code != http.StatusCreated || !strings.HasPrefix(created.Secret, apikeys.Prefix) {
+		t.Fatalf("unexpected response %d %+v", code, created)
+	}
+	key, err := g.keys.Authenticate(context.Background(), created.Secret)
+	if err != nil || key.Subject != "ci" || key.ExpiresAt == nil || key.ExpiresAt.Year() != 2030 {
+		t.Fatalf("expected the new key to authenticate, got %+v, %v", key, err)
+	}
+
+	if code := g.do(t, "PUT", "/admin/v1/keys/"+created.ID, `{"subject": "ci", "groups": ["ci"], "models": ["openai/*"]}`, nil); code != http.StatusOK {
+		t.Fatalf("failed to replace key: %d", code)
+	}
+	var got map[string]any
+	g.do(t, "GET", "/admin/v1/keys/"+created.ID, "", &got)
+	if _, ok := got["secret"]; ok || got["models"] == nil {
+		t.Errorf("unexpected key %v", got)
+	}
+	if _, err := g.keys.Authenticate(context.Background(), created.Secret); err != nil {
+		t.Errorf("expected the key to keep its secret, got %v", err)
+	}
+
+	if code := g.do(t, "DELETE", "/admin/v1/keys/"+created.ID, "", nil); code != http.StatusNoContent {
+		t.Fatalf("failed to delete key: %d", code)
+	}
+	if _, err := g.keys.Authenticate(context.Background(), created.Secret); err == nil {
+		t.Error("expected a deleted key to be rejected")
+	}
+}
+
+func TestKeysRequireAPIKeys(t *testing.T) {
+	g := newTestGateway(t, testConfig(), filepath.Join(t.TempDir(), "state.yaml"))
+	g.api.c.Keys = nil
+
+	if code := g.do(t, "GET", "/admin/v1/keys", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 without api keys, got %d", code)
+	}
+}
@@ -0,0 +1,379 @@
+package admin
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"llm-gateway/internal/apikeys"
+	"llm-gateway/internal/config"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in responses.
+const redacted = "REDACTED"
+
+// maxBodySize bounds the size of request bodies.
+const maxBodySize = 1 << 20
+
+// RegisterRoutes registers the admin routes under /admin/v1. Resources use
+// the field names of config.yaml.
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/v1/keys", a.keysEnabled(a.listKeys))
+	mux.HandleFunc("POST /admin/v1/keys", a.keysEnabled(a.createKey))
+	mux.HandleFunc("GET /admin/v1/keys/{id}", a.keysEnabled(a.getKey))
+	mux.HandleFunc("PUT /admin/v1/keys/{id}", a.keysEnabled(a.updateKey))
+	mux.HandleFunc("DELETE /admin/v1/keys/{id}", a.keysEnabled(a.deleteKey))
+
+	mux.HandleFunc("GET /admin/v1/providers", a.listProviders)
+	mux.HandleFunc("POST /admin/v1/providers", a.createProvider)
+	mux.HandleFunc("GET /admin/v1/providers/{name}", a.getProvider)
+	mux.HandleFunc("PUT /admin/v1/providers/{name}", a.replaceProvider)
+	mux.HandleFunc("DELETE /admin/v1/providers/{name}", a.removeProvider)
+
+	mux.HandleFunc("GET /admin/v1/strategies", a.listStrategies)
+	mux.HandleFunc("POST /admin/v1/strategies", a.createStrategy)
+	mux.HandleFunc("GET /admin/v1/strategies/{name}", a.getStrategy)
+	mux.HandleFunc("PUT /admin/v1/strategies/{name}", a.replaceStrategy)
+	mux.HandleFunc("DELETE /admin/v1/strategies/{name}", a.removeStrategy)
+
+	mux.HandleFunc("GET /admin/v1/ratelimit-groups", a.listRateLimitGroups)
+	mux.HandleFunc("GET /admin/v1/ratelimit-groups/{name}", a.getRateLimitGroup)
+	mux.HandleFunc("PUT /admin/v1/ratelimit-groups/{name}", a.replaceRateLimitGroup)
+	mux.HandleFunc("DELETE /admin/v1/ratelimit-groups/{name}", a.removeRateLimitGroup)
+}
+
+// writeResource writes v as JSON with the field names it has in config.yaml.
+func writeResource(w http.ResponseWriter, status int, v any) {
+	data, err := yaml.Marshal(v)
+	var doc any
+	if err == nil {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to encode admin response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// readResource decodes a JSON body into v using the field names of
+// config.yaml, rejecting unknown fields. JSON is valid YAML, which lets
+// durations be given as strings such as "30s".
+func readResource(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err == nil {
+		decoder := yaml.NewDecoder(bytes.NewReader(body))
+		decoder.KnownFields(true)
+		err = decoder.Decode(v)
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeError maps an error of a change to a response.
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, apikeys.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, ErrConflict):
+		http.Error(w, "Already exists", http.StatusConflict)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logrus.Errorf("Admin API error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// redact removes the secrets of a provider.
+func redact(p config.Provider) config.Provider {
+	if p.APIKey != "" {
+		p.APIKey = redacted
+	}
+	if p.Auth.SigV4.SecretAccessKey != "" {
+		p.Auth.SigV4.SecretAccessKey = redacted
+	}
+	if p.Auth.SigV4.SessionToken != "" {
+		p.Auth.SigV4.SessionToken = redacted
+	}
+	return p
+}
+
+// unredact drops secrets sent back as returned by the API, so that they keep
+// their current value.
+func unredact(p *config.Provider) {
+	for _, secret := range []*string{&p.APIKey, &p.Auth.SigV4.SecretAccessKey, &p.Auth.SigV4.SessionToken} {
+		if *secret == redacted {
+			*secret = ""
+		}
+	}
+}
+
+func (a *API) listProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []config.Provider{}
+	for _, p := range a.snapshot().Providers {
+		providers = append(providers, redact(p))
+	}
+	writeResource(w, http.StatusOK, providers)
+}
+
+func (a *API) getProvider(w http.ResponseWriter, r *http.Request) {
+	providers := a.snapshot().Providers
+	i := indexOf(providers, r.PathValue("name"), providerName)
+	if i < 0 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	writeResource(w, http.StatusOK, redact(providers[i]))
+}
+
+func (a *API) createProvider(w http.ResponseWriter, r *http.Request) {
+	var p config.Provider
+	if !readResource(w, r, &p) {
+		return
+	}
+	if p.Name == "" {
+		http.Error(w, "The provider requires a name", http.StatusBadRequest)
+		return
+	}
+	unredact(&p)
+	if err := a.putProvider(p, true); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusCreated, redact(p))
+}
+
+// replaceProvider handles PUT, creating the provider if it does not exist.
+func (a *API) replaceProvider(w http.ResponseWriter, r *http.Request) {
+	var p config.Provider
+	if !readResource(w, r, &p) {
+		return
+	}
+	p.Name = r.PathValue("name")
+	unredact(&p)
+	if err := a.putProvider(p, false); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, redact(p))
+}
+
+func (a *API) removeProvider(w http.ResponseWriter, r *http.Request) {
+	if err := a.deleteProvider(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listStrategies(w http.ResponseWriter, r *http.Request) {
+	writeResource(w, http.StatusOK, append([]config.Strategy{}, a.snapshot().Strategies...))
+}
+
+func (a *API) getStrategy(w http.ResponseWriter, r *http.Request) {
+	strategies := a.snapshot().Strategies
+	i := indexOf(strategies, r.PathValue("name"), strategyName)
+	if i < 0 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	writeResource(w, http.StatusOK, strategies[i])
+}
+
+func (a *API) createStrategy(w http.ResponseWriter, r *http.Request) {
+	var s config.Strategy
+	if !readResource(w, r, &s) {
+		return
+	}
+	if s.Name == "" {
+		http.Error(w, "The strategy requires a name", http.StatusBadRequest)
+		return
+	}
+	if err := a.putStrategy(s, true); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusCreated, s)
+}
+
+func (a *API) replaceStrategy(w http.ResponseWriter, r *http.Request) {
+	var s config.Strategy
+	if !readResource(w, r, &s) {
+		return
+	}
+	s.Name = r.PathValue("name")
+	if err := a.putStrategy(s, false); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, s)
+}
+
+func (a *API) removeStrategy(w http.ResponseWriter, r *http.Request) {
+	if err := a.deleteStrategy(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listRateLimitGroups(w http.ResponseWriter, r *http.Request) {
+	groups := a.snapshot().RateLimit.Groups
+	if groups == nil {
+		groups = map[string]config.RateLimitConfig{}
+	}
+	writeResource(w, http.StatusOK, groups)
+}
+
+func (a *API) getRateLimitGroup(w http.ResponseWriter, r *http.Request) {
+	limit, ok := a.snapshot().RateLimit.Groups[r.PathValue("name")]
+	if !ok {
+		writeError(w, ErrNotFound)
+		return
+	}
+	writeResource(w, http.StatusOK, limit)
+}
+
+func (a *API) replaceRateLimitGroup(w http.ResponseWriter, r *http.Request) {
+	var limit config.RateLimitConfig
+	if !readResource(w, r, &limit) {
+		return
+	}
+	limit.Name = r.PathValue("name")
+	if err := a.putRateLimitGroup(limit.Name, limit); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, limit)
+}
+
+func (a *API) removeRateLimitGroup(w http.ResponseWriter, r *http.Request) {
+	if err := a.deleteRateLimitGroup(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) keysEnabled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.c.Keys == nil {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// keyRequest is the body of requests creating or replacing an API key. The
+// secret and its hash are always generated by the gateway.
+type keyRequest struct {
+	ID        string                  `yaml:"id"`
+	Subject   string                  `yaml:"subject"`
+	Groups    []string                `yaml:"groups"`
+	Models    []string                `yaml:"models"`
+	ExpiresAt *time.Time              `yaml:"expires_at"`
+	RateLimit *config.RateLimitConfig `yaml:"rate_limit"`
+}
+
+// readKey decodes a keyRequest into the fields of key it sets.
+func readKey(w http.ResponseWriter, r *http.Request, key *apikeys.Key) bool {
+	var req keyRequest
+	if !readResource(w, r, &req) {
+		return false
+	}
+	if req.RateLimit != nil && (req.RateLimit.Requests <= 0 || req.RateLimit.Window <= 0) {
+		http.Error(w, "The rate limit of the key requires requests and a window", http.StatusBadRequest)
+		return false
+	}
+	key.ID = cmp.Or(key.ID, req.ID)
+	key.Subject, key.Groups, key.Models = req.Subject, req.Groups, req.Models
+	key.ExpiresAt, key.RateLimit = req.ExpiresAt, req.RateLimit
+	return true
+}
+
+func (a *API) listKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.c.Keys.Store().List(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	slices.SortFunc(keys, func(a, b apikeys.Key) int { return strings.Compare(a.ID, b.ID) })
+	writeResource(w, http.StatusOK, append([]apikeys.Key{}, keys...))
+}
+
+func (a *API) getKey(w http.ResponseWriter, r *http.Request) {
+	key, err := a.c.Keys.Store().Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, key)
+}
+
+// createKey handles POST, responding with the key and its secret. The secret
+// is not stored and cannot be retrieved again.
+func (a *API) createKey(w http.ResponseWriter, r *http.Request) {
+	var key apikeys.Key
+	if !readKey(w, r, &key) {
+		return
+	}
+	if key.ID != "" {
+		if _, err := a.c.Keys.Store().Get(r.Context(), key.ID); err == nil {
+			writeError(w, ErrConflict)
+			return
+		} else if !errors.Is(err, apikeys.ErrNotFound) {
+			writeError(w, err)
+			return
+		}
+	}
+	secret, key, err := a.c.Keys.Create(r.Context(), key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusCreated, struct {
+		apikeys.Key `yaml:",inline"`
+		Secret      string `yaml:"secret"`
+	}{key, secret})
+}
+
+// updateKey handles PUT, replacing everything but the secret of a key.
+func (a *API) updateKey(w http.ResponseWriter, r *http.Request) {
+	key, err := a.c.Keys.Store().Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !readKey(w, r, &key) {
+		return
+	}
+	if err := a.c.Keys.Store().Put(r.Context(), key); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, key)
+}
+
+func (a *API) deleteKey(w http.ResponseWriter, r *http.Request) {
+	if err := a.c.Keys.Store().Delete(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
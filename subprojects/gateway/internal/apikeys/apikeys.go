@@ -0,0 +1,170 @@
+// Package apikeys implements gateway-issued API keys, an alternative to OIDC
+// tokens for clients that cannot run an OAuth flow. Keys have the form
+// "sk-gw-<random>" and are only stored as SHA-256 hashes; each is bound to a
+// subject, groups, allowed models, an expiry and rate limit overrides.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"llm-gateway/internal/config"
+	"path"
+	"strings"
+	"time"
+)
+
+// Prefix starts every gateway API key.
+const Prefix = "sk-gw-"
+
+var (
+	// ErrNotFound is returned by stores for keys that do not exist.
+	ErrNotFound = errors.New("api key not found")
+	// ErrInvalidKey is returned for unknown and malformed keys.
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrExpired is returned for keys past their expiry.
+	ErrExpired = errors.New("api key has expired")
+)
+
+// Key is a stored API key. The key itself is never stored, only its hash.
+type Key struct {
+	ID string `json:"id" yaml:"id"`
+	// Hash is the hex SHA-256 of the key.
+	Hash    string   `json:"hash" yaml:"hash"`
+	Subject string   `json:"subject" yaml:"subject"`
+	Groups  []string `json:"groups" yaml:"groups"`
+	// Models restricts the key to these models, matched as path patterns
+	// such as "openai/*". Empty allows every model the groups allow.
+	Models    []string                `json:"models,omitempty" yaml:"models"`
+	ExpiresAt *time.Time              `json:"expires_at,omitempty" yaml:"expires_at"`
+	RateLimit *config.RateLimitConfig `json:"rate_limit,omitempty" yaml:"rate_limit"`
+	CreatedAt time.Time               `json:"created_at" yaml:"created_at"`
+}
+
+// Expired reports whether the key is past its expiry.
+func (k Key) Expired() bool {
+	return k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt)
+}
+
+// AllowsModel reports whether the key may use a model, under any of names.
+func (k Key) AllowsModel(names ...string) bool {
+	if len(k.Models) == 0 {
+		return true
+	}
+	return AllowsModel(k.Models, names...)
+}
+
+// AllowsModel reports whether any of names matches one of the patterns.
+func AllowsModel(patterns []string, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Store persists API keys, indexed by ID and by hash.
+type Store interface {
+	// Get returns a key by ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (Key, error)
+	// GetByHash returns a key by hash, or ErrNotFound.
+	GetByHash(ctx context.Context, hash string) (Key, error)
+	List(ctx context.Context) ([]Key, error)
+	// Put creates or replaces a key.
+	Put(ctx context.Context, key Key) error
+	// Delete removes a key, returning ErrNotFound if it does not exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// Hash returns the hex SHA-256 of a key, as stored.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new random key.
+func Generate() string {
+	var b [24]byte
+	rand.Read(b[:])
+	return Prefix + hex.EncodeToString(b[:])
+}
+
+// Service authenticates and issues API keys.
+type Service struct {
+	store Store
+}
+
+// NewService creates a service backed by store.
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Store returns the service's key store.
+func (s *Service) Store() Store {
+	return s.store
+}
+
+// Seed stores the keys of the configuration, replacing stored keys with the
+// same ID.
+func (s *Service) Seed(ctx context.Context, keys []config.APIKey) error {
+	for _, k := range keys {
+		key := Key{
+			ID:        k.ID,
+			Hash:      strings.ToLower(k.Hash),
+			Subject:   k.Subject,
+			Groups:    k.Groups,
+			Models:    k.Models,
+			RateLimit: k.RateLimit,
+			CreatedAt: time.Now(),
+		}
+		if !k.ExpiresAt.IsZero() {
+			expires := k.ExpiresAt
+			key.ExpiresAt = &expires
+		}
+		if err := s.store.Put(ctx, key); err != nil {
+			return fmt.Errorf("failed to store api key '%s': %w", k.ID, err)
+		}
+	}
+	return nil
+}
+
+// Create issues a new key with the attributes of key, returning the secret
+// key, which is not stored, and the stored key.
+func (s *Service) Create(ctx context.Context, key Key) (string, Key, error) {
+	secret := Generate()
+	if key.ID == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		key.ID = "key_" + hex.EncodeToString(b[:])
+	}
+	key.Hash = Hash(secret)
+	key.CreatedAt = time.Now()
+	if err := s.store.Put(ctx, key); err != nil {
+		return "", Key{}, err
+	}
+	return secret, key, nil
+}
+
+// Authenticate returns the key matching secret.
+func (s *Service) Authenticate(ctx context.Context, secret string) (Key, error) {
+	if !strings.HasPrefix(secret, Prefix) {
+		return Key{}, ErrInvalidKey
+	}
+	key, err := s.store.GetByHash(ctx, Hash(secret))
+	if errors.Is(err, ErrNotFound) {
+		return Key{}, ErrInvalidKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	if key.Expired() {
+		return Key{}, ErrExpired
+	}
+	return key, nil
+}
@@ -0,0 +1,98 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"llm-gateway/internal/config"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryStore())
+	secret, key, err := s.Create(ctx, Key{Subject: "ci-bot", Groups: []string{"ci"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, Prefix) || key.Hash != Hash(secret) || strings.Contains(key.Hash, secret) {
+		t.Fatalf("unexpected key %q %+v", secret, key)
+	}
+
+	got, err := s.Authenticate(ctx, secret)
+	if err != nil || got.Subject != "ci-bot" {
+		t.Errorf("unexpected key %+v, %v", got, err)
+	}
+	for _, invalid := range []string{"sk-gw-unknown", "sk-other", key.Hash} {
+		if _, err := s.Authenticate(ctx, invalid); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", invalid, err)
+		}
+	}
+
+	past := time.Now().Add(-time.Minute)
+	key.ExpiresAt = &past
+	s.Store().Put(ctx, key)
+	if _, err := s.Authenticate(ctx, secret); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+}
+
+func TestSeedStoresConfiguredKeys(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(NewMemoryStore())
+	secret := Generate()
+	err := s.Seed(ctx, []config.APIKey{{
+		ID:        "ci",
+		Hash:      strings.ToUpper(Hash(secret)),
+		Subject:   "ci-bot",
+		Models:    []string{"openai/*"},
+		ExpiresAt: time.Now().Add(time.Hour),
+		RateLimit: &config.RateLimitConfig{Requests: 5, Window: time.Minute},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.Authenticate(ctx, secret)
+	if err != nil || key.ID != "ci" || key.ExpiresAt == nil || key.RateLimit.Requests != 5 {
+		t.Fatalf("unexpected key %+v, %v", key, err)
+	}
+	if !key.AllowsModel("gpt-4", "openai/gpt-4") || key.AllowsModel("anthropic/claude-3") {
+		t.Error("unexpected model restrictions")
+	}
+}
+
+func TestFileStorePersistsKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(ctx, Key{ID: "a", Hash: "1", Subject: "alice"})
+	store.Put(ctx, Key{ID: "b", Hash: "2", Subject: "bob"})
+	// Replacing a key drops its old hash.
+	store.Put(ctx, Key{ID: "a", Hash: "3", Subject: "alice"})
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := reloaded.List(ctx)
+	if len(keys) != 1 || keys[0].ID != "a" {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+	if _, err := reloaded.GetByHash(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the old hash to be gone, got %v", err)
+	}
+	if key, err := reloaded.GetByHash(ctx, "3"); err != nil || key.Subject != "alice" {
+		t.Errorf("unexpected key %+v, %v", key, err)
+	}
+}
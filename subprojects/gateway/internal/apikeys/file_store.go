@@ -0,0 +1,91 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps API keys in memory and persists them to a JSON file, which
+// is rewritten atomically on every change.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore loads the keys of the file at path, which need not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		s.put(key)
+	}
+	return s, nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, existed := s.keys[key.ID]
+	s.put(key)
+	if err := s.save(); err != nil {
+		// Keep the memory consistent with the file.
+		s.delete(key.ID)
+		if existed {
+			s.put(old)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.keys[id]
+	if err := s.delete(id); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.put(old)
+		return err
+	}
+	return nil
+}
+
+// save writes all keys to a temporary file and renames it over the store.
+func (s *FileStore) save() error {
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
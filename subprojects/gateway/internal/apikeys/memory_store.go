@@ -0,0 +1,82 @@
+package apikeys
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of Store.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	keys   map[string]Key
+	byHash map[string]string
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys:   make(map[string]Key),
+		byHash: make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryStore) GetByHash(ctx context.Context, hash string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[s.byHash[hash]]
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key)
+	return nil
+}
+
+func (s *MemoryStore) put(key Key) {
+	if old, ok := s.keys[key.ID]; ok {
+		delete(s.byHash, old.Hash)
+	}
+	s.keys[key.ID] = key
+	s.byHash[key.Hash] = key.ID
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(id)
+}
+
+func (s *MemoryStore) delete(id string) error {
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	delete(s.byHash, key.Hash)
+	return nil
+}
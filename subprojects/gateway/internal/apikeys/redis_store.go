@@ -0,0 +1,101 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys of the store: a hash of keys by ID and a hash of IDs by key
+// hash, so that gateway replicas share their keys.
+const (
+	redisKeys   = "apikeys:keys"
+	redisHashes = "apikeys:hashes"
+)
+
+// RedisStore is a Redis-backed implementation of Store.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a new RedisStore.
+func NewRedisStore(address string) *RedisStore {
+	return &RedisStore{
+		client: redis.NewClient(&redis.Options{Addr: address}),
+	}
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (Key, error) {
+	data, err := s.client.HGet(ctx, redisKeys, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Key{}, ErrNotFound
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	var key Key
+	err = json.Unmarshal(data, &key)
+	return key, err
+}
+
+func (s *RedisStore) GetByHash(ctx context.Context, hash string) (Key, error) {
+	id, err := s.client.HGet(ctx, redisHashes, hash).Result()
+	if errors.Is(err, redis.Nil) {
+		return Key{}, ErrNotFound
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *RedisStore) List(ctx context.Context) ([]Key, error) {
+	values, err := s.client.HVals(ctx, redisKeys).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(values))
+	for _, value := range values {
+		var key Key
+		if err := json.Unmarshal([]byte(value), &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *RedisStore) Put(ctx context.Context, key Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	old, err := s.Get(ctx, key.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if old.Hash != "" && old.Hash != key.Hash {
+			pipe.HDel(ctx, redisHashes, old.Hash)
+		}
+		pipe.HSet(ctx, redisKeys, key.ID, data)
+		pipe.HSet(ctx, redisHashes, key.Hash, key.ID)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, redisKeys, id)
+		pipe.HDel(ctx, redisHashes, key.Hash)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,441 @@
+// Package batch implements the OpenAI Files and Batch APIs in the gateway
+// itself. Uploaded JSONL files of requests are executed through the proxy at
+// low priority, so that batch workflows work with any provider; progress is
+// kept in a bbolt database so that batches resume after a restart.
+package batch
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConcurrency = 4
+	defaultMaxFileSize = 200 << 20
+	// maxRequests caps the number of request lines in a batch.
+	maxRequests = 50000
+)
+
+// File purposes.
+const (
+	PurposeBatch       = "batch"
+	PurposeBatchOutput = "batch_output"
+)
+
+// Batch statuses.
+const (
+	StatusValidating = "validating"
+	StatusFailed     = "failed"
+	StatusInProgress = "in_progress"
+	StatusFinalizing = "finalizing"
+	StatusCompleted  = "completed"
+	StatusExpired    = "expired"
+	StatusCancelling = "cancelling"
+	StatusCancelled  = "cancelled"
+)
+
+// Endpoints lists the endpoints batches can target.
+var Endpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings"}
+
+var (
+	// ErrNotFound is returned for files and batches that do not exist or
+	// belong to another user.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidRequest is wrapped by errors caused by the client's request.
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// File is an uploaded or generated file, as returned by the Files API.
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// Batch is a batch job, as returned by the Batch API.
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *Errors           `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     *string           `json:"output_file_id"`
+	ErrorFileID      *string           `json:"error_file_id"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     *int64            `json:"in_progress_at"`
+	ExpiresAt        *int64            `json:"expires_at"`
+	FinalizingAt     *int64            `json:"finalizing_at"`
+	CompletedAt      *int64            `json:"completed_at"`
+	FailedAt         *int64            `json:"failed_at"`
+	ExpiredAt        *int64            `json:"expired_at"`
+	CancellingAt     *int64            `json:"cancelling_at"`
+	CancelledAt      *int64            `json:"cancelled_at"`
+	RequestCounts    RequestCounts     `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// Errors lists the problems that failed a batch during validation.
+type Errors struct {
+	Object string  `json:"object"`
+	Data   []Error `json:"data"`
+}
+
+// Error is a validation error of an input file.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int   `json:"line"`
+}
+
+// RequestCounts counts the requests of a batch.
+type RequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// CreateRequest is the body of POST /v1/batches.
+type CreateRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// Service stores files and runs batches.
+type Service struct {
+	dir         string
+	store       *store
+	handler     http.Handler
+	active      func() int64
+	yieldAbove  int64
+	maxFileSize int64
+	sem         chan struct{}
+
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	mu sync.Mutex
+	// running holds the function stopping the dispatch of each running batch.
+	running map[string]context.CancelFunc
+}
+
+// NewService opens the store in cfg.Dir. Batch requests are served by
+// handler, normally the proxy behind model authorization; active reports the
+// client requests in flight, which batch requests yield to.
+func NewService(cfg config.Batches, handler http.Handler, active func() int64) (*Service, error) {
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, "files"), 0o750); err != nil {
+		return nil, err
+	}
+	st, err := openStore(filepath.Join(cfg.Dir, "batches.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	s := &Service{
+		dir:         cfg.Dir,
+		store:       st,
+		handler:     handler,
+		active:      active,
+		yieldAbove:  int64(cfg.YieldAbove),
+		maxFileSize: cfg.MaxFileSize,
+		sem:         make(chan struct{}, concurrency),
+		running:     make(map[string]context.CancelFunc),
+	}
+	if s.maxFileSize <= 0 {
+		s.maxFileSize = defaultMaxFileSize
+	}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// Start resumes the batches that were running when the gateway stopped.
+func (s *Service) Start() {
+	logrus.Println("Starting batch service...")
+	recs, err := s.store.batches()
+	if err != nil {
+		logrus.Errorf("Failed to list batches: %v", err)
+		return
+	}
+	for _, rec := range recs {
+		if !isTerminal(rec.Status) {
+			s.launch(rec.ID)
+		}
+	}
+}
+
+// Stop waits for the running batches to pause and closes the store. Requests
+// in flight are abandoned and sent again on the next start.
+func (s *Service) Stop() {
+	s.stop()
+	s.wg.Wait()
+	s.store.close()
+}
+
+// MaxFileSize returns the size limit of uploaded files.
+func (s *Service) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+func isTerminal(status string) bool {
+	switch status {
+	case StatusFailed, StatusCompleted, StatusExpired, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+func newID(prefix string) string {
+	var b [12]byte
+	rand.Read(b[:])
+	return prefix + hex.EncodeToString(b[:])
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// CreateFile stores an uploaded file.
+func (s *Service) CreateFile(owner, filename, purpose string, content io.Reader) (File, error) {
+	if purpose != PurposeBatch {
+		return File{}, fmt.Errorf("%w: only files with purpose '%s' are supported", ErrInvalidRequest, PurposeBatch)
+	}
+	return s.writeFile(owner, filename, purpose, func(w io.Writer) error {
+		_, err := io.Copy(w, content)
+		return err
+	})
+}
+
+// writeFile stores a file whose content is written by write.
+func (s *Service) writeFile(owner, filename, purpose string, write func(w io.Writer) error) (File, error) {
+	id := newID("file-")
+	path := filepath.Join(s.dir, "files", id)
+	f, err := os.Create(path)
+	if err != nil {
+		return File{}, err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	info, statErr := os.Stat(path)
+	if err == nil {
+		err = statErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return File{}, err
+	}
+
+	rec := fileRecord{
+		File:  File{ID: id, Object: "file", Bytes: info.Size(), CreatedAt: now(), Filename: filename, Purpose: purpose},
+		Owner: owner,
+		Path:  path,
+	}
+	if err := s.store.putFile(rec); err != nil {
+		os.Remove(path)
+		return File{}, err
+	}
+	return rec.File, nil
+}
+
+func (s *Service) fileRecord(owner, id string) (fileRecord, error) {
+	rec, err := s.store.file(id)
+	if errors.Is(err, errMissing) || (err == nil && rec.Owner != owner) {
+		return fileRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+// File returns a file of the user.
+func (s *Service) File(owner, id string) (File, error) {
+	rec, err := s.fileRecord(owner, id)
+	return rec.File, err
+}
+
+// Files lists the user's files, newest first, optionally with the given purpose.
+func (s *Service) Files(owner, purpose string) ([]File, error) {
+	recs, err := s.store.files()
+	if err != nil {
+		return nil, err
+	}
+	files := []File{}
+	for _, rec := range recs {
+		if rec.Owner == owner && (purpose == "" || rec.Purpose == purpose) {
+			files = append(files, rec.File)
+		}
+	}
+	slices.SortFunc(files, func(a, b File) int {
+		return cmp.Or(cmp.Compare(b.CreatedAt, a.CreatedAt), strings.Compare(b.ID, a.ID))
+	})
+	return files, nil
+}
+
+// OpenFile opens the content of a file of the user.
+func (s *Service) OpenFile(owner, id string) (*os.File, File, error) {
+	rec, err := s.fileRecord(owner, id)
+	if err != nil {
+		return nil, File{}, err
+	}
+	f, err := os.Open(rec.Path)
+	return f, rec.File, err
+}
+
+// DeleteFile deletes a file of the user.
+func (s *Service) DeleteFile(owner, id string) error {
+	rec, err := s.fileRecord(owner, id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.deleteFile(id); err != nil {
+		return err
+	}
+	os.Remove(rec.Path)
+	return nil
+}
+
+// CreateBatch validates a batch request and starts the batch, whose requests
+// are sent as owner with the given groups, restricted to models when it is
+// not empty and counted against rateLimit when it is not nil. The input file
+// itself is validated by the batch, which fails if it is malformed.
+func (s *Service) CreateBatch(owner string, groups, models []string, rateLimit *config.RateLimitConfig, req CreateRequest) (Batch, error) {
+	if !slices.Contains(Endpoints, req.Endpoint) {
+		return Batch{}, fmt.Errorf("%w: unsupported endpoint '%s'", ErrInvalidRequest, req.Endpoint)
+	}
+	window, err := time.ParseDuration(req.CompletionWindow)
+	if err != nil || window <= 0 {
+		return Batch{}, fmt.Errorf("%w: invalid completion_window '%s'", ErrInvalidRequest, req.CompletionWindow)
+	}
+	input, err := s.fileRecord(owner, req.InputFileID)
+	if errors.Is(err, ErrNotFound) {
+		return Batch{}, fmt.Errorf("%w: input file '%s' not found", ErrInvalidRequest, req.InputFileID)
+	}
+	if err != nil {
+		return Batch{}, err
+	}
+	if input.Purpose != PurposeBatch {
+		return Batch{}, fmt.Errorf("%w: input file must have purpose '%s'", ErrInvalidRequest, PurposeBatch)
+	}
+
+	created := now()
+	expires := created + int64(window/time.Second)
+	rec := batchRecord{
+		Batch: Batch{
+			ID:               newID("batch_"),
+			Object:           "batch",
+			Endpoint:         req.Endpoint,
+			InputFileID:      req.InputFileID,
+			CompletionWindow: req.CompletionWindow,
+			Status:           StatusValidating,
+			CreatedAt:        created,
+			ExpiresAt:        &expires,
+			Metadata:         req.Metadata,
+		},
+		Owner:     owner,
+		Groups:    groups,
+		Models:    models,
+		RateLimit: rateLimit,
+	}
+	if err := s.store.putBatch(rec); err != nil {
+		return Batch{}, err
+	}
+	s.launch(rec.ID)
+	return rec.Batch, nil
+}
+
+func (s *Service) batchRecord(owner, id string) (batchRecord, error) {
+	rec, err := s.store.batch(id)
+	if errors.Is(err, errMissing) || (err == nil && rec.Owner != owner) {
+		return batchRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+// Batch returns a batch of the user.
+func (s *Service) Batch(owner, id string) (Batch, error) {
+	rec, err := s.batchRecord(owner, id)
+	return rec.Batch, err
+}
+
+// Batches lists the user's batches, newest first, starting after the batch
+// with the given ID. It reports whether there are more than limit.
+func (s *Service) Batches(owner, after string, limit int) ([]Batch, bool, error) {
+	recs, err := s.store.batches()
+	if err != nil {
+		return nil, false, err
+	}
+	batches := []Batch{}
+	for _, rec := range recs {
+		if rec.Owner == owner {
+			batches = append(batches, rec.Batch)
+		}
+	}
+	slices.SortFunc(batches, func(a, b Batch) int {
+		return cmp.Or(cmp.Compare(b.CreatedAt, a.CreatedAt), strings.Compare(b.ID, a.ID))
+	})
+	if after != "" {
+		i := slices.IndexFunc(batches, func(b Batch) bool { return b.ID == after })
+		batches = batches[i+1:]
+	}
+	if len(batches) > limit {
+		return batches[:limit], true, nil
+	}
+	return batches, false, nil
+}
+
+// CancelBatch cancels a batch of the user. Requests in flight complete, and
+// the results obtained so far are written to its output files.
+func (s *Service) CancelBatch(owner, id string) (Batch, error) {
+	if _, err := s.batchRecord(owner, id); err != nil {
+		return Batch{}, err
+	}
+	var conflict bool
+	rec, err := s.store.updateBatch(id, func(rec *batchRecord) {
+		switch rec.Status {
+		case StatusValidating, StatusInProgress:
+			t := now()
+			rec.Status, rec.CancellingAt = StatusCancelling, &t
+		case StatusCancelling, StatusCancelled:
+		default:
+			conflict = true
+		}
+	})
+	if err != nil {
+		return Batch{}, err
+	}
+	if conflict {
+		return Batch{}, fmt.Errorf("%w: cannot cancel a batch with status '%s'", ErrInvalidRequest, rec.Status)
+	}
+
+	s.mu.Lock()
+	if cancel, ok := s.running[id]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+	return rec.Batch, nil
+}
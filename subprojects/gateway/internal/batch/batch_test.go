@@ -0,0 +1,266 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// echoHandler answers chat completions with the request's first message, and
+// fails requests for the model "broken".
+func echoHandler(calls *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		limit, _ := r.Context().Value("rate_limit").(config.RateLimitConfig)
+		if req.Model == "broken" {
+			http.Error(w, "Model not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]string{"content": req.Messages[0].Content}}},
+			"user":    r.Context().Value("user_id"),
+			"models":  r.Context().Value("allowed_models"),
+			"limit":   limit.Name,
+		})
+	}
+}
+
+func newTestService(t *testing.T, dir string, handler http.Handler, active func() int64) *Service {
+	t.Helper()
+	s, err := NewService(config.Batches{Dir: dir, Concurrency: 2, YieldAbove: 1}, handler, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func idle() int64 { return 0 }
+
+func requestLines(models ...string) string {
+	var b strings.Builder
+	for i, model := range models {
+		line, _ := json.Marshal(map[string]any{
+			"custom_id": "req-" + string(rune('a'+i)),
+			"method":    "POST",
+			"url":       "/v1/chat/completions",
+			"body":      map[string]any{"model": model, "messages": []map[string]string{{"role": "user", "content": "hi " + model}}},
+		})
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// waitFor polls a batch until it reaches a final status.
+func waitFor(t *testing.T, s *Service, owner, id string) Batch {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b, err := s.Batch(owner, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isTerminal(b.Status) {
+			return b
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("batch %s did not finish", id)
+	return Batch{}
+}
+
+func readLines(t *testing.T, s *Service, owner string, id *string) []outputLine {
+	t.Helper()
+	if id == nil {
+		return nil
+	}
+	f, _, err := s.OpenFile(owner, *id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []outputLine
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line outputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid output line %s: %v", scanner.Bytes(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestBatchRunsRequests(t *testing.T) {
+	var calls atomic.Int32
+	s := newTestService(t, t.TempDir(), echoHandler(&calls), idle)
+	s.Start()
+	defer s.Stop()
+
+	input, err := s.CreateFile("alice", "input.jsonl", PurposeBatch, strings.NewReader(requestLines("gpt-4", "broken", "gpt-4o")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := s.CreateBatch("alice", []string{"users"}, []string{"openai/*"}, &config.RateLimitConfig{Name: "key:ci", Requests: 10, Window: time.Minute}, CreateRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := waitFor(t, s, "alice", created.ID)
+	if b.Status != StatusCompleted || b.RequestCounts != (RequestCounts{Total: 3, Completed: 2, Failed: 1}) {
+		t.Fatalf("unexpected batch %+v", b)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 requests, got %d", calls.Load())
+	}
+
+	outputs := readLines(t, s, "alice", b.OutputFileID)
+	if len(outputs) != 2 || outputs[0].CustomID != "req-a" || outputs[1].CustomID != "req-c" {
+		t.Fatalf("unexpected output lines %+v", outputs)
+	}
+	if body := string(outputs[1].Response.Body); outputs[1].Response.StatusCode != 200 || !strings.Contains(body, "hi gpt-4o") || !strings.Contains(body, `"user":"alice"`) || !strings.Contains(body, `"models":["openai/*"]`) || !strings.Contains(body, `"limit":"key:ci"`) {
+		t.Errorf("unexpected output %s", body)
+	}
+	failures := readLines(t, s, "alice", b.ErrorFileID)
+	if len(failures) != 1 || failures[0].CustomID != "req-b" || failures[0].Response.StatusCode != 404 || !json.Valid(failures[0].Response.Body) {
+		t.Errorf("unexpected error lines %+v", failures)
+	}
+
+	// Other users see neither the batch nor its files.
+	if _, err := s.Batch("bob", b.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another user's batch to be hidden, got %v", err)
+	}
+	if _, _, err := s.OpenFile("bob", *b.OutputFileID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another user's file to be hidden, got %v", err)
+	}
+}
+
+func TestBatchFailsValidation(t *testing.T) {
+	var calls atomic.Int32
+	s := newTestService(t, t.TempDir(), echoHandler(&calls), idle)
+	s.Start()
+	defer s.Stop()
+
+	lines := requestLines("gpt-4") + `{"custom_id": "req-a", "method": "POST", "url": "/v1/chat/completions", "body": {}}` + "\n"
+	input, _ := s.CreateFile("", "input.jsonl", PurposeBatch, strings.NewReader(lines))
+	created, err := s.CreateBatch("", nil, nil, nil, CreateRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := waitFor(t, s, "", created.ID)
+	if b.Status != StatusFailed || b.Errors == nil || b.Errors.Data[0].Code != "duplicate_custom_id" || *b.Errors.Data[0].Line != 2 {
+		t.Fatalf("unexpected batch %+v", b)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("expected no requests, got %d", calls.Load())
+	}
+
+	if _, err := s.CreateBatch("", nil, nil, nil, CreateRequest{InputFileID: input.ID, Endpoint: "/v1/images/generations", CompletionWindow: "24h"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected an unsupported endpoint to be rejected, got %v", err)
+	}
+	if _, err := s.CreateBatch("", nil, nil, nil, CreateRequest{InputFileID: "file-missing", Endpoint: "/v1/chat/completions", CompletionWindow: "24h"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected a missing input file to be rejected, got %v", err)
+	}
+}
+
+func TestBatchYieldsAndCancels(t *testing.T) {
+	var calls atomic.Int32
+	var busy atomic.Int64
+	busy.Store(1)
+	s := newTestService(t, t.TempDir(), echoHandler(&calls), busy.Load)
+	s.Start()
+	defer s.Stop()
+
+	input, _ := s.CreateFile("", "input.jsonl", PurposeBatch, strings.NewReader(requestLines("gpt-4", "gpt-4")))
+	created, _ := s.CreateBatch("", nil, nil, nil, CreateRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+
+	time.Sleep(100 * time.Millisecond)
+	if calls.Load() != 0 {
+		t.Fatalf("expected the batch to yield to client traffic, got %d requests", calls.Load())
+	}
+	if _, err := s.CancelBatch("", created.ID); err != nil {
+		t.Fatal(err)
+	}
+	b := waitFor(t, s, "", created.ID)
+	if b.Status != StatusCancelled || b.CancelledAt == nil || b.OutputFileID != nil {
+		t.Errorf("unexpected batch %+v", b)
+	}
+	if _, err := s.CancelBatch("", created.ID); err != nil {
+		t.Errorf("expected cancelling twice to succeed, got %v", err)
+	}
+}
+
+func TestBatchResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	release := make(chan struct{})
+	var calls atomic.Int32
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		io.WriteString(w, `{"choices": []}`)
+	})
+
+	s := newTestService(t, dir, blocking, idle)
+	s.Start()
+	input, _ := s.CreateFile("", "input.jsonl", PurposeBatch, strings.NewReader(requestLines("a", "b")))
+	created, _ := s.CreateBatch("", nil, nil, nil, CreateRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := s.Batch("", created.ID)
+		if b.RequestCounts.Completed == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Stop()
+
+	close(release)
+	calls.Store(0)
+	s = newTestService(t, dir, blocking, idle)
+	s.Start()
+	defer s.Stop()
+	b := waitFor(t, s, "", created.ID)
+	if b.Status != StatusCompleted || b.RequestCounts.Completed != 2 {
+		t.Fatalf("unexpected batch %+v", b)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected only the unfinished request to be sent again, got %d", calls.Load())
+	}
+}
+
+func TestBatchExpires(t *testing.T) {
+	s := newTestService(t, t.TempDir(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), func() int64 { return 1 })
+	s.Start()
+	defer s.Stop()
+
+	input, _ := s.CreateFile("", "input.jsonl", PurposeBatch, strings.NewReader(requestLines("gpt-4")))
+	created, _ := s.CreateBatch("", nil, nil, nil, CreateRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "1s"})
+	b := waitFor(t, s, "", created.ID)
+	if b.Status != StatusExpired || b.RequestCounts.Failed != 1 {
+		t.Fatalf("unexpected batch %+v", b)
+	}
+	if failures := readLines(t, s, "", b.ErrorFileID); len(failures) != 1 || failures[0].Error.Code != "batch_expired" {
+		t.Errorf("unexpected error lines %+v", failures)
+	}
+}
@@ -0,0 +1,372 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"llm-gateway/internal/core"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// yieldInterval is how often a batch paused for client traffic checks again.
+const yieldInterval = 50 * time.Millisecond
+
+// requestLine is a line of an input file.
+type requestLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// outputLine is a line of an output or error file.
+type outputLine struct {
+	ID       string          `json:"id"`
+	CustomID string          `json:"custom_id"`
+	Response *outputResponse `json:"response"`
+	Error    *outputError    `json:"error"`
+}
+
+type outputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type outputError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// launch runs a batch in the background.
+func (s *Service) launch(id string) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.run(id); err != nil && s.ctx.Err() == nil {
+			logrus.Errorf("Batch %s: %v", id, err)
+		}
+	}()
+}
+
+// run validates a batch, sends its remaining requests and writes its output
+// files. It returns early, leaving the batch to be resumed, when the service
+// stops.
+func (s *Service) run(id string) error {
+	// Register the batch first, so that a cancellation from now on either
+	// is seen below or stops the dispatch.
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.running[id] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	rec, err := s.store.batch(id)
+	if err != nil {
+		return err
+	}
+	lines, errs := s.readInput(rec)
+	if rec.Status == StatusFinalizing {
+		return s.finalize(rec, lines)
+	}
+	if len(errs) > 0 {
+		_, err := s.store.updateBatch(id, func(rec *batchRecord) {
+			t := now()
+			rec.Status, rec.FailedAt = StatusFailed, &t
+			rec.Errors = &Errors{Object: "list", Data: errs}
+		})
+		return err
+	}
+	if rec.Status == StatusValidating {
+		rec, err = s.store.updateBatch(id, func(rec *batchRecord) {
+			if rec.Status == StatusValidating {
+				t := now()
+				rec.Status, rec.InProgressAt = StatusInProgress, &t
+			}
+			rec.RequestCounts.Total = len(lines)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if rec.Status == StatusInProgress {
+		deadline := time.Unix(*rec.ExpiresAt, 0)
+		dispatchCtx, cancelDispatch := context.WithDeadline(ctx, deadline)
+		s.dispatch(dispatchCtx, rec, lines)
+		cancelDispatch()
+	}
+	if s.ctx.Err() != nil {
+		return nil
+	}
+
+	rec, err = s.store.updateBatch(id, func(rec *batchRecord) {
+		t := now()
+		rec.Status, rec.FinalizingAt = StatusFinalizing, &t
+	})
+	if err != nil {
+		return err
+	}
+	return s.finalize(rec, lines)
+}
+
+// readInput parses and validates the input file of a batch.
+func (s *Service) readInput(rec batchRecord) ([]requestLine, []Error) {
+	fail := func(line int, code, format string, args ...any) []Error {
+		e := Error{Code: code, Message: fmt.Sprintf(format, args...)}
+		if line > 0 {
+			e.Line = &line
+		}
+		return []Error{e}
+	}
+
+	input, err := s.store.file(rec.InputFileID)
+	if err != nil {
+		return nil, fail(0, "missing_input_file", "The input file %s no longer exists.", rec.InputFileID)
+	}
+	f, err := os.Open(input.Path)
+	if err != nil {
+		return nil, fail(0, "missing_input_file", "The input file %s cannot be read.", rec.InputFileID)
+	}
+	defer f.Close()
+
+	var lines []requestLine
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, int(s.maxFileSize))
+	for n := 1; scanner.Scan(); n++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var line requestLine
+		var body map[string]json.RawMessage
+		switch {
+		case json.Unmarshal(data, &line) != nil:
+			return nil, fail(n, "invalid_json_line", "Line %d is not valid JSON.", n)
+		case line.CustomID == "":
+			return nil, fail(n, "missing_required_parameter", "Line %d has no custom_id.", n)
+		case seen[line.CustomID]:
+			return nil, fail(n, "duplicate_custom_id", "The custom_id %s is used more than once.", line.CustomID)
+		case line.Method != http.MethodPost:
+			return nil, fail(n, "invalid_method", "Line %d uses method %s; only POST is supported.", n, line.Method)
+		case line.URL != rec.Endpoint:
+			return nil, fail(n, "mismatched_url", "Line %d targets %s instead of the batch endpoint %s.", n, line.URL, rec.Endpoint)
+		case json.Unmarshal(line.Body, &body) != nil || body == nil:
+			return nil, fail(n, "invalid_body", "Line %d has no JSON object body.", n)
+		case string(body["stream"]) == "true":
+			return nil, fail(n, "invalid_body", "Line %d requests streaming, which batches do not support.", n)
+		}
+		seen[line.CustomID] = true
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fail(0, "invalid_file", "The input file cannot be read: %v.", err)
+	}
+	if len(lines) == 0 {
+		return nil, fail(0, "empty_file", "The input file has no requests.")
+	}
+	if len(lines) > maxRequests {
+		return nil, fail(0, "too_many_requests", "The input file has %d requests; the limit is %d.", len(lines), maxRequests)
+	}
+	return lines, nil
+}
+
+// dispatch sends the requests of a batch that have no result yet, until they
+// are all done or ctx is cancelled.
+func (s *Service) dispatch(ctx context.Context, rec batchRecord, lines []requestLine) {
+	done := make(map[int]bool)
+	if err := s.store.results(rec.ID, func(index int, _ result) error {
+		done[index] = true
+		return nil
+	}); err != nil {
+		logrus.Errorf("Batch %s: failed to read progress: %v", rec.ID, err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i, line := range lines {
+		if done[i] {
+			continue
+		}
+		if !s.acquire(ctx) {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-s.sem }()
+			res := s.execute(rec, line)
+			// Requests abandoned because the service stops are sent again.
+			if s.ctx.Err() != nil {
+				return
+			}
+			if err := s.store.addResult(rec.ID, i, res); err != nil {
+				logrus.Errorf("Batch %s: failed to store a result: %v", rec.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// acquire waits until client traffic is below the yield threshold and a
+// request slot is free. It returns false if ctx is done first.
+func (s *Service) acquire(ctx context.Context) bool {
+	for s.yieldAbove > 0 && s.active() >= s.yieldAbove {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(yieldInterval):
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case s.sem <- struct{}{}:
+		return true
+	}
+}
+
+// execute sends one request line through the handler, as the batch's owner.
+func (s *Service) execute(rec batchRecord, line requestLine) result {
+	ctx := context.WithValue(s.ctx, "user_id", rec.Owner)
+	groups := rec.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	ctx = context.WithValue(ctx, "user_groups", groups)
+	if len(rec.Models) > 0 {
+		ctx = context.WithValue(ctx, "allowed_models", rec.Models)
+	}
+	if rec.RateLimit != nil {
+		ctx = context.WithValue(ctx, "rate_limit", *rec.RateLimit)
+	}
+	ctx = core.WithLowPriority(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, line.Method, line.URL, bytes.NewReader(line.Body))
+	if err != nil {
+		return failedLine(line, "invalid_request", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp := core.NewResponseBuffer()
+	s.handler.ServeHTTP(resp, req)
+
+	body := resp.Body()
+	if !json.Valid(body) {
+		// Errors from the gateway itself are plain text.
+		body, _ = json.Marshal(map[string]any{"error": map[string]string{"message": string(bytes.TrimSpace(body))}})
+	}
+	out := outputLine{
+		ID:       newID("batch_req_"),
+		CustomID: line.CustomID,
+		Response: &outputResponse{StatusCode: resp.StatusCode(), RequestID: resp.Header().Get("X-Request-Id"), Body: body},
+	}
+	data, _ := json.Marshal(out)
+	return result{Line: data, Failed: resp.StatusCode() >= 300}
+}
+
+func failedLine(line requestLine, code, message string) result {
+	data, _ := json.Marshal(outputLine{
+		ID:       newID("batch_req_"),
+		CustomID: line.CustomID,
+		Error:    &outputError{Code: code, Message: message},
+	})
+	return result{Line: data, Failed: true}
+}
+
+// finalize writes the output and error files of a batch and sets its final
+// status. Requests without a result when the batch expired are reported in
+// the error file.
+func (s *Service) finalize(rec batchRecord, lines []requestLine) error {
+	status := StatusCompleted
+	switch {
+	case rec.CancellingAt != nil:
+		status = StatusCancelled
+	case rec.RequestCounts.Completed+rec.RequestCounts.Failed < rec.RequestCounts.Total:
+		status = StatusExpired
+	}
+
+	done := make(map[int]bool)
+	var outputs, failures []json.RawMessage
+	err := s.store.results(rec.ID, func(index int, res result) error {
+		done[index] = true
+		if res.Failed {
+			failures = append(failures, res.Line)
+		} else {
+			outputs = append(outputs, res.Line)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if status == StatusExpired {
+		for i, line := range lines {
+			if !done[i] {
+				failures = append(failures, failedLine(line, "batch_expired", "This request could not be executed before the completion window expired.").Line)
+			}
+		}
+	}
+
+	outputID, err := s.writeLines(rec, "output", outputs)
+	if err != nil {
+		return err
+	}
+	errorID, err := s.writeLines(rec, "error", failures)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.updateBatch(rec.ID, func(rec *batchRecord) {
+		t := now()
+		rec.Status = status
+		rec.OutputFileID, rec.ErrorFileID = outputID, errorID
+		switch status {
+		case StatusCompleted:
+			rec.CompletedAt = &t
+		case StatusCancelled:
+			rec.CancelledAt = &t
+		case StatusExpired:
+			rec.ExpiredAt = &t
+			rec.RequestCounts.Failed = rec.RequestCounts.Total - rec.RequestCounts.Completed
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return s.store.deleteResults(rec.ID)
+}
+
+// writeLines stores the JSONL file of a batch, returning nil if there are no
+// lines.
+func (s *Service) writeLines(rec batchRecord, kind string, lines []json.RawMessage) (*string, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	name := fmt.Sprintf("%s_%s.jsonl", rec.ID, kind)
+	file, err := s.writeFile(rec.Owner, name, PurposeBatchOutput, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		for _, line := range lines {
+			bw.Write(line)
+			bw.WriteByte('\n')
+		}
+		return bw.Flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file.ID, nil
+}
@@ -0,0 +1,242 @@
+package batch
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"llm-gateway/internal/config"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+var (
+	filesBucket   = []byte("files")
+	batchesBucket = []byte("batches")
+	// resultsBucket holds a nested bucket per running batch, mapping the
+	// index of every finished request line to its result.
+	resultsBucket = []byte("results")
+)
+
+// fileRecord is a stored file with the user who owns it.
+type fileRecord struct {
+	File
+	Owner string `json:"owner"`
+	// Path is the file's content on disk.
+	Path string `json:"path"`
+}
+
+// batchRecord is a stored batch with the user who created it. The user's
+// groups, and the models and rate limit of their API key, are kept so that its
+// requests are authorized and rate limited as that user.
+type batchRecord struct {
+	Batch
+	Owner     string                  `json:"owner"`
+	Groups    []string                `json:"groups"`
+	Models    []string                `json:"models,omitempty"`
+	RateLimit *config.RateLimitConfig `json:"rate_limit,omitempty"`
+}
+
+// result is the output line of one finished request.
+type result struct {
+	Line   json.RawMessage `json:"line"`
+	Failed bool            `json:"failed"`
+}
+
+// store persists files, batches and their progress in a bbolt database.
+type store struct {
+	db *bolt.DB
+}
+
+func openStore(path string) (*store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{filesBucket, batchesBucket, resultsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &store{db: db}, nil
+}
+
+func (s *store) close() error {
+	return s.db.Close()
+}
+
+// errMissing is returned by get when the key does not exist.
+var errMissing = errors.New("missing")
+
+func get(tx *bolt.Tx, bucket []byte, id string, v any) error {
+	data := tx.Bucket(bucket).Get([]byte(id))
+	if data == nil {
+		return errMissing
+	}
+	return json.Unmarshal(data, v)
+}
+
+func put(tx *bolt.Tx, bucket []byte, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put([]byte(id), data)
+}
+
+// list decodes every value of a bucket with decode.
+func list(tx *bolt.Tx, bucket []byte, decode func(data []byte) error) error {
+	return tx.Bucket(bucket).ForEach(func(_, data []byte) error {
+		return decode(data)
+	})
+}
+
+func (s *store) putFile(rec fileRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, filesBucket, rec.ID, rec)
+	})
+}
+
+// file returns a file, or errMissing.
+func (s *store) file(id string) (fileRecord, error) {
+	var rec fileRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return get(tx, filesBucket, id, &rec)
+	})
+	return rec, err
+}
+
+func (s *store) files() ([]fileRecord, error) {
+	var recs []fileRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return list(tx, filesBucket, func(data []byte) error {
+			var rec fileRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+			return nil
+		})
+	})
+	return recs, err
+}
+
+func (s *store) deleteFile(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(filesBucket).Delete([]byte(id))
+	})
+}
+
+func (s *store) putBatch(rec batchRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, batchesBucket, rec.ID, rec)
+	})
+}
+
+// batch returns a batch, or errMissing.
+func (s *store) batch(id string) (batchRecord, error) {
+	var rec batchRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return get(tx, batchesBucket, id, &rec)
+	})
+	return rec, err
+}
+
+func (s *store) batches() ([]batchRecord, error) {
+	var recs []batchRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return list(tx, batchesBucket, func(data []byte) error {
+			var rec batchRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+			return nil
+		})
+	})
+	return recs, err
+}
+
+// updateBatch applies update to a batch atomically and returns the result.
+func (s *store) updateBatch(id string, update func(rec *batchRecord)) (batchRecord, error) {
+	var rec batchRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := get(tx, batchesBucket, id, &rec); err != nil {
+			return err
+		}
+		update(&rec)
+		return put(tx, batchesBucket, id, rec)
+	})
+	return rec, err
+}
+
+func resultKey(index int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(index))
+}
+
+// addResult stores the result of a request line and counts it in the batch,
+// in a single transaction.
+func (s *store) addResult(id string, index int, res result) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		results, err := tx.Bucket(resultsBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		if results.Get(resultKey(index)) != nil {
+			return nil
+		}
+		data, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		if err := results.Put(resultKey(index), data); err != nil {
+			return err
+		}
+
+		var rec batchRecord
+		if err := get(tx, batchesBucket, id, &rec); err != nil {
+			return err
+		}
+		if res.Failed {
+			rec.RequestCounts.Failed++
+		} else {
+			rec.RequestCounts.Completed++
+		}
+		return put(tx, batchesBucket, id, rec)
+	})
+}
+
+// results calls fn for the stored results of a batch, in line order.
+func (s *store) results(id string, fn func(index int, res result) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		results := tx.Bucket(resultsBucket).Bucket([]byte(id))
+		if results == nil {
+			return nil
+		}
+		return results.ForEach(func(key, data []byte) error {
+			var res result
+			if err := json.Unmarshal(data, &res); err != nil {
+				return err
+			}
+			return fn(int(binary.BigEndian.Uint64(key)), res)
+		})
+	})
+}
+
+func (s *store) deleteResults(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(resultsBucket).DeleteBucket([]byte(id))
+		if errors.Is(err, berrors.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
@@ -1,7 +1,14 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,20 +19,153 @@ type Config struct {
 	Logging    Logging    `yaml:"logging"`
 	Auth       Auth       `yaml:"auth"`
 	RateLimit  RateLimit  `yaml:"ratelimit"`
+	Routing    Routing    `yaml:"routing"`
+	Embeddings Embeddings `yaml:"embeddings"`
+	Images     Images     `yaml:"images"`
+	Batches    Batches    `yaml:"batches"`
+	Jobs       Jobs       `yaml:"jobs"`
+	Admin      Admin      `yaml:"admin"`
 	Strategies []Strategy `yaml:"strategies"`
 	Providers  []Provider `yaml:"providers"`
 }
 
 type Auth struct {
-	Enabled  bool          `yaml:"enabled"`
+	Enabled bool `yaml:"enabled"`
+	// Issuer and Audience configure a single issuer with the default claims,
+	// in addition to those in Issuers.
 	Issuer   string        `yaml:"issuer"`
 	Audience string        `yaml:"audience"`
+	Issuers  []Issuer      `yaml:"issuers"`
+	// CacheTTL is how often the signing keys of the issuers are refreshed.
+	CacheTTL      time.Duration `yaml:"cache_ttl"`
+	Introspection Introspection `yaml:"introspection"`
+	APIKeys       APIKeys       `yaml:"api_keys"`
+}
+
+// Introspection configures the validation of opaque tokens, which are not
+// JWTs, at an RFC 7662 token introspection endpoint.
+type Introspection struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	// ClientID and ClientSecret authenticate the gateway at the endpoint.
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// Audiences, when set, are the accepted "aud" values of tokens.
+	Audiences []string `yaml:"audiences"`
+	// GroupsClaim, SubjectClaim and GroupPrefix map the introspection
+	// response to the user like the claims of an Issuer.
+	GroupsClaim  string `yaml:"groups_claim"`
+	SubjectClaim string `yaml:"subject_claim"`
+	GroupPrefix  string `yaml:"group_prefix"`
+	// CacheTTL is how long active tokens are cached, never beyond their
+	// "exp". Defaults to 5m.
 	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// NegativeCacheTTL is how long inactive tokens are cached. Defaults
+	// to 30s.
+	NegativeCacheTTL time.Duration `yaml:"negative_cache_ttl"`
+}
+
+// Issuer is an OIDC issuer whose tokens are accepted. Tokens are matched to
+// their issuer by the "iss" claim.
+type Issuer struct {
+	Issuer string `yaml:"issuer"`
+	// Audiences are the accepted "aud" values; tokens need at least one.
+	Audiences []string `yaml:"audiences"`
+	// GroupsClaim is the dotted path of the claim holding the user's
+	// groups, such as "realm_access.roles" or
+	// "resource_access.gateway.roles". Defaults to "groups".
+	GroupsClaim string `yaml:"groups_claim"`
+	// SubjectClaim is the claim identifying the user. Defaults to "sub".
+	SubjectClaim string `yaml:"subject_claim"`
+	// GroupPrefix is prepended to the groups of the issuer's users, keeping
+	// them apart from the same groups of other issuers.
+	GroupPrefix string `yaml:"group_prefix"`
+	// JWKSURL is where the signing keys are fetched from. Defaults to the
+	// jwks_uri of the issuer's OpenID configuration.
+	JWKSURL string `yaml:"jwks_url"`
+	// JWKSFile is a local JWKS holding the signing keys, used instead of
+	// fetching them, such as in air-gapped deployments.
+	JWKSFile string `yaml:"jwks_file"`
+}
+
+// OIDCIssuers returns all accepted issuers, including the one configured by
+// Issuer and Audience.
+func (a Auth) OIDCIssuers() []Issuer {
+	if a.Issuer == "" {
+		return a.Issuers
+	}
+	legacy := Issuer{Issuer: a.Issuer}
+	if a.Audience != "" {
+		legacy.Audiences = []string{a.Audience}
+	}
+	return append([]Issuer{legacy}, a.Issuers...)
+}
+
+func (a Auth) validate() error {
+	issuers := make(map[string]struct{})
+	for _, issuer := range a.OIDCIssuers() {
+		if issuer.Issuer == "" {
+			return fmt.Errorf("auth issuers require an issuer url")
+		}
+		if _, exists := issuers[issuer.Issuer]; exists {
+			return fmt.Errorf("auth issuer '%s' is configured more than once", issuer.Issuer)
+		}
+		issuers[issuer.Issuer] = struct{}{}
+		if len(issuer.Audiences) == 0 {
+			return fmt.Errorf("auth issuer '%s' requires an audience", issuer.Issuer)
+		}
+	}
+	if a.Introspection.Enabled && (a.Introspection.URL == "" || a.Introspection.ClientID == "" || a.Introspection.ClientSecret == "") {
+		return fmt.Errorf("token introspection requires a url, client_id and client_secret")
+	}
+	if a.Introspection.CacheTTL < 0 || a.Introspection.NegativeCacheTTL < 0 {
+		return fmt.Errorf("token introspection cache ttls must not be negative")
+	}
+	return a.APIKeys.validate()
+}
+
+// API key store backends.
+const (
+	KeyStoreMemory = "memory"
+	KeyStoreFile   = "file"
+	KeyStoreRedis  = "redis"
+)
+
+// APIKeys configures gateway-issued API keys, accepted alongside OIDC tokens.
+type APIKeys struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend is the key store: memory (default), file or redis.
+	Backend      string `yaml:"backend"`
+	File         string `yaml:"file"`
+	RedisAddress string `yaml:"redis_address"`
+	// Keys are added to the store on startup, replacing stored keys with
+	// the same ID.
+	Keys []APIKey `yaml:"keys"`
+}
+
+// APIKey is a key provisioned in the configuration. Only its hash is
+// configured, never the key itself.
+type APIKey struct {
+	ID string `yaml:"id"`
+	// Hash is the hex SHA-256 of the key, which starts with "sk-gw-".
+	Hash    string   `yaml:"hash"`
+	Subject string   `yaml:"subject"`
+	Groups  []string `yaml:"groups"`
+	// Models restricts the key to these models; path patterns such as
+	// "openai/*" are allowed.
+	Models []string `yaml:"models"`
+	// ExpiresAt is when the key stops working; never when zero.
+	ExpiresAt time.Time `yaml:"expires_at"`
+	// RateLimit replaces the group rate limits for requests with this key.
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
 }
 
 type Server struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+	// MaxUploadSize caps multipart request bodies, such as audio and image
+	// uploads, in bytes. Zero falls back to the default of the upload package.
+	MaxUploadSize int64 `yaml:"max_upload_size"`
 }
 
 type Logging struct {
@@ -46,24 +186,392 @@ type RateLimitConfig struct {
 	Window   time.Duration `yaml:"window"`
 }
 
+// Routing binds requested model names to strategies.
+type Routing struct {
+	// DefaultStrategy is used when no binding matches the requested model.
+	DefaultStrategy string         `yaml:"default_strategy"`
+	Models          []ModelBinding `yaml:"models"`
+	Aliases         []Alias        `yaml:"aliases"`
+}
+
+// Alias exposes a public model name that is resolved to concrete provider
+// models, so that clients do not depend on the provider layout.
+type Alias struct {
+	Name string `yaml:"name"`
+	// Targets are namespaced models (e.g. "openai/gpt-4") tried in order;
+	// each target must use a different provider.
+	Targets       []string `yaml:"targets"`
+	AllowedGroups []string `yaml:"allowed_groups"`
+}
+
+// ModelBinding maps a model name to a strategy. Model is either an exact
+// name (e.g. "openai/gpt-4") or a glob pattern (e.g. "openai/gpt-4*").
+type ModelBinding struct {
+	Model    string `yaml:"model"`
+	Strategy string `yaml:"strategy"`
+}
+
+// Embeddings configures the /v1/embeddings endpoint.
+type Embeddings struct {
+	Batching EmbeddingBatching `yaml:"batching"`
+}
+
+// EmbeddingBatching coalesces embedding requests for the same model into a
+// single upstream request. Zero values fall back to the defaults of the batcher.
+type EmbeddingBatching struct {
+	Enabled bool `yaml:"enabled"`
+	// Window is how long the first request of a batch waits for others to
+	// join it.
+	Window time.Duration `yaml:"window"`
+	// MaxInputs caps the number of inputs sent upstream in one batch. A full
+	// batch is sent right away.
+	MaxInputs int `yaml:"max_inputs"`
+}
+
+// Batches configures the gateway's own implementation of /v1/files and
+// /v1/batches. Zero values fall back to the defaults of the batch service.
+type Batches struct {
+	Enabled bool `yaml:"enabled"`
+	// Dir holds the uploaded and generated files and the job database.
+	Dir string `yaml:"dir"`
+	// Concurrency caps the batch requests in flight across all batches.
+	Concurrency int `yaml:"concurrency"`
+	// YieldAbove pauses batch requests while at least this many client
+	// requests are in flight. Disabled when zero.
+	YieldAbove int `yaml:"yield_above"`
+	// MaxFileSize caps uploaded files, in bytes.
+	MaxFileSize int64 `yaml:"max_file_size"`
+}
+
+// Jobs configures asynchronous requests, sent with "Prefer: respond-async"
+// and polled at /v1/jobs/{id}. Zero values fall back to the defaults of the
+// job service.
+type Jobs struct {
+	Enabled bool `yaml:"enabled"`
+	// Dir holds the job database.
+	Dir string `yaml:"dir"`
+	// Concurrency caps the asynchronous requests in flight.
+	Concurrency int `yaml:"concurrency"`
+	// Retention is how long finished jobs and their results are kept.
+	Retention time.Duration `yaml:"retention"`
+	// MaxRequestSize caps the body of an asynchronous request, in bytes.
+	MaxRequestSize int64    `yaml:"max_request_size"`
+	Webhooks       Webhooks `yaml:"webhooks"`
+}
+
+// Webhooks configures the callbacks sent when a job finishes.
+type Webhooks struct {
+	// AllowedHosts lists the hosts callbacks may be sent to. Callbacks are
+	// rejected when it is empty.
+	AllowedHosts []string `yaml:"allowed_hosts"`
+	// Secret signs callbacks with HMAC-SHA256; they are unsigned when empty.
+	Secret  string        `yaml:"secret"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Admin configures the admin API, served on its own listener to users of an
+// admin group.
+type Admin struct {
+	Enabled bool `yaml:"enabled"`
+	// Listen is the address of the admin listener, e.g. "127.0.0.1:9090".
+	Listen string `yaml:"listen"`
+	// Group is the group users need to call the admin API.
+	Group string `yaml:"group"`
+	// StateFile persists the changes made through the admin API. Once it
+	// exists, its providers, strategies and rate limit groups replace those
+	// of the configuration file on startup.
+	StateFile string `yaml:"state_file"`
+}
+
+// Image response formats, as in the response_format request field.
+const (
+	ImageFormatURL     = "url"
+	ImageFormatB64JSON = "b64_json"
+)
+
+// Images configures /v1/images/generations and /v1/images/edits.
+type Images struct {
+	// ResponseFormat converts every image response to "url" or "b64_json".
+	// When empty, responses are converted to the format the client asked for.
+	ResponseFormat string       `yaml:"response_format"`
+	Storage        ImageStorage `yaml:"storage"`
+	// Default limits apply to every request; a user's group limits further
+	// restrict them.
+	Default ImageLimits            `yaml:"default"`
+	Groups  map[string]ImageLimits `yaml:"groups"`
+}
+
+// ImageStorage is where images converted from b64_json to url are kept and
+// served from. Without a directory, b64_json responses are left as they are.
+type ImageStorage struct {
+	Dir string `yaml:"dir"`
+	// BaseURL is the gateway's public URL, used to build image URLs.
+	BaseURL string `yaml:"base_url"`
+	// Retention is how long stored images are served (default 1h).
+	Retention time.Duration `yaml:"retention"`
+}
+
+// ImageLimits restricts image requests. Zero values mean no limit.
+type ImageLimits struct {
+	// MaxImages caps the number of images (n) per request.
+	MaxImages int `yaml:"max_images"`
+	// MaxSize caps the width and height of requested images, e.g. "1024x1024".
+	MaxSize string `yaml:"max_size"`
+}
+
+func (l ImageLimits) validate(name string) error {
+	if l.MaxImages < 0 {
+		return fmt.Errorf("image limits '%s' have a negative max_images", name)
+	}
+	if _, _, ok := ParseImageSize(l.MaxSize); l.MaxSize != "" && !ok {
+		return fmt.Errorf("image limits '%s' have an invalid max_size '%s'", name, l.MaxSize)
+	}
+	return nil
+}
+
+// ParseImageSize parses an image size such as "1024x1792".
+func ParseImageSize(size string) (width, height int, ok bool) {
+	w, h, found := strings.Cut(size, "x")
+	if !found {
+		return 0, 0, false
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// Strategy modes control the order in which a strategy's providers are tried.
+// Whatever the mode, the remaining providers are used as fallbacks.
+const (
+	// StrategyModeFallback tries providers in the configured order.
+	StrategyModeFallback = "fallback"
+	// StrategyModeWeighted picks providers at random in proportion to their weight.
+	StrategyModeWeighted = "weighted"
+	// StrategyModeRoundRobin rotates the first provider on every request.
+	StrategyModeRoundRobin = "round_robin"
+	// StrategyModeLeastOutstanding prefers the provider with the fewest in-flight requests.
+	StrategyModeLeastOutstanding = "least_outstanding"
+	// StrategyModeLatency prefers the provider with the lowest observed latency.
+	StrategyModeLatency = "latency"
+)
+
+// Latency metrics a latency strategy can rank providers by.
+const (
+	// LatencyMetricTTFB ranks by time to first byte, which suits streaming clients.
+	LatencyMetricTTFB = "ttfb"
+	// LatencyMetricTotal ranks by total request duration.
+	LatencyMetricTotal = "total"
+)
+
 type Strategy struct {
 	Name      string   `yaml:"name"`
 	Providers []string `yaml:"providers"`
+	// Mode is one of the StrategyMode constants. Defaults to fallback.
+	Mode string `yaml:"mode"`
+	// Weights maps provider names to their relative weight in weighted mode.
+	// Providers without a weight default to 1; a weight of 0 only receives
+	// traffic as a fallback.
+	Weights map[string]int `yaml:"weights"`
+	// LatencyMetric is the metric a latency strategy ranks providers by.
+	// Defaults to ttfb.
+	LatencyMetric string `yaml:"latency_metric"`
+	// Exploration is the share of requests (0-1) a latency strategy sends
+	// to a provider other than the fastest one, so that its estimate stays
+	// fresh. Defaults to 0.1.
+	Exploration *float64 `yaml:"exploration"`
+	// RetryOn lists upstream status codes that make the proxy fall back to
+	// the next provider. Defaults to 429 and 5xx gateway errors when empty.
+	RetryOn []int `yaml:"retry_on"`
 }
 
+// Provider types select the API dialect a provider speaks.
+const (
+	// ProviderTypeOpenAI is an OpenAI-compatible API; requests are passed through.
+	ProviderTypeOpenAI = "openai"
+	// ProviderTypeAnthropic is the Anthropic Messages API.
+	ProviderTypeAnthropic = "anthropic"
+	// ProviderTypeGemini is the Google Gemini API.
+	ProviderTypeGemini = "gemini"
+	// ProviderTypeAzureOpenAI is Azure OpenAI with deployment-based URLs.
+	ProviderTypeAzureOpenAI = "azure_openai"
+	// ProviderTypeOllama is the native Ollama API.
+	ProviderTypeOllama = "ollama"
+	// ProviderTypeBedrock is the AWS Bedrock Converse API.
+	ProviderTypeBedrock = "bedrock"
+)
+
+// Auth modes select how requests to a provider are authenticated.
+const (
+	// AuthModeAPIKey sends APIKey in the header expected by the provider type.
+	AuthModeAPIKey = "api_key"
+	// AuthModeSigV4 signs every request with AWS Signature Version 4.
+	AuthModeSigV4 = "sigv4"
+)
+
 type Provider struct {
-	Name       string        `yaml:"name"`
-	Enabled    bool          `yaml:"enabled"`
+	Name    string `yaml:"name"`
+	Enabled bool   `yaml:"enabled"`
+	// Type is one of the ProviderType constants. Defaults to openai.
+	Type       string        `yaml:"type"`
 	TargetURL  string        `yaml:"target_url"`
 	APIKey     string        `yaml:"api_key"`
 	Timeout    time.Duration `yaml:"timeout"`
 	MaxRetries int           `yaml:"max_retries"`
-	Models     []Model       `yaml:"models"`
+	// RetryBackoff is the base delay before the first retry; it doubles on
+	// every subsequent retry up to MaxRetryBackoff.
+	RetryBackoff    time.Duration  `yaml:"retry_backoff"`
+	MaxRetryBackoff time.Duration  `yaml:"max_retry_backoff"`
+	CircuitBreaker  CircuitBreaker `yaml:"circuit_breaker"`
+	HealthCheck     HealthCheck    `yaml:"health_check"`
+	Anthropic       Anthropic      `yaml:"anthropic"`
+	Gemini          Gemini         `yaml:"gemini"`
+	AzureOpenAI     AzureOpenAI    `yaml:"azure_openai"`
+	Ollama          Ollama         `yaml:"ollama"`
+	Bedrock         Bedrock        `yaml:"bedrock"`
+	Auth            ProviderAuth   `yaml:"auth"`
+	Models          []Model        `yaml:"models"`
+}
+
+// Anthropic holds the settings of an anthropic provider.
+type Anthropic struct {
+	// Version is sent as the anthropic-version header. Defaults to 2023-06-01.
+	Version string `yaml:"version"`
+	// MaxTokens is used when a request does not set max_tokens, which the
+	// Messages API requires. Defaults to 4096.
+	MaxTokens int `yaml:"max_tokens"`
+}
+
+// Gemini holds the settings of a gemini provider.
+type Gemini struct {
+	// APIVersion is the path prefix of the API. Defaults to v1beta.
+	APIVersion string `yaml:"api_version"`
+	// SafetySettings are sent with every request.
+	SafetySettings []SafetySetting `yaml:"safety_settings"`
 }
 
+// SafetySetting sets the blocking threshold of a Gemini harm category, e.g.
+// HARM_CATEGORY_HARASSMENT and BLOCK_ONLY_HIGH.
+type SafetySetting struct {
+	Category  string `yaml:"category"`
+	Threshold string `yaml:"threshold"`
+}
+
+// AzureOpenAI holds the settings of an azure_openai provider.
+type AzureOpenAI struct {
+	// APIVersion is sent as the api-version query parameter. Defaults to 2024-10-21.
+	APIVersion string `yaml:"api_version"`
+	// Deployments maps model names to deployment names. Models without an
+	// entry are assumed to be deployed under their own name.
+	Deployments map[string]string `yaml:"deployments"`
+}
+
+// Ollama holds the settings of an ollama provider. Requests may override
+// both with their own keep_alive and options fields.
+type Ollama struct {
+	// KeepAlive is how long the model stays loaded, e.g. "10m" or "-1".
+	KeepAlive string `yaml:"keep_alive"`
+	// Options are default model options such as num_ctx.
+	Options map[string]any `yaml:"options"`
+}
+
+// Bedrock holds the settings of a bedrock provider.
+type Bedrock struct {
+	// ModelsURL is the control plane endpoint listing foundation models.
+	// Defaults to the target URL with bedrock-runtime replaced by bedrock.
+	ModelsURL string `yaml:"models_url"`
+}
+
+// ProviderAuth configures how requests to a provider are authenticated.
+type ProviderAuth struct {
+	// Mode is one of the AuthMode constants. Defaults to api_key.
+	Mode  string `yaml:"mode"`
+	SigV4 SigV4  `yaml:"sigv4"`
+}
+
+// SigV4 holds the signing settings of the sigv4 auth mode. Credentials left
+// empty are read from CredentialsFile or, without one, from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables.
+type SigV4 struct {
+	Region          string `yaml:"region"`
+	Service         string `yaml:"service"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+	// CredentialsFile is a shared credentials file in the format of
+	// ~/.aws/credentials. It is re-read whenever it changes.
+	CredentialsFile string `yaml:"credentials_file"`
+	// Profile selects the section of CredentialsFile. Defaults to "default".
+	Profile string `yaml:"profile"`
+}
+
+// HealthCheck configures active probing of a provider. Zero values fall back
+// to the defaults of the health checker.
+type HealthCheck struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+	// Path is requested from the target URL. Defaults to the model list of
+	// the provider's type.
+	Path           string        `yaml:"path"`
+	ExpectedStatus int           `yaml:"expected_status"`
+	Timeout        time.Duration `yaml:"timeout"`
+	// UnhealthyThreshold is the number of consecutive failed probes before
+	// the provider is marked unhealthy.
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+	// HealthyThreshold is the number of consecutive successful probes before
+	// an unhealthy provider is marked healthy again.
+	HealthyThreshold int `yaml:"healthy_threshold"`
+}
+
+// CircuitBreaker configures when a failing provider is taken out of rotation.
+// Zero values fall back to the defaults of the provider manager.
+type CircuitBreaker struct {
+	Enabled bool `yaml:"enabled"`
+	// FailureThreshold opens the circuit after this many consecutive failures.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// ErrorRateThreshold opens the circuit when the share of failures among the
+	// last WindowSize requests reaches it (0-1). Disabled when zero.
+	ErrorRateThreshold float64 `yaml:"error_rate_threshold"`
+	WindowSize         int     `yaml:"window_size"`
+	// MinRequests is the number of requests in the window before the error rate is considered.
+	MinRequests int `yaml:"min_requests"`
+	// OpenDuration is how long the circuit stays open before a probe is let through.
+	OpenDuration time.Duration `yaml:"open_duration"`
+	// HalfOpenRequests is the number of concurrent probes allowed while half-open.
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// Endpoint types name the API endpoints a model can serve.
+const (
+	// EndpointChat is /v1/chat/completions, and /v1/messages.
+	EndpointChat = "chat"
+	// EndpointCompletions is the legacy /v1/completions.
+	EndpointCompletions = "completions"
+	// EndpointEmbeddings is /v1/embeddings.
+	EndpointEmbeddings = "embeddings"
+	// EndpointModerations is /v1/moderations.
+	EndpointModerations = "moderations"
+	// EndpointRerank is /v1/rerank.
+	EndpointRerank = "rerank"
+	// EndpointTranscriptions is /v1/audio/transcriptions.
+	EndpointTranscriptions = "transcriptions"
+	// EndpointSpeech is /v1/audio/speech.
+	EndpointSpeech = "speech"
+	// EndpointImages is /v1/images/generations and /v1/images/edits.
+	EndpointImages = "images"
+)
+
+// Endpoints lists every endpoint type.
+var Endpoints = []string{EndpointChat, EndpointCompletions, EndpointEmbeddings, EndpointModerations, EndpointRerank, EndpointTranscriptions, EndpointSpeech, EndpointImages}
+
 type Model struct {
 	Name          string   `yaml:"name"`
 	AllowedGroups []string `yaml:"allowed_groups"`
+	// Endpoints are the endpoint types the model supports. When empty they
+	// are inferred from the model name.
+	Endpoints []string `yaml:"endpoints"`
 }
 
 // Load reads the configuration file from the given path, parses it, and returns a Config struct.
@@ -81,5 +589,229 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
-}
\ No newline at end of file
+}
+
+// Validate checks that strategies and model bindings only reference
+// providers and strategies that are defined in the configuration.
+func (c *Config) Validate() error {
+	providers := make(map[string]struct{}, len(c.Providers))
+	for _, p := range c.Providers {
+		if _, exists := providers[p.Name]; exists {
+			return fmt.Errorf("provider '%s' is defined more than once", p.Name)
+		}
+		providers[p.Name] = struct{}{}
+
+		switch p.Type {
+		case "", ProviderTypeOpenAI, ProviderTypeAnthropic, ProviderTypeGemini, ProviderTypeAzureOpenAI, ProviderTypeOllama, ProviderTypeBedrock:
+		default:
+			return fmt.Errorf("provider '%s' has unknown type '%s'", p.Name, p.Type)
+		}
+
+		switch p.Auth.Mode {
+		case "", AuthModeAPIKey:
+		case AuthModeSigV4:
+			if p.Auth.SigV4.Region == "" || p.Auth.SigV4.Service == "" {
+				return fmt.Errorf("provider '%s' uses sigv4 auth without a region and service", p.Name)
+			}
+		default:
+			return fmt.Errorf("provider '%s' has unknown auth mode '%s'", p.Name, p.Auth.Mode)
+		}
+
+		for _, m := range p.Models {
+			for _, endpoint := range m.Endpoints {
+				if !slices.Contains(Endpoints, endpoint) {
+					return fmt.Errorf("model '%s' has unknown endpoint type '%s'", m.Name, endpoint)
+				}
+			}
+		}
+	}
+
+	if c.Server.MaxUploadSize < 0 {
+		return fmt.Errorf("server max_upload_size must not be negative")
+	}
+
+	if c.Embeddings.Batching.Window < 0 || c.Embeddings.Batching.MaxInputs < 0 {
+		return fmt.Errorf("embedding batching window and max_inputs must not be negative")
+	}
+
+	switch c.Images.ResponseFormat {
+	case "", ImageFormatURL, ImageFormatB64JSON:
+	default:
+		return fmt.Errorf("unknown image response format '%s'", c.Images.ResponseFormat)
+	}
+	if c.Images.ResponseFormat == ImageFormatURL && c.Images.Storage.Dir == "" {
+		return fmt.Errorf("image response format 'url' requires a storage dir")
+	}
+	if err := c.Images.Default.validate("default"); err != nil {
+		return err
+	}
+	for group, limits := range c.Images.Groups {
+		if err := limits.validate(group); err != nil {
+			return err
+		}
+	}
+
+	if c.Batches.Enabled && c.Batches.Dir == "" {
+		return fmt.Errorf("batches require a dir")
+	}
+	if c.Batches.Concurrency < 0 || c.Batches.YieldAbove < 0 || c.Batches.MaxFileSize < 0 {
+		return fmt.Errorf("batch concurrency, yield_above and max_file_size must not be negative")
+	}
+
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+
+	if c.Admin.Enabled {
+		if c.Admin.Listen == "" || c.Admin.Group == "" || c.Admin.StateFile == "" {
+			return fmt.Errorf("the admin API requires listen, group and state_file")
+		}
+		if !c.Auth.Enabled {
+			return fmt.Errorf("the admin API requires auth to be enabled")
+		}
+	}
+
+	if c.Jobs.Enabled && c.Jobs.Dir == "" {
+		return fmt.Errorf("jobs require a dir")
+	}
+	if c.Jobs.Concurrency < 0 || c.Jobs.Retention < 0 || c.Jobs.MaxRequestSize < 0 || c.Jobs.Webhooks.Timeout < 0 {
+		return fmt.Errorf("job concurrency, retention, max_request_size and webhook timeout must not be negative")
+	}
+
+	strategies := make(map[string]struct{}, len(c.Strategies))
+	for _, s := range c.Strategies {
+		if s.Name == "" {
+			return fmt.Errorf("strategy name must not be empty")
+		}
+		if _, exists := strategies[s.Name]; exists {
+			return fmt.Errorf("strategy '%s' is defined more than once", s.Name)
+		}
+		strategies[s.Name] = struct{}{}
+
+		if len(s.Providers) == 0 {
+			return fmt.Errorf("strategy '%s' has no providers", s.Name)
+		}
+		members := make(map[string]struct{}, len(s.Providers))
+		for _, name := range s.Providers {
+			if _, ok := providers[name]; !ok {
+				return fmt.Errorf("strategy '%s' references unknown provider '%s'", s.Name, name)
+			}
+			members[name] = struct{}{}
+		}
+
+		switch s.Mode {
+		case "", StrategyModeFallback, StrategyModeWeighted, StrategyModeRoundRobin, StrategyModeLeastOutstanding, StrategyModeLatency:
+		default:
+			return fmt.Errorf("strategy '%s' has unknown mode '%s'", s.Name, s.Mode)
+		}
+		switch s.LatencyMetric {
+		case "", LatencyMetricTTFB, LatencyMetricTotal:
+		default:
+			return fmt.Errorf("strategy '%s' has unknown latency metric '%s'", s.Name, s.LatencyMetric)
+		}
+		if s.Exploration != nil && (*s.Exploration < 0 || *s.Exploration > 1) {
+			return fmt.Errorf("strategy '%s' has an exploration rate outside [0, 1]", s.Name)
+		}
+		for name, weight := range s.Weights {
+			if _, ok := members[name]; !ok {
+				return fmt.Errorf("strategy '%s' has a weight for provider '%s' which is not part of it", s.Name, name)
+			}
+			if weight < 0 {
+				return fmt.Errorf("strategy '%s' has a negative weight for provider '%s'", s.Name, name)
+			}
+		}
+	}
+
+	if c.Routing.DefaultStrategy != "" {
+		if _, ok := strategies[c.Routing.DefaultStrategy]; !ok {
+			return fmt.Errorf("default strategy '%s' is not defined", c.Routing.DefaultStrategy)
+		}
+	}
+
+	aliases := make(map[string]struct{}, len(c.Routing.Aliases))
+	for _, a := range c.Routing.Aliases {
+		if a.Name == "" {
+			return fmt.Errorf("alias name must not be empty")
+		}
+		if _, exists := aliases[a.Name]; exists {
+			return fmt.Errorf("alias '%s' is defined more than once", a.Name)
+		}
+		aliases[a.Name] = struct{}{}
+
+		if len(a.Targets) == 0 {
+			return fmt.Errorf("alias '%s' has no targets", a.Name)
+		}
+		targetProviders := make(map[string]struct{}, len(a.Targets))
+		for _, target := range a.Targets {
+			providerName, model, ok := strings.Cut(target, "/")
+			if !ok || model == "" {
+				return fmt.Errorf("alias '%s' target '%s' must be in the form 'provider/model'", a.Name, target)
+			}
+			if _, ok := providers[providerName]; !ok {
+				return fmt.Errorf("alias '%s' references unknown provider '%s'", a.Name, providerName)
+			}
+			if _, exists := targetProviders[providerName]; exists {
+				return fmt.Errorf("alias '%s' has more than one target for provider '%s'", a.Name, providerName)
+			}
+			targetProviders[providerName] = struct{}{}
+		}
+	}
+
+	bindings := make(map[string]struct{}, len(c.Routing.Models))
+	for _, b := range c.Routing.Models {
+		if b.Model == "" {
+			return fmt.Errorf("model binding for strategy '%s' has an empty model", b.Strategy)
+		}
+		if _, exists := bindings[b.Model]; exists {
+			return fmt.Errorf("model binding '%s' is defined more than once", b.Model)
+		}
+		bindings[b.Model] = struct{}{}
+		if _, err := path.Match(b.Model, ""); err != nil {
+			return fmt.Errorf("model binding '%s' is not a valid pattern: %w", b.Model, err)
+		}
+		if _, ok := strategies[b.Strategy]; !ok {
+			return fmt.Errorf("model binding '%s' references unknown strategy '%s'", b.Model, b.Strategy)
+		}
+	}
+
+	return nil
+}
+
+func (k APIKeys) validate() error {
+	switch k.Backend {
+	case "", KeyStoreMemory:
+	case KeyStoreFile:
+		if k.Enabled && k.File == "" {
+			return fmt.Errorf("the file api key store requires a file")
+		}
+	case KeyStoreRedis:
+		if k.Enabled && k.RedisAddress == "" {
+			return fmt.Errorf("the redis api key store requires a redis_address")
+		}
+	default:
+		return fmt.Errorf("unknown api key store '%s'", k.Backend)
+	}
+
+	ids := make(map[string]struct{}, len(k.Keys))
+	for _, key := range k.Keys {
+		if key.ID == "" || key.Subject == "" {
+			return fmt.Errorf("api keys require an id and a subject")
+		}
+		if _, exists := ids[key.ID]; exists {
+			return fmt.Errorf("api key '%s' is defined more than once", key.ID)
+		}
+		ids[key.ID] = struct{}{}
+		if decoded, err := hex.DecodeString(key.Hash); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("api key '%s' must have a hex SHA-256 hash", key.ID)
+		}
+		if key.RateLimit != nil && (key.RateLimit.Requests <= 0 || key.RateLimit.Window <= 0) {
+			return fmt.Errorf("the rate limit of api key '%s' requires requests and a window", key.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	return Config{
+		Providers: []Provider{
+			{Name: "openai", Enabled: true},
+			{Name: "vllm", Enabled: true},
+		},
+		Strategies: []Strategy{
+			{Name: "main", Providers: []string{"openai", "vllm"}},
+		},
+		Routing: Routing{
+			DefaultStrategy: "main",
+			Models:          []ModelBinding{{Model: "openai/gpt-4*", Strategy: "main"}},
+			Aliases: []Alias{
+				{Name: "chat-default", Targets: []string{"openai/gpt-4", "vllm/llama-3-70b"}},
+			},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			mutate: func(c *Config) {},
+		},
+		{
+			name:    "unknown provider in strategy",
+			mutate:  func(c *Config) { c.Strategies[0].Providers = append(c.Strategies[0].Providers, "gemini") },
+			wantErr: "unknown provider 'gemini'",
+		},
+		{
+			name:    "unknown provider type",
+			mutate:  func(c *Config) { c.Providers[0].Type = "cohere" },
+			wantErr: "unknown type 'cohere'",
+		},
+		{
+			name:    "unknown auth mode",
+			mutate:  func(c *Config) { c.Providers[0].Auth.Mode = "oauth" },
+			wantErr: "unknown auth mode 'oauth'",
+		},
+		{
+			name: "sigv4 without region",
+			mutate: func(c *Config) {
+				c.Providers[0].Auth = ProviderAuth{Mode: AuthModeSigV4, SigV4: SigV4{Service: "bedrock"}}
+			},
+			wantErr: "without a region and service",
+		},
+		{
+			name: "unknown model endpoint",
+			mutate: func(c *Config) {
+				c.Providers[0].Models = []Model{{Name: "openai/gpt-4", Endpoints: []string{"video"}}}
+			},
+			wantErr: "unknown endpoint type 'video'",
+		},
+		{
+			name:    "negative embedding batch size",
+			mutate:  func(c *Config) { c.Embeddings.Batching.MaxInputs = -1 },
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "url image format without storage",
+			mutate:  func(c *Config) { c.Images.ResponseFormat = ImageFormatURL },
+			wantErr: "requires a storage dir",
+		},
+		{
+			name:    "batches without dir",
+			mutate:  func(c *Config) { c.Batches.Enabled = true },
+			wantErr: "batches require a dir",
+		},
+		{
+			name: "issuer without audience",
+			mutate: func(c *Config) {
+				c.Auth.Issuers = []Issuer{{Issuer: "https://sso.example.com/realms/partners"}}
+			},
+			wantErr: "auth issuer 'https://sso.example.com/realms/partners' requires an audience",
+		},
+		{
+			name: "duplicate issuer",
+			mutate: func(c *Config) {
+				c.Auth.Issuer, c.Auth.Audience = "https://sso.example.com/realms/staff", "gateway"
+				c.Auth.Issuers = []Issuer{{Issuer: "https://sso.example.com/realms/staff", Audiences: []string{"gateway"}}}
+			},
+			wantErr: "is configured more than once",
+		},
+		{
+			name: "introspection without client credentials",
+			mutate: func(c *Config) {
+				c.Auth.Introspection = Introspection{Enabled: true, URL: "https://sso.example.com/introspect"}
+			},
+			wantErr: "token introspection requires a url, client_id and client_secret",
+		},
+		{
+			name:    "unknown api key store",
+			mutate:  func(c *Config) { c.Auth.APIKeys.Backend = "vault" },
+			wantErr: "unknown api key store 'vault'",
+		},
+		{
+			name: "api key without hash",
+			mutate: func(c *Config) {
+				c.Auth.APIKeys.Keys = []APIKey{{ID: "ci", Subject: "ci-bot", Hash: "sk-gw-plaintext"}}
+			},
+			wantErr: "must have a hex SHA-256 hash",
+		},
+		{
+			name: "duplicate api key",
+			mutate: func(c *Config) {
+				key := APIKey{ID: "ci", Subject: "ci-bot", Hash: strings.Repeat("ab", 32)}
+				c.Auth.APIKeys.Keys = []APIKey{key, key}
+			},
+			wantErr: "api key 'ci' is defined more than once",
+		},
+		{
+			name: "admin API without auth",
+			mutate: func(c *Config) {
+				c.Admin = Admin{Enabled: true, Listen: ":9090", Group: "admins", StateFile: "state.yaml"}
+			},
+			wantErr: "the admin API requires auth to be enabled",
+		},
+		{
+			name:    "jobs without dir",
+			mutate:  func(c *Config) { c.Jobs.Enabled = true },
+			wantErr: "jobs require a dir",
+		},
+		{
+			name:    "negative job retention",
+			mutate:  func(c *Config) { c.Jobs.Retention = -time.Hour },
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "invalid image size limit",
+			mutate:  func(c *Config) { c.Images.Groups = map[string]ImageLimits{"free": {MaxSize: "large"}} },
+			wantErr: "invalid max_size 'large'",
+		},
+		{
+			name:    "unknown default strategy",
+			mutate:  func(c *Config) { c.Routing.DefaultStrategy = "missing" },
+			wantErr: "default strategy 'missing'",
+		},
+		{
+			name:    "unknown strategy in binding",
+			mutate:  func(c *Config) { c.Routing.Models[0].Strategy = "missing" },
+			wantErr: "unknown strategy 'missing'",
+		},
+		{
+			name:    "invalid pattern",
+			mutate:  func(c *Config) { c.Routing.Models[0].Model = "openai/[gpt" },
+			wantErr: "not a valid pattern",
+		},
+		{
+			name: "duplicate binding",
+			mutate: func(c *Config) {
+				c.Routing.Models = append(c.Routing.Models, ModelBinding{Model: "openai/gpt-4*", Strategy: "main"})
+			},
+			wantErr: "model binding 'openai/gpt-4*' is defined more than once",
+		},
+		{
+			name:    "duplicate provider",
+			mutate:  func(c *Config) { c.Providers = append(c.Providers, c.Providers[0]) },
+			wantErr: "provider 'openai' is defined more than once",
+		},
+		{
+			name:    "unknown mode",
+			mutate:  func(c *Config) { c.Strategies[0].Mode = "random" },
+			wantErr: "unknown mode 'random'",
+		},
+		{
+			name: "weight for provider outside strategy",
+			mutate: func(c *Config) {
+				c.Strategies[0].Mode = StrategyModeWeighted
+				c.Strategies[0].Weights = map[string]int{"gemini": 1}
+			},
+			wantErr: "not part of it",
+		},
+		{
+			name:    "alias with unknown provider",
+			mutate:  func(c *Config) { c.Routing.Aliases[0].Targets[1] = "gemini/gemini-pro" },
+			wantErr: "unknown provider 'gemini'",
+		},
+		{
+			name:    "alias target without namespace",
+			mutate:  func(c *Config) { c.Routing.Aliases[0].Targets[0] = "gpt-4" },
+			wantErr: "must be in the form 'provider/model'",
+		},
+		{
+			name:    "alias with two targets on one provider",
+			mutate:  func(c *Config) { c.Routing.Aliases[0].Targets[1] = "openai/gpt-4o" },
+			wantErr: "more than one target for provider 'openai'",
+		},
+		{
+			name: "duplicate strategy",
+			mutate: func(c *Config) {
+				c.Strategies = append(c.Strategies, Strategy{Name: "main", Providers: []string{"vllm"}})
+			},
+			wantErr: "defined more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.mutate(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() returned unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Package adapter translates between the gateway's OpenAI-compatible API and
+// the native APIs of the downstream provider types.
+package adapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+)
+
+// ErrUnsupportedEndpoint is returned by NewRequest when a provider type has
+// no equivalent for the requested gateway endpoint.
+var ErrUnsupportedEndpoint = errors.New("endpoint is not supported by this provider type")
+
+// Request is an outbound request to a provider, already translated into its
+// native format.
+type Request struct {
+	Method string
+	URL    *url.URL
+	// Header holds the headers to set on the outbound request, including
+	// the provider's credentials.
+	Header http.Header
+	Body   []byte
+	// BodyReader, if set, replaces Body for bodies that are not held in
+	// memory, such as file uploads. It is called once per attempt and
+	// returns the body and its length.
+	BodyReader func() (io.Reader, int64)
+	// Model is the provider model the request is for.
+	Model string
+	// Stream reports whether the client asked for a streaming response.
+	Stream bool
+}
+
+// Model is a model listed by a provider.
+type Model struct {
+	ID      string
+	Created int64
+	OwnedBy string
+	// Endpoints are the endpoint types the provider reports for the model,
+	// or nil when its model list does not tell.
+	Endpoints []string
+}
+
+// Adapter translates requests and responses for one provider.
+type Adapter interface {
+	// NewRequest translates an OpenAI-compatible request received on the
+	// given gateway path into the provider's native request.
+	NewRequest(path string, query url.Values, body []byte) (*Request, error)
+	// ModifyResponse translates a provider response to a request built by
+	// NewRequest back into the OpenAI-compatible format, in place. Error
+	// responses are passed through unchanged.
+	ModifyResponse(resp *http.Response, req *Request) error
+	// Authenticate adds the provider's credentials to the given headers.
+	Authenticate(header http.Header)
+	// ModelsRequest builds the request listing the provider's models.
+	ModelsRequest(ctx context.Context) (*http.Request, error)
+	// ParseModels extracts the models from a successful models response.
+	ParseModels(body []byte) ([]Model, error)
+	// Endpoints lists the endpoint types NewRequest can translate.
+	Endpoints() []string
+}
+
+// New returns the adapter for the provider's type.
+func New(p config.Provider) Adapter {
+	switch p.Type {
+	case config.ProviderTypeAnthropic:
+		return newAnthropic(p)
+	case config.ProviderTypeGemini:
+		return newGemini(p)
+	case config.ProviderTypeAzureOpenAI:
+		return newAzureOpenAI(p)
+	case config.ProviderTypeOllama:
+		return newOllama(p)
+	case config.ProviderTypeBedrock:
+		return newBedrock(p)
+	default:
+		return newOpenAI(p)
+	}
+}
+
+// joinURL resolves a path against the provider's target URL, keeping any
+// path prefix of the target.
+func joinURL(targetURL, path string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" {
+		// JoinPath keeps a relative path when the target has none.
+		u.Path = "/"
+	}
+	u = u.JoinPath(path)
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// isSuccess reports whether the response carries a result to translate.
+func isSuccess(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
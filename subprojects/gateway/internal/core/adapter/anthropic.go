@@ -0,0 +1,461 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnthropicVersion   = "2023-06-01"
+	defaultAnthropicMaxTokens = 4096
+)
+
+// anthropic is the adapter for the Anthropic Messages API.
+type anthropic struct {
+	cfg config.Provider
+}
+
+func newAnthropic(p config.Provider) *anthropic {
+	if p.Anthropic.Version == "" {
+		p.Anthropic.Version = defaultAnthropicVersion
+	}
+	if p.Anthropic.MaxTokens <= 0 {
+		p.Anthropic.MaxTokens = defaultAnthropicMaxTokens
+	}
+	return &anthropic{cfg: p}
+}
+
+// anthropicRequest is a Messages API request.
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolUse  `json:"tool_choice,omitempty"`
+	Metadata      *anthropicMetadata `json:"metadata,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of any type; only the fields of its type are set.
+type anthropicBlock struct {
+	Type string `json:"type"`
+	// text
+	Text string `json:"text,omitempty"`
+	// image
+	Source *anthropicImageSource `json:"source,omitempty"`
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolUse struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+// anthropicResponse is a Messages API response.
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// NewRequest translates a chat completion into a Messages API request.
+func (a *anthropic) NewRequest(path string, query url.Values, body []byte) (*Request, error) {
+	if path != "/v1/chat/completions" {
+		return nil, ErrUnsupportedEndpoint
+	}
+
+	var chat chatRequest
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, err
+	}
+	native, err := a.translateRequest(&chat)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(native)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := joinURL(a.cfg.TargetURL, "/v1/messages", nil)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	a.Authenticate(header)
+
+	return &Request{
+		Method: http.MethodPost,
+		URL:    u,
+		Header: header,
+		Body:   out,
+		Model:  chat.Model,
+		Stream: chat.Stream,
+	}, nil
+}
+
+func (a *anthropic) translateRequest(chat *chatRequest) (*anthropicRequest, error) {
+	req := &anthropicRequest{
+		Model:         chat.Model,
+		MaxTokens:     a.cfg.Anthropic.MaxTokens,
+		Temperature:   chat.Temperature,
+		TopP:          chat.TopP,
+		StopSequences: chat.stopSequences(),
+		Stream:        chat.Stream,
+	}
+	if maxTokens, ok := chat.maxTokens(); ok {
+		req.MaxTokens = maxTokens
+	}
+	if chat.User != "" {
+		req.Metadata = &anthropicMetadata{UserID: chat.User}
+	}
+
+	var system []string
+	for _, m := range chat.Messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, m.text())
+		case "user":
+			blocks, err := anthropicContent(&m)
+			if err != nil {
+				return nil, err
+			}
+			req.appendMessage("user", blocks...)
+		case "assistant":
+			var blocks []anthropicBlock
+			if text := m.text(); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+			req.appendMessage("assistant", blocks...)
+		case "tool":
+			req.appendMessage("user", anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.text()})
+		default:
+			return nil, fmt.Errorf("unsupported message role '%s'", m.Role)
+		}
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	for _, t := range chat.Tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		req.Tools = append(req.Tools, anthropicTool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema})
+	}
+	switch mode, function := chat.toolChoice(); mode {
+	case "auto":
+		req.ToolChoice = &anthropicToolUse{Type: "auto"}
+	case "required":
+		req.ToolChoice = &anthropicToolUse{Type: "any"}
+	case "none":
+		req.ToolChoice = &anthropicToolUse{Type: "none"}
+	case "function":
+		req.ToolChoice = &anthropicToolUse{Type: "tool", Name: function}
+	}
+
+	return req, nil
+}
+
+// appendMessage adds content blocks, merging consecutive messages of the
+// same role since the Messages API expects alternating turns.
+func (r *anthropicRequest) appendMessage(role string, blocks ...anthropicBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == role {
+		r.Messages[n-1].Content = append(r.Messages[n-1].Content, blocks...)
+		return
+	}
+	r.Messages = append(r.Messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// anthropicContent translates the content parts of a user message.
+func anthropicContent(m *chatMessage) ([]anthropicBlock, error) {
+	var blocks []anthropicBlock
+	for _, p := range m.parts() {
+		switch p.Type {
+		case "text":
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Text})
+		case "image_url":
+			if p.ImageURL == nil {
+				continue
+			}
+			source := &anthropicImageSource{Type: "url", URL: p.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(p.ImageURL.URL); ok {
+				source = &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: source})
+		default:
+			return nil, fmt.Errorf("unsupported content part type '%s'", p.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload.
+func parseDataURL(u string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(u, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(meta, ";base64")
+	return mediaType, data, found
+}
+
+// anthropicFinishReason maps a stop reason to an OpenAI finish reason.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// ModifyResponse translates a Messages API response or event stream into a
+// chat completion or chunk stream.
+func (a *anthropic) ModifyResponse(resp *http.Response, req *Request) error {
+	if !isSuccess(resp) {
+		return nil
+	}
+	if req.Stream {
+		translateStream(resp, func(src io.Reader, dst io.Writer) error {
+			return translateAnthropicStream(src, dst, req.Model)
+		})
+		return nil
+	}
+	return translateBody(resp, func(body []byte) (any, error) {
+		var native anthropicResponse
+		if err := json.Unmarshal(body, &native); err != nil {
+			return nil, err
+		}
+		return anthropicCompletion(&native), nil
+	})
+}
+
+// anthropicCompletion translates a Messages API response into a chat completion.
+func anthropicCompletion(native *anthropicResponse) *chatCompletion {
+	message := &responseMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range native.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, toolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: functionCall{Name: block.Name, Arguments: arguments(block.Input)},
+			})
+		}
+	}
+	if text.Len() > 0 || len(message.ToolCalls) == 0 {
+		message.Content = ptr(text.String())
+	}
+
+	return &chatCompletion{
+		ID:      native.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   native.Model,
+		Choices: []chatChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: ptr(anthropicFinishReason(native.StopReason)),
+		}},
+		Usage: newUsage(native.Usage.InputTokens, native.Usage.OutputTokens),
+	}
+}
+
+// anthropicEvent is any event of a Messages API stream.
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// translateAnthropicStream translates a Messages API event stream into chat
+// completion chunks. The final chunk carries the finish reason and usage.
+func translateAnthropicStream(src io.Reader, dst io.Writer, model string) error {
+	var out *chunkWriter
+	var inputTokens int
+	// toolIndex maps content block indexes to OpenAI tool call indexes.
+	toolIndex := make(map[int]int)
+
+	err := readEvents(src, func(_ string, data []byte) error {
+		var ev anthropicEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return err
+		}
+		if out == nil {
+			if ev.Type != "message_start" {
+				return fmt.Errorf("unexpected first event '%s'", ev.Type)
+			}
+			if ev.Message.Model != "" {
+				model = ev.Message.Model
+			}
+			out = newChunkWriter(dst, ev.Message.ID, model)
+			inputTokens = ev.Message.Usage.InputTokens
+			return out.send(responseMessage{Role: "assistant", Content: ptr("")}, nil, nil)
+		}
+
+		switch ev.Type {
+		case "content_block_start":
+			if ev.ContentBlock.Type != "tool_use" {
+				return nil
+			}
+			index := len(toolIndex)
+			toolIndex[ev.Index] = index
+			return out.send(responseMessage{ToolCalls: []toolCall{{
+				Index:    ptr(index),
+				ID:       ev.ContentBlock.ID,
+				Type:     "function",
+				Function: functionCall{Name: ev.ContentBlock.Name},
+			}}}, nil, nil)
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				return out.send(responseMessage{Content: ptr(ev.Delta.Text)}, nil, nil)
+			case "input_json_delta":
+				return out.send(responseMessage{ToolCalls: []toolCall{{
+					Index:    ptr(toolIndex[ev.Index]),
+					Function: functionCall{Arguments: ev.Delta.PartialJSON},
+				}}}, nil, nil)
+			}
+		case "message_delta":
+			finish := anthropicFinishReason(ev.Delta.StopReason)
+			return out.send(responseMessage{}, &finish, newUsage(inputTokens, ev.Usage.OutputTokens))
+		case "error":
+			out.fail(ev.Error.Type, ev.Error.Message)
+			return fmt.Errorf("upstream stream error: %s", ev.Error.Message)
+		}
+		return nil
+	})
+	if err != nil || out == nil {
+		return err
+	}
+	return out.done()
+}
+
+// Authenticate sets the API key and version headers.
+func (a *anthropic) Authenticate(header http.Header) {
+	header.Del("Authorization")
+	header.Set("x-api-key", a.cfg.APIKey)
+	header.Set("anthropic-version", a.cfg.Anthropic.Version)
+}
+
+// ModelsRequest lists models via GET /v1/models.
+func (a *anthropic) ModelsRequest(ctx context.Context) (*http.Request, error) {
+	u, err := joinURL(a.cfg.TargetURL, "/v1/models", url.Values{"limit": {"1000"}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	a.Authenticate(req.Header)
+	return req, nil
+}
+
+// ParseModels parses an Anthropic model list.
+func (a *anthropic) ParseModels(body []byte) ([]Model, error) {
+	var list struct {
+		Data []struct {
+			ID        string    `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, len(list.Data))
+	for i, m := range list.Data {
+		models[i] = Model{ID: m.ID, Created: m.CreatedAt.Unix(), OwnedBy: "anthropic"}
+	}
+	return models, nil
+}
+
+// Endpoints reports that only chat completions are translated.
+func (a *anthropic) Endpoints() []string {
+	return []string{config.EndpointChat}
+}
@@ -0,0 +1,217 @@
+package adapter
+
+import (
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestAnthropic() *anthropic {
+	return newAnthropic(config.Provider{
+		Name:      "anthropic",
+		Type:      config.ProviderTypeAnthropic,
+		TargetURL: "https://api.anthropic.com",
+		APIKey:    "test-key",
+	})
+}
+
+func TestAnthropicNewRequest(t *testing.T) {
+	a := newTestAnthropic()
+	body := `{
+		"model": "claude-sonnet",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "What's the weather?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "Sunny"},
+			{"role": "user", "content": [{"type": "text", "text": "And this?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]}
+		],
+		"stop": "END",
+		"tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"stream": true
+	}`
+
+	req, err := a.NewRequest("/v1/chat/completions", nil, []byte(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if got := req.URL.String(); got != "https://api.anthropic.com/v1/messages" {
+		t.Errorf("unexpected URL %s", got)
+	}
+	if req.Header.Get("x-api-key") != "test-key" || req.Header.Get("anthropic-version") != defaultAnthropicVersion {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if !req.Stream || req.Model != "claude-sonnet" {
+		t.Errorf("unexpected request metadata: stream=%v model=%s", req.Stream, req.Model)
+	}
+
+	var native anthropicRequest
+	if err := json.Unmarshal(req.Body, &native); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if native.System != "Be brief." {
+		t.Errorf("expected system prompt to be extracted, got %q", native.System)
+	}
+	if native.MaxTokens != defaultAnthropicMaxTokens {
+		t.Errorf("expected default max_tokens, got %d", native.MaxTokens)
+	}
+	if len(native.StopSequences) != 1 || native.StopSequences[0] != "END" {
+		t.Errorf("unexpected stop sequences %v", native.StopSequences)
+	}
+	if native.ToolChoice == nil || native.ToolChoice.Type != "any" {
+		t.Errorf("expected tool_choice any, got %+v", native.ToolChoice)
+	}
+	if len(native.Tools) != 1 || native.Tools[0].Name != "weather" {
+		t.Errorf("unexpected tools %+v", native.Tools)
+	}
+
+	// The tool result and the following user message are merged into one turn.
+	roles := make([]string, len(native.Messages))
+	for i, m := range native.Messages {
+		roles[i] = m.Role
+	}
+	if strings.Join(roles, ",") != "user,assistant,user" {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+	if use := native.Messages[1].Content[0]; use.Type != "tool_use" || use.ID != "call_1" || string(use.Input) != `{"city":"Paris"}` {
+		t.Errorf("unexpected tool_use block %+v", use)
+	}
+	last := native.Messages[2].Content
+	if len(last) != 3 || last[0].Type != "tool_result" || last[0].ToolUseID != "call_1" {
+		t.Errorf("unexpected tool_result blocks %+v", last)
+	}
+	if img := last[2]; img.Type != "image" || img.Source.Type != "base64" || img.Source.MediaType != "image/png" {
+		t.Errorf("unexpected image block %+v", img)
+	}
+}
+
+func TestAnthropicNewRequestUnsupportedEndpoint(t *testing.T) {
+	if _, err := newTestAnthropic().NewRequest("/v1/embeddings", nil, []byte(`{}`)); err != ErrUnsupportedEndpoint {
+		t.Errorf("expected ErrUnsupportedEndpoint, got %v", err)
+	}
+}
+
+func newTestResponse(contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestAnthropicModifyResponse(t *testing.T) {
+	resp := newTestResponse("application/json", `{
+		"id": "msg_1",
+		"model": "claude-sonnet",
+		"content": [{"type": "text", "text": "Hello"}, {"type": "tool_use", "id": "tu_1", "name": "weather", "input": {"city": "Paris"}}],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "output_tokens": 5}
+	}`)
+	if err := newTestAnthropic().ModifyResponse(resp, &Request{}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+
+	var completion chatCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	choice := completion.Choices[0]
+	if *choice.FinishReason != "tool_calls" {
+		t.Errorf("expected finish reason tool_calls, got %s", *choice.FinishReason)
+	}
+	if *choice.Message.Content != "Hello" {
+		t.Errorf("unexpected content %q", *choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("unexpected tool calls %+v", choice.Message.ToolCalls)
+	}
+	if completion.Usage == nil || completion.Usage.TotalTokens != 15 {
+		t.Errorf("unexpected usage %+v", completion.Usage)
+	}
+}
+
+func TestAnthropicModifyResponseStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet","usage":{"input_tokens":10}}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		``,
+		`event: ping`,
+		`data: {"type":"ping"}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu_1","name":"weather"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+		``,
+		`event: message_delta`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	}, "\n")
+	resp := newTestResponse("text/event-stream", stream)
+	if err := newTestAnthropic().ModifyResponse(resp, &Request{Stream: true, Model: "claude-sonnet"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading translated stream failed: %v", err)
+	}
+
+	var chunks []chatCompletion
+	var done bool
+	readEvents(strings.NewReader(string(out)), func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			done = true
+			return nil
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	if !done {
+		t.Error("expected stream to end with [DONE]")
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("expected 5 chunks, got %d: %s", len(chunks), out)
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("expected first chunk to carry the role")
+	}
+	if *chunks[1].Choices[0].Delta.Content != "Hi" {
+		t.Errorf("unexpected text delta %+v", chunks[1].Choices[0].Delta)
+	}
+	if call := chunks[2].Choices[0].Delta.ToolCalls[0]; *call.Index != 0 || call.ID != "tu_1" || call.Function.Name != "weather" {
+		t.Errorf("unexpected tool call start %+v", call)
+	}
+	final := chunks[4]
+	if *final.Choices[0].FinishReason != "stop" || final.Usage == nil || final.Usage.TotalTokens != 13 {
+		t.Errorf("unexpected final chunk %+v", final)
+	}
+}
+
+func TestAnthropicParseModels(t *testing.T) {
+	models, err := newTestAnthropic().ParseModels([]byte(`{"data":[{"id":"claude-sonnet","created_at":"2025-02-19T00:00:00Z"}]}`))
+	if err != nil {
+		t.Fatalf("ParseModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "claude-sonnet" || models[0].OwnedBy != "anthropic" || models[0].Created == 0 {
+		t.Errorf("unexpected models %+v", models)
+	}
+}
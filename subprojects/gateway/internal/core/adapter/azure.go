@@ -0,0 +1,166 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const defaultAzureAPIVersion = "2024-10-21"
+
+// azureOpenAI is the adapter for Azure OpenAI. The API is OpenAI-compatible,
+// but models are addressed by deployment in the URL path.
+type azureOpenAI struct {
+	cfg config.Provider
+}
+
+func newAzureOpenAI(p config.Provider) *azureOpenAI {
+	if p.AzureOpenAI.APIVersion == "" {
+		p.AzureOpenAI.APIVersion = defaultAzureAPIVersion
+	}
+	return &azureOpenAI{cfg: p}
+}
+
+// deployment returns the deployment serving the given model.
+func (a *azureOpenAI) deployment(model string) string {
+	if d, ok := a.cfg.AzureOpenAI.Deployments[model]; ok {
+		return d
+	}
+	return model
+}
+
+// NewRequest maps /v1/{operation} to /openai/deployments/{deployment}/{operation}.
+func (a *azureOpenAI) NewRequest(path string, query url.Values, body []byte) (*Request, error) {
+	operation, ok := strings.CutPrefix(path, "/v1/")
+	if !ok {
+		return nil, ErrUnsupportedEndpoint
+	}
+
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	for key, values := range query {
+		params[key] = values
+	}
+	params.Set("api-version", a.cfg.AzureOpenAI.APIVersion)
+	u, err := joinURL(a.cfg.TargetURL, "/openai/deployments/"+url.PathEscape(a.deployment(req.Model))+"/"+operation, params)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	a.Authenticate(header)
+	return &Request{
+		Method: http.MethodPost,
+		URL:    u,
+		Header: header,
+		Body:   body,
+		Model:  req.Model,
+		Stream: req.Stream,
+	}, nil
+}
+
+// ModifyResponse leaves the response untouched.
+func (a *azureOpenAI) ModifyResponse(resp *http.Response, req *Request) error {
+	return nil
+}
+
+// Authenticate sets the api-key header.
+func (a *azureOpenAI) Authenticate(header http.Header) {
+	header.Del("Authorization")
+	header.Set("api-key", a.cfg.APIKey)
+}
+
+// ModelsRequest lists the models of the resource via GET /openai/models.
+func (a *azureOpenAI) ModelsRequest(ctx context.Context) (*http.Request, error) {
+	u, err := joinURL(a.cfg.TargetURL, "/openai/models", url.Values{"api-version": {a.cfg.AzureOpenAI.APIVersion}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	a.Authenticate(req.Header)
+	return req, nil
+}
+
+// azureCapabilities are the capabilities of a model in the model list.
+type azureCapabilities struct {
+	ChatCompletion bool `json:"chat_completion"`
+	Completion     bool `json:"completion"`
+	Embeddings     bool `json:"embeddings"`
+}
+
+// endpoints returns the endpoint types matching the capabilities.
+func (c *azureCapabilities) endpoints() []string {
+	if c == nil {
+		return nil
+	}
+	endpoints := []string{}
+	if c.ChatCompletion {
+		endpoints = append(endpoints, config.EndpointChat)
+	}
+	if c.Completion {
+		endpoints = append(endpoints, config.EndpointCompletions)
+	}
+	if c.Embeddings {
+		endpoints = append(endpoints, config.EndpointEmbeddings)
+	}
+	return endpoints
+}
+
+// ParseModels parses the model list of the resource. It includes every model
+// the resource may use, so when deployments are configured only their models
+// are returned.
+func (a *azureOpenAI) ParseModels(body []byte) ([]Model, error) {
+	var list struct {
+		Data []struct {
+			ID           string             `json:"id"`
+			CreatedAt    int64              `json:"created_at"`
+			Capabilities *azureCapabilities `json:"capabilities"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	deployments := a.cfg.AzureOpenAI.Deployments
+	if len(deployments) == 0 {
+		models := make([]Model, len(list.Data))
+		for i, m := range list.Data {
+			models[i] = Model{ID: m.ID, Created: m.CreatedAt, OwnedBy: "azure", Endpoints: m.Capabilities.endpoints()}
+		}
+		return models, nil
+	}
+
+	listed := make(map[string]Model, len(list.Data))
+	for _, m := range list.Data {
+		listed[m.ID] = Model{ID: m.ID, Created: m.CreatedAt, OwnedBy: "azure", Endpoints: m.Capabilities.endpoints()}
+	}
+	models := make([]Model, 0, len(deployments))
+	for name := range deployments {
+		m, ok := listed[name]
+		if !ok {
+			m = Model{ID: name, OwnedBy: "azure"}
+		}
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// Endpoints reports every endpoint type, as requests are passed through.
+func (a *azureOpenAI) Endpoints() []string {
+	return config.Endpoints
+}
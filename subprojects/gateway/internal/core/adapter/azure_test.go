@@ -0,0 +1,80 @@
+package adapter
+
+import (
+	"llm-gateway/internal/config"
+	"net/url"
+	"testing"
+)
+
+func newTestAzureOpenAI() *azureOpenAI {
+	return newAzureOpenAI(config.Provider{
+		Name:      "azure",
+		Type:      config.ProviderTypeAzureOpenAI,
+		TargetURL: "https://example.openai.azure.com",
+		APIKey:    "test-key",
+		AzureOpenAI: config.AzureOpenAI{
+			APIVersion:  "2024-06-01",
+			Deployments: map[string]string{"gpt-4o": "prod-gpt4o"},
+		},
+	})
+}
+
+func TestAzureOpenAINewRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		wantURL string
+	}{
+		{
+			name:    "mapped deployment",
+			path:    "/v1/chat/completions",
+			body:    `{"model": "gpt-4o", "stream": true}`,
+			wantURL: "https://example.openai.azure.com/openai/deployments/prod-gpt4o/chat/completions?api-version=2024-06-01",
+		},
+		{
+			name:    "unmapped model is its own deployment",
+			path:    "/v1/embeddings",
+			body:    `{"model": "text-embedding-3-small"}`,
+			wantURL: "https://example.openai.azure.com/openai/deployments/text-embedding-3-small/embeddings?api-version=2024-06-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := newTestAzureOpenAI().NewRequest(tt.path, url.Values{"api-version": {"ignored"}}, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("NewRequest failed: %v", err)
+			}
+			if got := req.URL.String(); got != tt.wantURL {
+				t.Errorf("URL = %s, want %s", got, tt.wantURL)
+			}
+			if req.Header.Get("api-key") != "test-key" || req.Header.Get("Authorization") != "" {
+				t.Errorf("unexpected headers %v", req.Header)
+			}
+			if string(req.Body) != tt.body {
+				t.Errorf("expected body to be passed through, got %s", req.Body)
+			}
+		})
+	}
+}
+
+func TestAzureOpenAIParseModels(t *testing.T) {
+	body := []byte(`{"data": [{"id": "gpt-4o", "created_at": 1715558400}, {"id": "gpt-35-turbo", "created_at": 1}]}`)
+	models, err := newTestAzureOpenAI().ParseModels(body)
+	if err != nil {
+		t.Fatalf("ParseModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "gpt-4o" || models[0].Created != 1715558400 {
+		t.Errorf("expected only deployed models, got %+v", models)
+	}
+
+	unmapped := newAzureOpenAI(config.Provider{Type: config.ProviderTypeAzureOpenAI})
+	models, err = unmapped.ParseModels(body)
+	if err != nil {
+		t.Fatalf("ParseModels failed: %v", err)
+	}
+	if len(models) != 2 {
+		t.Errorf("expected every model without deployments, got %+v", models)
+	}
+}
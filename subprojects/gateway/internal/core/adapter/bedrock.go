@@ -0,0 +1,455 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// bedrock is the adapter for the AWS Bedrock Converse API. Requests are
+// expected to be signed by the sigv4 auth mode.
+type bedrock struct {
+	cfg config.Provider
+}
+
+func newBedrock(p config.Provider) *bedrock {
+	if p.Bedrock.ModelsURL == "" {
+		p.Bedrock.ModelsURL = strings.Replace(p.TargetURL, "bedrock-runtime", "bedrock", 1)
+	}
+	return &bedrock{cfg: p}
+}
+
+// bedrockRequest is a Converse request.
+type bedrockRequest struct {
+	Messages        []bedrockMessage        `json:"messages"`
+	System          []bedrockBlock          `json:"system,omitempty"`
+	InferenceConfig *bedrockInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *bedrockToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type bedrockMessage struct {
+	Role    string         `json:"role"`
+	Content []bedrockBlock `json:"content"`
+}
+
+// bedrockBlock is a content block of any kind; exactly one field is set.
+type bedrockBlock struct {
+	Text       string             `json:"text,omitempty"`
+	Image      *bedrockImage      `json:"image,omitempty"`
+	ToolUse    *bedrockToolUse    `json:"toolUse,omitempty"`
+	ToolResult *bedrockToolResult `json:"toolResult,omitempty"`
+}
+
+type bedrockImage struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes string `json:"bytes"`
+	} `json:"source"`
+}
+
+type bedrockToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type bedrockToolResult struct {
+	ToolUseID string         `json:"toolUseId"`
+	Content   []bedrockBlock `json:"content"`
+}
+
+type bedrockInferenceConfig struct {
+	MaxTokens     *int     `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type bedrockToolConfig struct {
+	Tools      []bedrockTool   `json:"tools"`
+	ToolChoice json.RawMessage `json:"toolChoice,omitempty"`
+}
+
+type bedrockTool struct {
+	ToolSpec struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		InputSchema struct {
+			JSON json.RawMessage `json:"json"`
+		} `json:"inputSchema"`
+	} `json:"toolSpec"`
+}
+
+type bedrockUsage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// bedrockResponse is a Converse response.
+type bedrockResponse struct {
+	Output struct {
+		Message bedrockMessage `json:"message"`
+	} `json:"output"`
+	StopReason string       `json:"stopReason"`
+	Usage      bedrockUsage `json:"usage"`
+}
+
+// NewRequest translates a chat completion into a Converse or, for streamed
+// requests, a ConverseStream request.
+func (b *bedrock) NewRequest(path string, query url.Values, body []byte) (*Request, error) {
+	if path != "/v1/chat/completions" {
+		return nil, ErrUnsupportedEndpoint
+	}
+
+	var chat chatRequest
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, err
+	}
+	native, err := translateBedrockRequest(&chat)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(native)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := "converse"
+	if chat.Stream {
+		operation = "converse-stream"
+	}
+	// Model IDs such as "anthropic.claude-3-haiku-20240307-v1:0" are sent
+	// with the colon escaped, as the AWS SDKs do.
+	modelID := strings.ReplaceAll(url.PathEscape(chat.Model), ":", "%3A")
+	u, err := joinURL(b.cfg.TargetURL, "/model/"+modelID+"/"+operation, nil)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	b.Authenticate(header)
+
+	return &Request{
+		Method: http.MethodPost,
+		URL:    u,
+		Header: header,
+		Body:   out,
+		Model:  chat.Model,
+		Stream: chat.Stream,
+	}, nil
+}
+
+func translateBedrockRequest(chat *chatRequest) (*bedrockRequest, error) {
+	req := &bedrockRequest{}
+
+	inference := &bedrockInferenceConfig{
+		Temperature:   chat.Temperature,
+		TopP:          chat.TopP,
+		StopSequences: chat.stopSequences(),
+	}
+	if maxTokens, ok := chat.maxTokens(); ok {
+		inference.MaxTokens = &maxTokens
+	}
+	if inference.MaxTokens != nil || inference.Temperature != nil || inference.TopP != nil || len(inference.StopSequences) > 0 {
+		req.InferenceConfig = inference
+	}
+
+	for _, m := range chat.Messages {
+		switch m.Role {
+		case "system", "developer":
+			req.System = append(req.System, bedrockBlock{Text: m.text()})
+		case "user":
+			blocks, err := bedrockContent(&m)
+			if err != nil {
+				return nil, err
+			}
+			req.appendMessage("user", blocks...)
+		case "assistant":
+			var blocks []bedrockBlock
+			if text := m.text(); text != "" {
+				blocks = append(blocks, bedrockBlock{Text: text})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, bedrockBlock{ToolUse: &bedrockToolUse{ToolUseID: call.ID, Name: call.Function.Name, Input: input}})
+			}
+			req.appendMessage("assistant", blocks...)
+		case "tool":
+			req.appendMessage("user", bedrockBlock{ToolResult: &bedrockToolResult{
+				ToolUseID: m.ToolCallID,
+				Content:   []bedrockBlock{{Text: m.text()}},
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported message role '%s'", m.Role)
+		}
+	}
+
+	if len(chat.Tools) > 0 {
+		req.ToolConfig = &bedrockToolConfig{}
+		for _, t := range chat.Tools {
+			var tool bedrockTool
+			tool.ToolSpec.Name = t.Function.Name
+			tool.ToolSpec.Description = t.Function.Description
+			tool.ToolSpec.InputSchema.JSON = t.Function.Parameters
+			if len(tool.ToolSpec.InputSchema.JSON) == 0 {
+				tool.ToolSpec.InputSchema.JSON = json.RawMessage(`{"type":"object","properties":{}}`)
+			}
+			req.ToolConfig.Tools = append(req.ToolConfig.Tools, tool)
+		}
+		// Converse has no equivalent of "none"; the model then decides itself.
+		switch mode, function := chat.toolChoice(); mode {
+		case "auto":
+			req.ToolConfig.ToolChoice = json.RawMessage(`{"auto":{}}`)
+		case "required":
+			req.ToolConfig.ToolChoice = json.RawMessage(`{"any":{}}`)
+		case "function":
+			choice, _ := json.Marshal(map[string]any{"tool": map[string]string{"name": function}})
+			req.ToolConfig.ToolChoice = choice
+		}
+	}
+
+	return req, nil
+}
+
+// appendMessage adds content blocks, merging consecutive messages of the
+// same role since Converse expects alternating turns.
+func (r *bedrockRequest) appendMessage(role string, blocks ...bedrockBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == role {
+		r.Messages[n-1].Content = append(r.Messages[n-1].Content, blocks...)
+		return
+	}
+	r.Messages = append(r.Messages, bedrockMessage{Role: role, Content: blocks})
+}
+
+// bedrockContent translates the content parts of a user message.
+func bedrockContent(m *chatMessage) ([]bedrockBlock, error) {
+	var blocks []bedrockBlock
+	for _, p := range m.parts() {
+		switch p.Type {
+		case "text":
+			blocks = append(blocks, bedrockBlock{Text: p.Text})
+		case "image_url":
+			if p.ImageURL == nil {
+				continue
+			}
+			mediaType, data, ok := parseDataURL(p.ImageURL.URL)
+			if !ok {
+				return nil, errors.New("bedrock only supports images given as base64 data URLs")
+			}
+			image := &bedrockImage{Format: strings.TrimPrefix(mediaType, "image/")}
+			image.Source.Bytes = data
+			blocks = append(blocks, bedrockBlock{Image: image})
+		default:
+			return nil, fmt.Errorf("unsupported content part type '%s'", p.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// bedrockFinishReason maps a stop reason to an OpenAI finish reason.
+func bedrockFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "guardrail_intervened", "content_filtered":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// ModifyResponse translates a Converse response or ConverseStream event
+// stream into a chat completion or SSE chunk stream.
+func (b *bedrock) ModifyResponse(resp *http.Response, req *Request) error {
+	if !isSuccess(resp) {
+		return nil
+	}
+	if req.Stream {
+		translateStream(resp, func(src io.Reader, dst io.Writer) error {
+			return translateBedrockStream(src, dst, req.Model)
+		})
+		return nil
+	}
+	return translateBody(resp, func(body []byte) (any, error) {
+		var native bedrockResponse
+		if err := json.Unmarshal(body, &native); err != nil {
+			return nil, err
+		}
+		return bedrockCompletion(&native, req.Model), nil
+	})
+}
+
+// bedrockCompletion translates a Converse response into a chat completion.
+func bedrockCompletion(native *bedrockResponse, model string) *chatCompletion {
+	message := &responseMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range native.Output.Message.Content {
+		switch {
+		case block.ToolUse != nil:
+			message.ToolCalls = append(message.ToolCalls, toolCall{
+				ID:       block.ToolUse.ToolUseID,
+				Type:     "function",
+				Function: functionCall{Name: block.ToolUse.Name, Arguments: arguments(block.ToolUse.Input)},
+			})
+		default:
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() > 0 || len(message.ToolCalls) == 0 {
+		message.Content = ptr(text.String())
+	}
+
+	return &chatCompletion{
+		ID:      newID("chatcmpl-"),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []chatChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: ptr(bedrockFinishReason(native.StopReason)),
+		}},
+		Usage: newUsage(native.Usage.InputTokens, native.Usage.OutputTokens),
+	}
+}
+
+// bedrockEvent is the payload of any ConverseStream event.
+type bedrockEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             struct {
+		ToolUse *bedrockToolUse `json:"toolUse"`
+	} `json:"start"`
+	Delta struct {
+		Text    string `json:"text"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse"`
+	} `json:"delta"`
+	StopReason string        `json:"stopReason"`
+	Usage      *bedrockUsage `json:"usage"`
+	Message    string        `json:"message"`
+}
+
+// translateBedrockStream translates a ConverseStream event stream into chat
+// completion chunks. The usage arrives in a metadata event after
+// messageStop, so the finishing chunk is sent once both are known.
+func translateBedrockStream(src io.Reader, dst io.Writer, model string) error {
+	out := newChunkWriter(dst, newID("chatcmpl-"), model)
+	toolIndex := make(map[int]int)
+	var stopReason string
+	var finished bool
+
+	err := readEventStream(src, func(headers map[string]string, payload []byte) error {
+		var ev bedrockEvent
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			return err
+		}
+		if headers[":message-type"] == "exception" {
+			out.fail(headers[":exception-type"], ev.Message)
+			return fmt.Errorf("upstream stream error: %s", ev.Message)
+		}
+
+		switch headers[":event-type"] {
+		case "messageStart":
+			return out.send(responseMessage{Role: "assistant", Content: ptr("")}, nil, nil)
+		case "contentBlockStart":
+			if ev.Start.ToolUse == nil {
+				return nil
+			}
+			index := len(toolIndex)
+			toolIndex[ev.ContentBlockIndex] = index
+			return out.send(responseMessage{ToolCalls: []toolCall{{
+				Index:    ptr(index),
+				ID:       ev.Start.ToolUse.ToolUseID,
+				Type:     "function",
+				Function: functionCall{Name: ev.Start.ToolUse.Name},
+			}}}, nil, nil)
+		case "contentBlockDelta":
+			if ev.Delta.ToolUse != nil {
+				return out.send(responseMessage{ToolCalls: []toolCall{{
+					Index:    ptr(toolIndex[ev.ContentBlockIndex]),
+					Function: functionCall{Arguments: ev.Delta.ToolUse.Input},
+				}}}, nil, nil)
+			}
+			return out.send(responseMessage{Content: ptr(ev.Delta.Text)}, nil, nil)
+		case "messageStop":
+			stopReason = ev.StopReason
+		case "metadata":
+			var u *usage
+			if ev.Usage != nil {
+				u = newUsage(ev.Usage.InputTokens, ev.Usage.OutputTokens)
+			}
+			finished = true
+			return out.send(responseMessage{}, ptr(bedrockFinishReason(stopReason)), u)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !finished {
+		if err := out.send(responseMessage{}, ptr(bedrockFinishReason(stopReason)), nil); err != nil {
+			return err
+		}
+	}
+	return out.done()
+}
+
+// Authenticate removes the Authorization header; requests are signed by
+// the provider's transport instead.
+func (b *bedrock) Authenticate(header http.Header) {
+	header.Del("Authorization")
+}
+
+// ModelsRequest lists the foundation models via the control plane.
+func (b *bedrock) ModelsRequest(ctx context.Context) (*http.Request, error) {
+	u, err := joinURL(b.cfg.Bedrock.ModelsURL, "/foundation-models", nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	b.Authenticate(req.Header)
+	return req, nil
+}
+
+// ParseModels parses a ListFoundationModels response.
+func (b *bedrock) ParseModels(body []byte) ([]Model, error) {
+	var list struct {
+		ModelSummaries []struct {
+			ModelID      string `json:"modelId"`
+			ProviderName string `json:"providerName"`
+		} `json:"modelSummaries"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, len(list.ModelSummaries))
+	for i, m := range list.ModelSummaries {
+		models[i] = Model{ID: m.ModelID, OwnedBy: m.ProviderName}
+	}
+	return models, nil
+}
+
+// Endpoints reports that only chat completions are translated.
+func (b *bedrock) Endpoints() []string {
+	return []string{config.EndpointChat}
+}
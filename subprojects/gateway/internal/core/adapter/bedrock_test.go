@@ -0,0 +1,195 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"llm-gateway/internal/config"
+	"strings"
+	"testing"
+)
+
+func newTestBedrock() *bedrock {
+	return newBedrock(config.Provider{
+		Name:      "bedrock",
+		Type:      config.ProviderTypeBedrock,
+		TargetURL: "https://bedrock-runtime.us-east-1.amazonaws.com",
+	})
+}
+
+// encodeEvent encodes an event stream message with string headers.
+func encodeEvent(headers map[string]string, payload string) []byte {
+	var h bytes.Buffer
+	for name, value := range headers {
+		h.WriteByte(byte(len(name)))
+		h.WriteString(name)
+		h.WriteByte(7)
+		binary.Write(&h, binary.BigEndian, uint16(len(value)))
+		h.WriteString(value)
+	}
+
+	var m bytes.Buffer
+	binary.Write(&m, binary.BigEndian, uint32(16+h.Len()+len(payload)))
+	binary.Write(&m, binary.BigEndian, uint32(h.Len()))
+	binary.Write(&m, binary.BigEndian, crc32.ChecksumIEEE(m.Bytes()))
+	m.Write(h.Bytes())
+	m.WriteString(payload)
+	binary.Write(&m, binary.BigEndian, crc32.ChecksumIEEE(m.Bytes()))
+	return m.Bytes()
+}
+
+func encodeEvents(events ...[2]string) string {
+	var b bytes.Buffer
+	for _, ev := range events {
+		b.Write(encodeEvent(map[string]string{":message-type": "event", ":event-type": ev[0]}, ev[1]))
+	}
+	return b.String()
+}
+
+func TestBedrockNewRequest(t *testing.T) {
+	body := `{
+		"model": "anthropic.claude-3-haiku-20240307-v1:0",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Weather?"},
+			{"role": "assistant", "tool_calls": [{"id": "tu_1", "type": "function", "function": {"name": "weather", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "tu_1", "content": "Sunny"}
+		],
+		"max_tokens": 100,
+		"tools": [{"type": "function", "function": {"name": "weather"}}],
+		"tool_choice": "auto",
+		"stream": true
+	}`
+
+	req, err := newTestBedrock().NewRequest("/v1/chat/completions", nil, []byte(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	want := "https://bedrock-runtime.us-east-1.amazonaws.com/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse-stream"
+	if got := req.URL.String(); got != want {
+		t.Errorf("URL = %s, want %s", got, want)
+	}
+
+	var native bedrockRequest
+	if err := json.Unmarshal(req.Body, &native); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(native.System) != 1 || native.System[0].Text != "Be brief." {
+		t.Errorf("unexpected system %+v", native.System)
+	}
+	if native.InferenceConfig == nil || *native.InferenceConfig.MaxTokens != 100 {
+		t.Errorf("unexpected inference config %+v", native.InferenceConfig)
+	}
+	if len(native.Messages) != 3 || native.Messages[2].Content[0].ToolResult == nil {
+		t.Fatalf("unexpected messages %+v", native.Messages)
+	}
+	if native.ToolConfig == nil || string(native.ToolConfig.ToolChoice) != `{"auto":{}}` {
+		t.Errorf("unexpected tool config %+v", native.ToolConfig)
+	}
+}
+
+func TestBedrockModifyResponse(t *testing.T) {
+	resp := newTestResponse("application/json", `{
+		"output": {"message": {"role": "assistant", "content": [{"text": "Hello"}]}},
+		"stopReason": "end_turn",
+		"usage": {"inputTokens": 3, "outputTokens": 1, "totalTokens": 4}
+	}`)
+	if err := newTestBedrock().ModifyResponse(resp, &Request{Model: "m"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+
+	var completion chatCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if *completion.Choices[0].Message.Content != "Hello" || *completion.Choices[0].FinishReason != "stop" || completion.Usage.TotalTokens != 4 {
+		t.Errorf("unexpected completion %+v", completion)
+	}
+}
+
+func TestBedrockModifyResponseStream(t *testing.T) {
+	stream := encodeEvents(
+		[2]string{"messageStart", `{"role":"assistant"}`},
+		[2]string{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hi"}}`},
+		[2]string{"contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tu_1","name":"weather"}}}`},
+		[2]string{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{}"}}}`},
+		[2]string{"messageStop", `{"stopReason":"tool_use"}`},
+		[2]string{"metadata", `{"usage":{"inputTokens":5,"outputTokens":2,"totalTokens":7}}`},
+	)
+	resp := newTestResponse("application/vnd.amazon.eventstream", stream)
+	if err := newTestBedrock().ModifyResponse(resp, &Request{Stream: true, Model: "m"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading translated stream failed: %v", err)
+	}
+
+	var chunks []chatCompletion
+	readEvents(strings.NewReader(string(out)), func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	if len(chunks) != 5 {
+		t.Fatalf("expected 5 chunks, got %d: %s", len(chunks), out)
+	}
+	if call := chunks[2].Choices[0].Delta.ToolCalls[0]; call.ID != "tu_1" || *call.Index != 0 {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+	final := chunks[4]
+	if *final.Choices[0].FinishReason != "tool_calls" || final.Usage == nil || final.Usage.TotalTokens != 7 {
+		t.Errorf("unexpected final chunk %+v", final)
+	}
+}
+
+func TestBedrockModifyResponseStreamException(t *testing.T) {
+	stream := encodeEvents([2]string{"messageStart", `{"role":"assistant"}`}) +
+		string(encodeEvent(map[string]string{":message-type": "exception", ":exception-type": "throttlingException"}, `{"message":"slow down"}`))
+	resp := newTestResponse("application/vnd.amazon.eventstream", stream)
+	if err := newTestBedrock().ModifyResponse(resp, &Request{Stream: true, Model: "m"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+
+	out, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Error("expected the stream to end with an error")
+	}
+	if !strings.Contains(string(out), `"type":"throttlingException"`) {
+		t.Errorf("expected an error event, got %s", out)
+	}
+}
+
+func TestReadEventStreamChecksum(t *testing.T) {
+	message := encodeEvent(map[string]string{":event-type": "messageStart"}, `{}`)
+	message[len(message)-1] ^= 0xff
+	err := readEventStream(bytes.NewReader(message), func(map[string]string, []byte) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+}
+
+func TestBedrockModelsRequest(t *testing.T) {
+	req, err := newTestBedrock().ModelsRequest(context.Background())
+	if err != nil {
+		t.Fatalf("ModelsRequest failed: %v", err)
+	}
+	if got := req.URL.String(); got != "https://bedrock.us-east-1.amazonaws.com/foundation-models" {
+		t.Errorf("unexpected URL %s", got)
+	}
+
+	models, err := newTestBedrock().ParseModels([]byte(`{"modelSummaries":[{"modelId":"amazon.titan-text-express-v1","providerName":"Amazon"}]}`))
+	if err != nil || len(models) != 1 || models[0].ID != "amazon.titan-text-express-v1" || models[0].OwnedBy != "Amazon" {
+		t.Errorf("unexpected models %+v, %v", models, err)
+	}
+}
@@ -0,0 +1,100 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// maxEventStreamMessage bounds a single message of an AWS event stream.
+const maxEventStreamMessage = 16 << 20
+
+// readEventStream reads messages in the binary AWS event stream encoding
+// (application/vnd.amazon.eventstream) and calls fn with the string headers
+// and payload of every message.
+func readEventStream(r io.Reader, fn func(headers map[string]string, payload []byte) error) error {
+	prelude := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(r, prelude); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		totalLength := binary.BigEndian.Uint32(prelude[0:4])
+		headersLength := binary.BigEndian.Uint32(prelude[4:8])
+		if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+			return errors.New("event stream prelude checksum mismatch")
+		}
+		if totalLength < 16+headersLength || totalLength > maxEventStreamMessage {
+			return fmt.Errorf("invalid event stream message length %d", totalLength)
+		}
+
+		message := make([]byte, totalLength)
+		copy(message, prelude)
+		if _, err := io.ReadFull(r, message[12:]); err != nil {
+			return err
+		}
+		end := totalLength - 4
+		if crc32.ChecksumIEEE(message[:end]) != binary.BigEndian.Uint32(message[end:]) {
+			return errors.New("event stream message checksum mismatch")
+		}
+
+		headers, err := parseEventStreamHeaders(message[12 : 12+headersLength])
+		if err != nil {
+			return err
+		}
+		if err := fn(headers, message[12+headersLength:end]); err != nil {
+			return err
+		}
+	}
+}
+
+// parseEventStreamHeaders decodes the headers of a message, keeping only
+// those of string type, which is all the Converse API uses.
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLength := int(b[0])
+		if len(b) < 1+nameLength+1 {
+			return nil, errors.New("truncated event stream header")
+		}
+		name := string(b[1 : 1+nameLength])
+		valueType := b[1+nameLength]
+		b = b[2+nameLength:]
+
+		var size int
+		switch valueType {
+		case 0, 1: // boolean true, false
+			size = 0
+		case 2: // byte
+			size = 1
+		case 3: // short
+			size = 2
+		case 4: // integer
+			size = 4
+		case 5, 8: // long, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // byte array, string
+			if len(b) < 2 {
+				return nil, errors.New("truncated event stream header")
+			}
+			size = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		default:
+			return nil, fmt.Errorf("unknown event stream header type %d", valueType)
+		}
+		if len(b) < size {
+			return nil, errors.New("truncated event stream header")
+		}
+		if valueType == 7 {
+			headers[name] = string(b[:size])
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
@@ -0,0 +1,518 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultGeminiAPIVersion = "v1beta"
+
+// gemini is the adapter for the Google Gemini API.
+type gemini struct {
+	cfg config.Provider
+}
+
+func newGemini(p config.Provider) *gemini {
+	if p.Gemini.APIVersion == "" {
+		p.Gemini.APIVersion = defaultGeminiAPIVersion
+	}
+	return &gemini{cfg: p}
+}
+
+// geminiRequest is a generateContent request.
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	SafetySettings    []geminiSafetySetting   `json:"safetySettings,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is a content part of any kind; exactly one field is set.
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+// geminiResponse is a generateContent response or a streamed chunk of one.
+type geminiResponse struct {
+	ResponseID string `json:"responseId"`
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+// NewRequest translates a chat completion into a generateContent or, for
+// streamed requests, a streamGenerateContent request.
+func (g *gemini) NewRequest(path string, query url.Values, body []byte) (*Request, error) {
+	if path != "/v1/chat/completions" {
+		return nil, ErrUnsupportedEndpoint
+	}
+
+	var chat chatRequest
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, err
+	}
+	native, err := g.translateRequest(&chat)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(native)
+	if err != nil {
+		return nil, err
+	}
+
+	method, params := "generateContent", url.Values(nil)
+	if chat.Stream {
+		method, params = "streamGenerateContent", url.Values{"alt": {"sse"}}
+	}
+	// The model is escaped so that it cannot reach other API paths.
+	u, err := joinURL(g.cfg.TargetURL, fmt.Sprintf("/%s/models/%s:%s", g.cfg.Gemini.APIVersion, url.PathEscape(chat.Model), method), params)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	g.Authenticate(header)
+
+	return &Request{
+		Method: http.MethodPost,
+		URL:    u,
+		Header: header,
+		Body:   out,
+		Model:  chat.Model,
+		Stream: chat.Stream,
+	}, nil
+}
+
+func (g *gemini) translateRequest(chat *chatRequest) (*geminiRequest, error) {
+	req := &geminiRequest{}
+	for _, s := range g.cfg.Gemini.SafetySettings {
+		req.SafetySettings = append(req.SafetySettings, geminiSafetySetting{Category: s.Category, Threshold: s.Threshold})
+	}
+
+	generation := &geminiGenerationConfig{
+		Temperature:   chat.Temperature,
+		TopP:          chat.TopP,
+		StopSequences: chat.stopSequences(),
+	}
+	if maxTokens, ok := chat.maxTokens(); ok {
+		generation.MaxOutputTokens = &maxTokens
+	}
+	if chat.ResponseFormat != nil && strings.HasPrefix(chat.ResponseFormat.Type, "json") {
+		generation.ResponseMimeType = "application/json"
+	}
+	if generation.Temperature != nil || generation.TopP != nil || generation.MaxOutputTokens != nil ||
+		len(generation.StopSequences) > 0 || generation.ResponseMimeType != "" {
+		req.GenerationConfig = generation
+	}
+
+	// Tool results only carry the call ID, but Gemini matches them by name.
+	toolNames := make(map[string]string)
+	var system []geminiPart
+	for _, m := range chat.Messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, geminiPart{Text: m.text()})
+		case "user":
+			parts, err := geminiParts(&m)
+			if err != nil {
+				return nil, err
+			}
+			req.appendContent("user", parts...)
+		case "assistant":
+			var parts []geminiPart
+			if text := m.text(); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, call := range m.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				args := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+			req.appendContent("model", parts...)
+		case "tool":
+			name := m.Name
+			if name == "" {
+				name = toolNames[m.ToolCallID]
+			}
+			req.appendContent("user", geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: map[string]any{"content": m.text()},
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported message role '%s'", m.Role)
+		}
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(chat.Tools) > 0 {
+		tool := geminiTool{}
+		for _, t := range chat.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			})
+		}
+		req.Tools = []geminiTool{tool}
+	}
+	if mode, function := chat.toolChoice(); mode != "" {
+		req.ToolConfig = &geminiToolConfig{}
+		switch mode {
+		case "required":
+			req.ToolConfig.FunctionCallingConfig.Mode = "ANY"
+		case "none":
+			req.ToolConfig.FunctionCallingConfig.Mode = "NONE"
+		case "function":
+			req.ToolConfig.FunctionCallingConfig.Mode = "ANY"
+			req.ToolConfig.FunctionCallingConfig.AllowedFunctionNames = []string{function}
+		default:
+			req.ToolConfig.FunctionCallingConfig.Mode = "AUTO"
+		}
+	}
+
+	return req, nil
+}
+
+// appendContent adds parts, merging consecutive contents of the same role.
+func (r *geminiRequest) appendContent(role string, parts ...geminiPart) {
+	if len(parts) == 0 {
+		return
+	}
+	if n := len(r.Contents); n > 0 && r.Contents[n-1].Role == role {
+		r.Contents[n-1].Parts = append(r.Contents[n-1].Parts, parts...)
+		return
+	}
+	r.Contents = append(r.Contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiParts translates the content parts of a user message.
+func geminiParts(m *chatMessage) ([]geminiPart, error) {
+	var parts []geminiPart
+	for _, p := range m.parts() {
+		switch p.Type {
+		case "text":
+			parts = append(parts, geminiPart{Text: p.Text})
+		case "image_url":
+			if p.ImageURL == nil {
+				continue
+			}
+			if mediaType, data, ok := parseDataURL(p.ImageURL.URL); ok {
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}})
+			} else {
+				parts = append(parts, geminiPart{FileData: &geminiFileData{FileURI: p.ImageURL.URL}})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content part type '%s'", p.Type)
+		}
+	}
+	return parts, nil
+}
+
+// geminiFinishReason maps a Gemini finish reason to an OpenAI finish reason.
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// ModifyResponse translates a generateContent response or event stream into
+// a chat completion or chunk stream.
+func (g *gemini) ModifyResponse(resp *http.Response, req *Request) error {
+	if !isSuccess(resp) {
+		return nil
+	}
+	if req.Stream {
+		translateStream(resp, func(src io.Reader, dst io.Writer) error {
+			return translateGeminiStream(src, dst, req.Model)
+		})
+		return nil
+	}
+	return translateBody(resp, func(body []byte) (any, error) {
+		var native geminiResponse
+		if err := json.Unmarshal(body, &native); err != nil {
+			return nil, err
+		}
+		return geminiCompletion(&native, req.Model), nil
+	})
+}
+
+// geminiCompletion translates a generateContent response into a chat completion.
+func geminiCompletion(native *geminiResponse, model string) *chatCompletion {
+	message := &responseMessage{Role: "assistant"}
+	finish := "stop"
+	if native.PromptFeedback != nil && native.PromptFeedback.BlockReason != "" {
+		finish = "content_filter"
+	}
+	if len(native.Candidates) > 0 {
+		candidate := native.Candidates[0]
+		var text string
+		text, message.ToolCalls = geminiMessage(candidate.Content.Parts, 0)
+		if text != "" || len(message.ToolCalls) == 0 {
+			message.Content = ptr(text)
+		}
+		finish = geminiFinishReason(candidate.FinishReason)
+		if len(message.ToolCalls) > 0 {
+			finish = "tool_calls"
+		}
+	} else {
+		message.Content = ptr("")
+	}
+
+	completion := &chatCompletion{
+		ID:      geminiID(native),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []chatChoice{{Index: 0, Message: message, FinishReason: &finish}},
+	}
+	if native.ModelVersion != "" {
+		completion.Model = native.ModelVersion
+	}
+	if u := native.UsageMetadata; u != nil {
+		completion.Usage = newUsage(u.PromptTokenCount, u.CandidatesTokenCount)
+	}
+	return completion
+}
+
+// geminiMessage splits response parts into text and tool calls. Tool call
+// indexes start at firstIndex.
+func geminiMessage(parts []geminiPart, firstIndex int) (string, []toolCall) {
+	var text strings.Builder
+	var calls []toolCall
+	for _, p := range parts {
+		switch {
+		case p.FunctionCall != nil:
+			id := p.FunctionCall.ID
+			if id == "" {
+				id = newID("call_")
+			}
+			calls = append(calls, toolCall{
+				Index:    ptr(firstIndex + len(calls)),
+				ID:       id,
+				Type:     "function",
+				Function: functionCall{Name: p.FunctionCall.Name, Arguments: arguments(p.FunctionCall.Args)},
+			})
+		default:
+			text.WriteString(p.Text)
+		}
+	}
+	return text.String(), calls
+}
+
+func geminiID(native *geminiResponse) string {
+	if native.ResponseID != "" {
+		return native.ResponseID
+	}
+	return newID("chatcmpl-")
+}
+
+// translateGeminiStream translates a streamGenerateContent event stream into
+// chat completion chunks. Gemini repeats the usage in every chunk, so the
+// last one seen is attached to the finishing chunk.
+func translateGeminiStream(src io.Reader, dst io.Writer, model string) error {
+	var out *chunkWriter
+	var calls int
+	var finished bool
+
+	err := readEvents(src, func(_ string, data []byte) error {
+		var native geminiResponse
+		if err := json.Unmarshal(data, &native); err != nil {
+			return err
+		}
+		if out == nil {
+			if native.ModelVersion != "" {
+				model = native.ModelVersion
+			}
+			out = newChunkWriter(dst, geminiID(&native), model)
+			if err := out.send(responseMessage{Role: "assistant", Content: ptr("")}, nil, nil); err != nil {
+				return err
+			}
+		}
+
+		var u *usage
+		if m := native.UsageMetadata; m != nil {
+			u = newUsage(m.PromptTokenCount, m.CandidatesTokenCount)
+		}
+		if len(native.Candidates) == 0 {
+			if native.PromptFeedback != nil && native.PromptFeedback.BlockReason != "" {
+				finished = true
+				return out.send(responseMessage{}, ptr("content_filter"), u)
+			}
+			return nil
+		}
+
+		candidate := native.Candidates[0]
+		text, toolCalls := geminiMessage(candidate.Content.Parts, calls)
+		calls += len(toolCalls)
+		if text != "" || len(toolCalls) > 0 {
+			delta := responseMessage{ToolCalls: toolCalls}
+			if text != "" {
+				delta.Content = ptr(text)
+			}
+			if err := out.send(delta, nil, nil); err != nil {
+				return err
+			}
+		}
+		if candidate.FinishReason != "" {
+			finish := geminiFinishReason(candidate.FinishReason)
+			if calls > 0 {
+				finish = "tool_calls"
+			}
+			finished = true
+			return out.send(responseMessage{}, &finish, u)
+		}
+		return nil
+	})
+	if err != nil || out == nil {
+		return err
+	}
+	if !finished {
+		if err := out.send(responseMessage{}, ptr("stop"), nil); err != nil {
+			return err
+		}
+	}
+	return out.done()
+}
+
+// Authenticate sets the API key header.
+func (g *gemini) Authenticate(header http.Header) {
+	header.Del("Authorization")
+	header.Set("x-goog-api-key", g.cfg.APIKey)
+}
+
+// ModelsRequest lists models via GET /{version}/models.
+func (g *gemini) ModelsRequest(ctx context.Context) (*http.Request, error) {
+	u, err := joinURL(g.cfg.TargetURL, "/"+g.cfg.Gemini.APIVersion+"/models", url.Values{"pageSize": {"1000"}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	g.Authenticate(req.Header)
+	return req, nil
+}
+
+// ParseModels parses a Gemini model list, whose names carry a "models/" prefix.
+func (g *gemini) ParseModels(body []byte) ([]Model, error) {
+	var list struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, len(list.Models))
+	for i, m := range list.Models {
+		models[i] = Model{ID: strings.TrimPrefix(m.Name, "models/"), OwnedBy: "google"}
+		if m.SupportedGenerationMethods != nil {
+			models[i].Endpoints = []string{}
+			for _, method := range m.SupportedGenerationMethods {
+				// Only generateContent is translated; embedContent models
+				// are not tagged for endpoints this adapter cannot serve.
+				if method == "generateContent" {
+					models[i].Endpoints = append(models[i].Endpoints, config.EndpointChat)
+				}
+			}
+		}
+	}
+	return models, nil
+}
+
+// Endpoints reports that only chat completions are translated.
+func (g *gemini) Endpoints() []string {
+	return []string{config.EndpointChat}
+}
@@ -0,0 +1,186 @@
+package adapter
+
+import (
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/config"
+	"strings"
+	"testing"
+)
+
+func newTestGemini() *gemini {
+	return newGemini(config.Provider{
+		Name:      "gemini",
+		Type:      config.ProviderTypeGemini,
+		TargetURL: "https://generativelanguage.googleapis.com",
+		APIKey:    "test-key",
+		Gemini: config.Gemini{
+			SafetySettings: []config.SafetySetting{{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_ONLY_HIGH"}},
+		},
+	})
+}
+
+func TestGeminiNewRequest(t *testing.T) {
+	body := `{
+		"model": "gemini-2.0-flash",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "What's the weather?"},
+			{"role": "assistant", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "Sunny"}
+		],
+		"max_tokens": 100,
+		"temperature": 0.2,
+		"response_format": {"type": "json_object"},
+		"tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object"}}}],
+		"tool_choice": {"type": "function", "function": {"name": "weather"}},
+		"stream": true
+	}`
+
+	req, err := newTestGemini().NewRequest("/v1/chat/completions", nil, []byte(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	want := "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:streamGenerateContent?alt=sse"
+	if got := req.URL.String(); got != want {
+		t.Errorf("URL = %s, want %s", got, want)
+	}
+	if req.Header.Get("x-goog-api-key") != "test-key" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	var native geminiRequest
+	if err := json.Unmarshal(req.Body, &native); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if native.SystemInstruction == nil || native.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("expected system instruction, got %+v", native.SystemInstruction)
+	}
+	if len(native.SafetySettings) != 1 || native.SafetySettings[0].Threshold != "BLOCK_ONLY_HIGH" {
+		t.Errorf("unexpected safety settings %+v", native.SafetySettings)
+	}
+	gen := native.GenerationConfig
+	if gen == nil || *gen.MaxOutputTokens != 100 || *gen.Temperature != 0.2 || gen.ResponseMimeType != "application/json" {
+		t.Errorf("unexpected generation config %+v", gen)
+	}
+	if cfg := native.ToolConfig.FunctionCallingConfig; cfg.Mode != "ANY" || len(cfg.AllowedFunctionNames) != 1 {
+		t.Errorf("unexpected tool config %+v", cfg)
+	}
+
+	roles := make([]string, len(native.Contents))
+	for i, c := range native.Contents {
+		roles[i] = c.Role
+	}
+	if strings.Join(roles, ",") != "user,model,user" {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+	if call := native.Contents[1].Parts[0].FunctionCall; call == nil || call.Name != "weather" {
+		t.Errorf("unexpected function call %+v", native.Contents[1].Parts[0])
+	}
+	if resp := native.Contents[2].Parts[0].FunctionResponse; resp == nil || resp.Name != "weather" || resp.Response["content"] != "Sunny" {
+		t.Errorf("expected function response to be matched by name, got %+v", native.Contents[2].Parts[0])
+	}
+}
+
+func TestGeminiModifyResponse(t *testing.T) {
+	resp := newTestResponse("application/json", `{
+		"candidates": [{"content": {"role": "model", "parts": [{"text": "Hello"}]}, "finishReason": "MAX_TOKENS"}],
+		"usageMetadata": {"promptTokenCount": 4, "candidatesTokenCount": 6},
+		"modelVersion": "gemini-2.0-flash"
+	}`)
+	if err := newTestGemini().ModifyResponse(resp, &Request{Model: "gemini-2.0-flash"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+
+	var completion chatCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	choice := completion.Choices[0]
+	if *choice.Message.Content != "Hello" || *choice.FinishReason != "length" {
+		t.Errorf("unexpected choice %+v", choice)
+	}
+	if completion.Usage == nil || completion.Usage.TotalTokens != 10 {
+		t.Errorf("unexpected usage %+v", completion.Usage)
+	}
+}
+
+func TestGeminiModifyResponseStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":4}}`,
+		``,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"weather","args":{"city":"Paris"}}}]}}]}`,
+		``,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2}}`,
+		``,
+	}, "\n")
+	resp := newTestResponse("text/event-stream", stream)
+	if err := newTestGemini().ModifyResponse(resp, &Request{Stream: true, Model: "gemini-2.0-flash"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading translated stream failed: %v", err)
+	}
+
+	var chunks []chatCompletion
+	readEvents(strings.NewReader(string(out)), func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	if !strings.HasSuffix(string(out), "data: [DONE]\n\n") {
+		t.Error("expected stream to end with [DONE]")
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d: %s", len(chunks), out)
+	}
+	if *chunks[1].Choices[0].Delta.Content != "Hel" {
+		t.Errorf("unexpected text delta %+v", chunks[1].Choices[0].Delta)
+	}
+	if call := chunks[2].Choices[0].Delta.ToolCalls[0]; call.Function.Name != "weather" || call.Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+	final := chunks[3]
+	if *final.Choices[0].FinishReason != "tool_calls" || final.Usage == nil || final.Usage.TotalTokens != 6 {
+		t.Errorf("unexpected final chunk %+v", final)
+	}
+}
+
+func TestGeminiEscapesModelInURL(t *testing.T) {
+	req, err := newTestGemini().NewRequest("/v1/chat/completions", nil, []byte(`{"model": "x/../../v1beta/files", "messages": [{"role": "user", "content": "Hi"}]}`))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	want := "https://generativelanguage.googleapis.com/v1beta/models/x%2F..%2F..%2Fv1beta%2Ffiles:generateContent"
+	if got := req.URL.String(); got != want {
+		t.Errorf("URL = %s, want %s", got, want)
+	}
+}
+
+func TestGeminiParseModels(t *testing.T) {
+	models, err := newTestGemini().ParseModels([]byte(`{"models":[
+		{"name":"models/gemini-2.0-flash","supportedGenerationMethods":["generateContent"]},
+		{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("ParseModels failed: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "gemini-2.0-flash" || models[0].OwnedBy != "google" {
+		t.Fatalf("unexpected models %+v", models)
+	}
+	if len(models[0].Endpoints) != 1 || models[0].Endpoints[0] != config.EndpointChat {
+		t.Errorf("unexpected endpoints %v for a generateContent model", models[0].Endpoints)
+	}
+	// Embeddings are not translated, so embedContent models are not tagged for them.
+	if len(models[1].Endpoints) != 0 {
+		t.Errorf("unexpected endpoints %v for an embedContent model", models[1].Endpoints)
+	}
+}
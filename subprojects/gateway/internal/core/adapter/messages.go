@@ -0,0 +1,562 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The functions below serve the inbound Anthropic-compatible /v1/messages
+// endpoint: Messages API requests are translated into chat completions,
+// routed like any other request, and the chat completion responses are
+// translated back.
+
+// messagesRequest is an inbound Messages API request. Fields that may be a
+// string or a list of blocks are kept raw.
+type messagesRequest struct {
+	Model         string             `json:"model"`
+	System        json.RawMessage    `json:"system"`
+	Messages      []messagesMessage  `json:"messages"`
+	MaxTokens     *int               `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature"`
+	TopP          *float64           `json:"top_p"`
+	StopSequences []string           `json:"stop_sequences"`
+	Stream        bool               `json:"stream"`
+	Tools         []anthropicTool    `json:"tools"`
+	ToolChoice    *anthropicToolUse  `json:"tool_choice"`
+	Metadata      *anthropicMetadata `json:"metadata"`
+}
+
+type messagesMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// messagesBlock is an inbound content block of any type.
+type messagesBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text"`
+	Source *anthropicImageSource `json:"source"`
+	// tool_use
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+	// tool_result
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+}
+
+// messagesBlocks decodes content that is either a string or a list of blocks.
+func messagesBlocks(content json.RawMessage) ([]messagesBlock, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return []messagesBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []messagesBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// blocksText concatenates the text blocks of string or block list content.
+func blocksText(content json.RawMessage) (string, error) {
+	blocks, err := messagesBlocks(content)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, block := range blocks {
+		if block.Type == "text" {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String(), nil
+}
+
+// streamOptions asks OpenAI-compatible providers for usage in streams.
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// outboundChatRequest is the chat completion request built from a Messages
+// API request.
+type outboundChatRequest struct {
+	Model         string          `json:"model"`
+	Messages      []outboundChat  `json:"messages"`
+	MaxTokens     *int            `json:"max_tokens,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	TopP          *float64        `json:"top_p,omitempty"`
+	Stop          []string        `json:"stop,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	StreamOptions *streamOptions  `json:"stream_options,omitempty"`
+	Tools         []chatTool      `json:"tools,omitempty"`
+	ToolChoice    json.RawMessage `json:"tool_choice,omitempty"`
+	User          string          `json:"user,omitempty"`
+}
+
+type outboundChat struct {
+	Role       string     `json:"role"`
+	Content    any        `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// MessagesToChat translates an Anthropic Messages API request into an
+// OpenAI chat completion request.
+func MessagesToChat(body []byte) ([]byte, error) {
+	var in messagesRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+
+	out := outboundChatRequest{
+		Model:       in.Model,
+		MaxTokens:   in.MaxTokens,
+		Temperature: in.Temperature,
+		TopP:        in.TopP,
+		Stop:        in.StopSequences,
+		Stream:      in.Stream,
+	}
+	if in.Stream {
+		out.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	if in.Metadata != nil {
+		out.User = in.Metadata.UserID
+	}
+
+	system, err := blocksText(in.System)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system prompt: %w", err)
+	}
+	if system != "" {
+		out.Messages = append(out.Messages, outboundChat{Role: "system", Content: system})
+	}
+
+	for _, m := range in.Messages {
+		blocks, err := messagesBlocks(m.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content of %s message: %w", m.Role, err)
+		}
+		switch m.Role {
+		case "user":
+			messages, err := userMessages(blocks)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = append(out.Messages, messages...)
+		case "assistant":
+			out.Messages = append(out.Messages, assistantMessage(blocks))
+		default:
+			return nil, fmt.Errorf("unsupported message role '%s'", m.Role)
+		}
+	}
+
+	for _, t := range in.Tools {
+		tool := chatTool{Type: "function"}
+		tool.Function.Name = t.Name
+		tool.Function.Description = t.Description
+		tool.Function.Parameters = t.InputSchema
+		out.Tools = append(out.Tools, tool)
+	}
+	if in.ToolChoice != nil {
+		switch in.ToolChoice.Type {
+		case "auto":
+			out.ToolChoice = json.RawMessage(`"auto"`)
+		case "any":
+			out.ToolChoice = json.RawMessage(`"required"`)
+		case "none":
+			out.ToolChoice = json.RawMessage(`"none"`)
+		case "tool":
+			out.ToolChoice, _ = json.Marshal(map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": in.ToolChoice.Name},
+			})
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// userMessages translates the blocks of a user turn. Tool results become
+// tool messages, which must directly follow the assistant's tool calls, so
+// they come before the remaining content.
+func userMessages(blocks []messagesBlock) ([]outboundChat, error) {
+	var messages []outboundChat
+	var parts []contentPart
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, contentPart{Type: "text", Text: block.Text})
+		case "image":
+			if block.Source == nil {
+				continue
+			}
+			part := contentPart{Type: "image_url"}
+			part.ImageURL = &struct {
+				URL string `json:"url"`
+			}{URL: block.Source.URL}
+			if block.Source.Type == "base64" {
+				part.ImageURL.URL = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			parts = append(parts, part)
+		case "tool_result":
+			text, err := blocksText(block.Content)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tool_result content: %w", err)
+			}
+			messages = append(messages, outboundChat{Role: "tool", ToolCallID: block.ToolUseID, Content: text})
+		default:
+			return nil, fmt.Errorf("unsupported content block type '%s'", block.Type)
+		}
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0].Type == "text":
+		messages = append(messages, outboundChat{Role: "user", Content: parts[0].Text})
+	case len(parts) > 0:
+		messages = append(messages, outboundChat{Role: "user", Content: parts})
+	}
+	return messages, nil
+}
+
+// assistantMessage translates the blocks of an assistant turn. Thinking
+// blocks have no equivalent and are dropped.
+func assistantMessage(blocks []messagesBlock) outboundChat {
+	var text strings.Builder
+	msg := outboundChat{Role: "assistant"}
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, toolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: functionCall{Name: block.Name, Arguments: arguments(block.Input)},
+			})
+		}
+	}
+	if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+		msg.Content = text.String()
+	}
+	return msg
+}
+
+// messagesStopReason maps an OpenAI finish reason to a stop reason.
+func messagesStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// messagesResponse is an outbound Messages API response.
+type messagesResponse struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []anthropicBlock `json:"content"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        anthropicUsage   `json:"usage"`
+}
+
+// ChatToMessages translates a chat completion into a Messages API response.
+func ChatToMessages(body []byte) ([]byte, error) {
+	var completion chatCompletion
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, err
+	}
+
+	out := messagesResponse{
+		ID:      completion.ID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   completion.Model,
+		Content: []anthropicBlock{},
+	}
+	if len(completion.Choices) > 0 {
+		choice := completion.Choices[0]
+		if m := choice.Message; m != nil {
+			if m.Content != nil && *m.Content != "" {
+				out.Content = append(out.Content, anthropicBlock{Type: "text", Text: *m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				out.Content = append(out.Content, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		}
+		if choice.FinishReason != nil {
+			out.StopReason = ptr(messagesStopReason(*choice.FinishReason))
+		}
+	}
+	if completion.Usage != nil {
+		out.Usage = anthropicUsage{InputTokens: completion.Usage.PromptTokens, OutputTokens: completion.Usage.CompletionTokens}
+	}
+	return json.Marshal(out)
+}
+
+// messagesErrorType maps an HTTP status to a Messages API error type.
+func messagesErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// MessagesError translates an error response into a Messages API error body.
+// OpenAI error bodies keep their message; any other body is used verbatim.
+func MessagesError(status int, body []byte) []byte {
+	message := strings.TrimSpace(string(body))
+	var openAIError apiError
+	if err := json.Unmarshal(body, &openAIError); err == nil && openAIError.Error.Message != "" {
+		message = openAIError.Error.Message
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	out, _ := json.Marshal(messagesError(messagesErrorType(status), message))
+	return out
+}
+
+func messagesError(errType, message string) map[string]any {
+	return map[string]any{
+		"type":  "error",
+		"error": map[string]string{"type": errType, "message": message},
+	}
+}
+
+// MessagesStream translates chat completion chunks written to it as
+// server-sent events into Messages API events. Chunks may be split across
+// writes in any way.
+type MessagesStream struct {
+	w   io.Writer
+	buf bytes.Buffer
+
+	started    bool
+	block      int    // index of the open content block, -1 if none
+	blockType  string // type of the open content block
+	blocks     int    // number of content blocks started so far
+	tools      map[int]int
+	stopReason string
+	usage      anthropicUsage
+	closed     bool
+}
+
+// NewMessagesStream creates a stream translator writing events to w.
+func NewMessagesStream(w io.Writer) *MessagesStream {
+	return &MessagesStream{w: w, block: -1, tools: make(map[int]int)}
+}
+
+// Write consumes chat completion SSE data, writing the translated events for
+// every complete event it contains.
+func (s *MessagesStream) Write(p []byte) (int, error) {
+	s.buf.Write(p)
+	for {
+		data := s.buf.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		event := make([]byte, end)
+		copy(event, data[:end])
+		s.buf.Next(end + 2)
+
+		if err := readEvents(bytes.NewReader(event), func(_ string, data []byte) error {
+			return s.handle(data)
+		}); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close finishes the message, in case the upstream stream ended without
+// [DONE].
+func (s *MessagesStream) Close() error {
+	return s.finish()
+}
+
+func (s *MessagesStream) handle(data []byte) error {
+	if s.closed {
+		return nil
+	}
+	if string(data) == "[DONE]" {
+		return s.finish()
+	}
+
+	var chunk struct {
+		chatCompletion
+		Error *struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return err
+	}
+	if chunk.Error != nil {
+		s.closed = true
+		return s.emit("error", messagesError("api_error", chunk.Error.Message))
+	}
+
+	if !s.started {
+		s.started = true
+		err := s.emit("message_start", map[string]any{
+			"type": "message_start",
+			"message": messagesResponse{
+				ID:      chunk.ID,
+				Type:    "message",
+				Role:    "assistant",
+				Model:   chunk.Model,
+				Content: []anthropicBlock{},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if chunk.Usage != nil {
+		s.usage = anthropicUsage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+
+	choice := chunk.Choices[0]
+	if delta := choice.Delta; delta != nil {
+		if delta.Content != nil && *delta.Content != "" {
+			if err := s.startBlock("text", anthropicBlock{Type: "text"}); err != nil {
+				return err
+			}
+			if err := s.delta(map[string]string{"type": "text_delta", "text": *delta.Content}); err != nil {
+				return err
+			}
+		}
+		for _, call := range delta.ToolCalls {
+			index := 0
+			if call.Index != nil {
+				index = *call.Index
+			}
+			if _, ok := s.tools[index]; !ok {
+				s.tools[index] = s.blocks
+				block := anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: json.RawMessage("{}")}
+				if err := s.startBlock("tool_use", block); err != nil {
+					return err
+				}
+			}
+			if call.Function.Arguments != "" && s.tools[index] == s.block {
+				if err := s.delta(map[string]string{"type": "input_json_delta", "partial_json": call.Function.Arguments}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if choice.FinishReason != nil {
+		s.stopReason = messagesStopReason(*choice.FinishReason)
+		return s.stopBlock()
+	}
+	return nil
+}
+
+// startBlock opens a new content block unless one of the same text type is
+// already open. Tool use blocks always start a new block.
+func (s *MessagesStream) startBlock(blockType string, block anthropicBlock) error {
+	if s.block >= 0 && blockType == "text" && s.blockType == "text" {
+		return nil
+	}
+	if err := s.stopBlock(); err != nil {
+		return err
+	}
+	s.block, s.blockType = s.blocks, blockType
+	s.blocks++
+	if blockType == "text" {
+		// The text field must be present, even if empty.
+		return s.emit("content_block_start", map[string]any{
+			"type":          "content_block_start",
+			"index":         s.block,
+			"content_block": map[string]string{"type": "text", "text": ""},
+		})
+	}
+	return s.emit("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         s.block,
+		"content_block": block,
+	})
+}
+
+func (s *MessagesStream) stopBlock() error {
+	if s.block < 0 {
+		return nil
+	}
+	index := s.block
+	s.block, s.blockType = -1, ""
+	return s.emit("content_block_stop", map[string]any{"type": "content_block_stop", "index": index})
+}
+
+func (s *MessagesStream) delta(delta any) error {
+	return s.emit("content_block_delta", map[string]any{"type": "content_block_delta", "index": s.block, "delta": delta})
+}
+
+func (s *MessagesStream) finish() error {
+	if s.closed || !s.started {
+		return nil
+	}
+	s.closed = true
+	if err := s.stopBlock(); err != nil {
+		return err
+	}
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	err := s.emit("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": s.usage,
+	})
+	if err != nil {
+		return err
+	}
+	return s.emit("message_stop", map[string]string{"type": "message_stop"})
+}
+
+func (s *MessagesStream) emit(event string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
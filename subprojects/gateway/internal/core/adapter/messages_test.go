@@ -0,0 +1,178 @@
+package adapter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessagesToChat(t *testing.T) {
+	body := `{
+		"model": "claude-3-5-sonnet",
+		"system": [{"type": "text", "text": "Be brief."}],
+		"max_tokens": 100,
+		"stop_sequences": ["END"],
+		"stream": true,
+		"messages": [
+			{"role": "user", "content": "Weather?"},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "tu_1", "name": "weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "tu_1", "content": [{"type": "text", "text": "Sunny"}]},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "aGk="}}
+			]}
+		],
+		"tools": [{"name": "weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"},
+		"metadata": {"user_id": "u1"}
+	}`
+
+	out, err := MessagesToChat([]byte(body))
+	if err != nil {
+		t.Fatalf("MessagesToChat failed: %v", err)
+	}
+	var chat chatRequest
+	if err := json.Unmarshal(out, &chat); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+
+	if chat.Model != "claude-3-5-sonnet" || !chat.Stream || chat.User != "u1" {
+		t.Errorf("unexpected request %s", out)
+	}
+	if !strings.Contains(string(out), `"stream_options":{"include_usage":true}`) {
+		t.Errorf("expected usage to be requested for streams, got %s", out)
+	}
+	if maxTokens, ok := chat.maxTokens(); !ok || maxTokens != 100 {
+		t.Errorf("unexpected max tokens %d", maxTokens)
+	}
+	if stop := chat.stopSequences(); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("unexpected stop %v", stop)
+	}
+
+	roles := make([]string, len(chat.Messages))
+	for i, m := range chat.Messages {
+		roles[i] = m.Role
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,user" {
+		t.Fatalf("unexpected roles %s", got)
+	}
+	if call := chat.Messages[2].ToolCalls[0]; call.ID != "tu_1" || call.Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+	if m := chat.Messages[3]; m.ToolCallID != "tu_1" || m.text() != "Sunny" {
+		t.Errorf("unexpected tool message %+v", m)
+	}
+	if parts := chat.Messages[4].parts(); len(parts) != 1 || parts[0].ImageURL.URL != "data:image/png;base64,aGk=" {
+		t.Errorf("unexpected image parts %+v", parts)
+	}
+	if mode, _ := chat.toolChoice(); mode != "required" {
+		t.Errorf("unexpected tool choice %s", mode)
+	}
+}
+
+func TestMessagesToChatRejectsUnknownBlocks(t *testing.T) {
+	body := `{"model": "m", "messages": [{"role": "user", "content": [{"type": "document"}]}]}`
+	if _, err := MessagesToChat([]byte(body)); err == nil {
+		t.Error("expected an error for an unsupported content block")
+	}
+}
+
+func TestChatToMessages(t *testing.T) {
+	body := `{
+		"id": "chatcmpl-1",
+		"model": "gpt-4o",
+		"choices": [{"message": {"role": "assistant", "content": "Let me check.", "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"Paris\"}"}}
+		]}, "finish_reason": "tool_calls"}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	}`
+
+	out, err := ChatToMessages([]byte(body))
+	if err != nil {
+		t.Fatalf("ChatToMessages failed: %v", err)
+	}
+	var msg messagesResponse
+	if err := json.Unmarshal(out, &msg); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if msg.Type != "message" || msg.Role != "assistant" || msg.Model != "gpt-4o" {
+		t.Errorf("unexpected message %s", out)
+	}
+	if len(msg.Content) != 2 || msg.Content[0].Text != "Let me check." || string(msg.Content[1].Input) != `{"city":"Paris"}` {
+		t.Errorf("unexpected content %+v", msg.Content)
+	}
+	if msg.StopReason == nil || *msg.StopReason != "tool_use" {
+		t.Errorf("unexpected stop reason %v", msg.StopReason)
+	}
+	if msg.Usage.InputTokens != 10 || msg.Usage.OutputTokens != 5 {
+		t.Errorf("unexpected usage %+v", msg.Usage)
+	}
+}
+
+func TestMessagesError(t *testing.T) {
+	out := MessagesError(429, []byte(`{"error": {"message": "slow down", "type": "rate_limit"}}`))
+	if string(out) != `{"error":{"message":"slow down","type":"rate_limit_error"},"type":"error"}` {
+		t.Errorf("unexpected error body %s", out)
+	}
+	out = MessagesError(403, []byte("Forbidden: access to model denied\n"))
+	if !strings.Contains(string(out), `"type":"permission_error"`) || !strings.Contains(string(out), `"message":"Forbidden: access to model denied"`) {
+		t.Errorf("unexpected error body %s", out)
+	}
+}
+
+func TestMessagesStream(t *testing.T) {
+	chunks := []string{
+		`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{}"}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+		`[DONE]`,
+	}
+	var upstream strings.Builder
+	for _, c := range chunks {
+		upstream.WriteString("data: " + c + "\n\n")
+	}
+
+	var out strings.Builder
+	stream := NewMessagesStream(&out)
+	// Write in small pieces to exercise events split across writes.
+	data := upstream.String()
+	for len(data) > 0 {
+		n := min(7, len(data))
+		if _, err := stream.Write([]byte(data[:n])); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		data = data[n:]
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	var events []string
+	var last map[string]any
+	readEvents(strings.NewReader(out.String()), func(event string, data []byte) error {
+		events = append(events, event)
+		if event == "message_delta" {
+			json.Unmarshal(data, &last)
+		}
+		return nil
+	})
+
+	want := "message_start,content_block_start,content_block_delta,content_block_stop," +
+		"content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"
+	if got := strings.Join(events, ","); got != want {
+		t.Fatalf("events = %s, want %s\n%s", got, want, out.String())
+	}
+	if !strings.Contains(out.String(), `"partial_json":"{}"`) {
+		t.Errorf("expected the tool input as a JSON delta, got %s", out.String())
+	}
+	delta := last["delta"].(map[string]any)
+	usage := last["usage"].(map[string]any)
+	if delta["stop_reason"] != "tool_use" || usage["output_tokens"] != float64(2) {
+		t.Errorf("unexpected message_delta %v", last)
+	}
+}
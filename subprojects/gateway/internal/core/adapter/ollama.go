@@ -0,0 +1,369 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ollama is the adapter for the native Ollama API.
+type ollama struct {
+	cfg config.Provider
+}
+
+func newOllama(p config.Provider) *ollama {
+	return &ollama{cfg: p}
+}
+
+// ollamaRequest is an /api/chat request.
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"`
+	Format    string          `json:"format,omitempty"`
+	Tools     []chatTool      `json:"tools,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaResponse is an /api/chat response or a line of a streamed one.
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// NewRequest translates a chat completion into an /api/chat request. The
+// non-OpenAI fields keep_alive and options are passed through.
+func (o *ollama) NewRequest(path string, query url.Values, body []byte) (*Request, error) {
+	if path != "/v1/chat/completions" {
+		return nil, ErrUnsupportedEndpoint
+	}
+
+	var chat chatRequest
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, err
+	}
+	var passthrough struct {
+		KeepAlive json.RawMessage `json:"keep_alive"`
+		Options   map[string]any  `json:"options"`
+	}
+	if err := json.Unmarshal(body, &passthrough); err != nil {
+		return nil, err
+	}
+
+	native, err := o.translateRequest(&chat)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range passthrough.Options {
+		native.Options[key] = value
+	}
+	if len(native.Options) == 0 {
+		native.Options = nil
+	}
+	if len(passthrough.KeepAlive) > 0 {
+		native.KeepAlive = passthrough.KeepAlive
+	}
+
+	out, err := json.Marshal(native)
+	if err != nil {
+		return nil, err
+	}
+	u, err := joinURL(o.cfg.TargetURL, "/api/chat", nil)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	o.Authenticate(header)
+
+	return &Request{
+		Method: http.MethodPost,
+		URL:    u,
+		Header: header,
+		Body:   out,
+		Model:  chat.Model,
+		Stream: chat.Stream,
+	}, nil
+}
+
+func (o *ollama) translateRequest(chat *chatRequest) (*ollamaRequest, error) {
+	req := &ollamaRequest{
+		Model:     chat.Model,
+		Stream:    chat.Stream,
+		Tools:     chat.Tools,
+		Options:   make(map[string]any),
+		KeepAlive: ollamaKeepAlive(o.cfg.Ollama.KeepAlive),
+	}
+	for key, value := range o.cfg.Ollama.Options {
+		req.Options[key] = value
+	}
+	if chat.Temperature != nil {
+		req.Options["temperature"] = *chat.Temperature
+	}
+	if chat.TopP != nil {
+		req.Options["top_p"] = *chat.TopP
+	}
+	if chat.Seed != nil {
+		req.Options["seed"] = *chat.Seed
+	}
+	if maxTokens, ok := chat.maxTokens(); ok {
+		req.Options["num_predict"] = maxTokens
+	}
+	if stop := chat.stopSequences(); len(stop) > 0 {
+		req.Options["stop"] = stop
+	}
+	if chat.ResponseFormat != nil && strings.HasPrefix(chat.ResponseFormat.Type, "json") {
+		req.Format = "json"
+	}
+
+	toolNames := make(map[string]string)
+	for _, m := range chat.Messages {
+		msg := ollamaMessage{Role: m.Role}
+		switch m.Role {
+		case "system", "developer":
+			msg.Role = "system"
+			msg.Content = m.text()
+		case "user":
+			for _, p := range m.parts() {
+				switch p.Type {
+				case "text":
+					msg.Content += p.Text
+				case "image_url":
+					if p.ImageURL == nil {
+						continue
+					}
+					_, data, ok := parseDataURL(p.ImageURL.URL)
+					if !ok {
+						return nil, errors.New("ollama only supports images given as base64 data URLs")
+					}
+					msg.Images = append(msg.Images, data)
+				default:
+					return nil, fmt.Errorf("unsupported content part type '%s'", p.Type)
+				}
+			}
+		case "assistant":
+			msg.Content = m.text()
+			for _, call := range m.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				var tc ollamaToolCall
+				tc.Function.Name = call.Function.Name
+				tc.Function.Arguments = json.RawMessage(call.Function.Arguments)
+				if !json.Valid(tc.Function.Arguments) {
+					tc.Function.Arguments = json.RawMessage("{}")
+				}
+				msg.ToolCalls = append(msg.ToolCalls, tc)
+			}
+		case "tool":
+			msg.Content = m.text()
+			msg.ToolName = m.Name
+			if msg.ToolName == "" {
+				msg.ToolName = toolNames[m.ToolCallID]
+			}
+		default:
+			return nil, fmt.Errorf("unsupported message role '%s'", m.Role)
+		}
+		req.Messages = append(req.Messages, msg)
+	}
+
+	return req, nil
+}
+
+// ollamaKeepAlive encodes a configured keep_alive. Ollama accepts durations
+// as strings but plain numbers, such as -1 for "forever", only as numbers.
+func ollamaKeepAlive(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return json.RawMessage(value)
+	}
+	b, _ := json.Marshal(value)
+	return b
+}
+
+// ollamaFinishReason maps a done reason to an OpenAI finish reason.
+func ollamaFinishReason(native *ollamaResponse, toolCalls bool) string {
+	switch {
+	case toolCalls:
+		return "tool_calls"
+	case native.DoneReason == "length":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+// ModifyResponse translates an /api/chat response or NDJSON stream into a
+// chat completion or SSE chunk stream.
+func (o *ollama) ModifyResponse(resp *http.Response, req *Request) error {
+	if !isSuccess(resp) {
+		return nil
+	}
+	if req.Stream {
+		translateStream(resp, func(src io.Reader, dst io.Writer) error {
+			return translateOllamaStream(src, dst, req.Model)
+		})
+		return nil
+	}
+	return translateBody(resp, func(body []byte) (any, error) {
+		var native ollamaResponse
+		if err := json.Unmarshal(body, &native); err != nil {
+			return nil, err
+		}
+		return ollamaCompletion(&native), nil
+	})
+}
+
+// ollamaToolCalls translates native tool calls, numbering them from firstIndex.
+func ollamaToolCalls(calls []ollamaToolCall, firstIndex int) []toolCall {
+	var out []toolCall
+	for i, call := range calls {
+		out = append(out, toolCall{
+			Index:    ptr(firstIndex + i),
+			ID:       newID("call_"),
+			Type:     "function",
+			Function: functionCall{Name: call.Function.Name, Arguments: arguments(call.Function.Arguments)},
+		})
+	}
+	return out
+}
+
+// ollamaCompletion translates an /api/chat response into a chat completion.
+func ollamaCompletion(native *ollamaResponse) *chatCompletion {
+	message := &responseMessage{Role: "assistant", ToolCalls: ollamaToolCalls(native.Message.ToolCalls, 0)}
+	if native.Message.Content != "" || len(message.ToolCalls) == 0 {
+		message.Content = ptr(native.Message.Content)
+	}
+
+	return &chatCompletion{
+		ID:      newID("chatcmpl-"),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   native.Model,
+		Choices: []chatChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: ptr(ollamaFinishReason(native, len(message.ToolCalls) > 0)),
+		}},
+		Usage: newUsage(native.PromptEvalCount, native.EvalCount),
+	}
+}
+
+// translateOllamaStream translates a newline-delimited JSON stream into chat
+// completion chunks. The final line carries the done reason and token counts.
+func translateOllamaStream(src io.Reader, dst io.Writer, model string) error {
+	out := newChunkWriter(dst, newID("chatcmpl-"), model)
+	if err := out.send(responseMessage{Role: "assistant", Content: ptr("")}, nil, nil); err != nil {
+		return err
+	}
+
+	var calls int
+	err := readLines(src, func(line []byte) error {
+		var native ollamaResponse
+		if err := json.Unmarshal(line, &native); err != nil {
+			return err
+		}
+		if native.Error != "" {
+			out.fail("server_error", native.Error)
+			return fmt.Errorf("upstream stream error: %s", native.Error)
+		}
+
+		toolCalls := ollamaToolCalls(native.Message.ToolCalls, calls)
+		calls += len(toolCalls)
+		if native.Message.Content != "" || len(toolCalls) > 0 {
+			delta := responseMessage{ToolCalls: toolCalls}
+			if native.Message.Content != "" {
+				delta.Content = ptr(native.Message.Content)
+			}
+			if err := out.send(delta, nil, nil); err != nil {
+				return err
+			}
+		}
+		if native.Done {
+			finish := ollamaFinishReason(&native, calls > 0)
+			return out.send(responseMessage{}, &finish, newUsage(native.PromptEvalCount, native.EvalCount))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return out.done()
+}
+
+// Authenticate sets the bearer token, which Ollama itself ignores but which
+// proxies in front of it may require.
+func (o *ollama) Authenticate(header http.Header) {
+	if o.cfg.APIKey == "" {
+		header.Del("Authorization")
+		return
+	}
+	header.Set("Authorization", "Bearer "+o.cfg.APIKey)
+}
+
+// ModelsRequest lists the local models via GET /api/tags.
+func (o *ollama) ModelsRequest(ctx context.Context) (*http.Request, error) {
+	u, err := joinURL(o.cfg.TargetURL, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	o.Authenticate(req.Header)
+	return req, nil
+}
+
+// ParseModels parses an /api/tags response.
+func (o *ollama) ParseModels(body []byte) ([]Model, error) {
+	var tags struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			ModifiedAt time.Time `json:"modified_at"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, len(tags.Models))
+	for i, m := range tags.Models {
+		models[i] = Model{ID: m.Name, Created: m.ModifiedAt.Unix(), OwnedBy: "ollama"}
+	}
+	return models, nil
+}
+
+// Endpoints reports that only chat completions are translated.
+func (o *ollama) Endpoints() []string {
+	return []string{config.EndpointChat}
+}
@@ -0,0 +1,154 @@
+package adapter
+
+import (
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/config"
+	"strings"
+	"testing"
+)
+
+func newTestOllama() *ollama {
+	return newOllama(config.Provider{
+		Name:      "ollama",
+		Type:      config.ProviderTypeOllama,
+		TargetURL: "http://localhost:11434",
+		Ollama: config.Ollama{
+			KeepAlive: "-1",
+			Options:   map[string]any{"num_ctx": 8192, "num_gpu": 1},
+		},
+	})
+}
+
+func TestOllamaNewRequest(t *testing.T) {
+	body := `{
+		"model": "llama3.1:8b",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Describe"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]}
+		],
+		"max_tokens": 64,
+		"options": {"num_ctx": 4096},
+		"keep_alive": "10m"
+	}`
+
+	req, err := newTestOllama().NewRequest("/v1/chat/completions", nil, []byte(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if got := req.URL.String(); got != "http://localhost:11434/api/chat" {
+		t.Errorf("unexpected URL %s", got)
+	}
+
+	var native struct {
+		Stream    *bool           `json:"stream"`
+		KeepAlive string          `json:"keep_alive"`
+		Options   map[string]any  `json:"options"`
+		Messages  []ollamaMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(req.Body, &native); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	// Ollama streams by default, so stream must always be sent.
+	if native.Stream == nil || *native.Stream {
+		t.Errorf("expected stream to be explicitly false")
+	}
+	if native.KeepAlive != "10m" {
+		t.Errorf("expected request keep_alive to win, got %q", native.KeepAlive)
+	}
+	if native.Options["num_ctx"] != float64(4096) || native.Options["num_gpu"] != float64(1) || native.Options["num_predict"] != float64(64) {
+		t.Errorf("unexpected options %v", native.Options)
+	}
+	if len(native.Messages) != 2 || native.Messages[1].Content != "Describe" || len(native.Messages[1].Images) != 1 {
+		t.Errorf("unexpected messages %+v", native.Messages)
+	}
+}
+
+func TestOllamaNewRequestDefaultKeepAlive(t *testing.T) {
+	req, err := newTestOllama().NewRequest("/v1/chat/completions", nil, []byte(`{"model": "llama3.1:8b", "messages": []}`))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if !strings.Contains(string(req.Body), `"keep_alive":-1`) {
+		t.Errorf("expected numeric keep_alive, got %s", req.Body)
+	}
+}
+
+func TestOllamaModifyResponseStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"model":"llama3.1:8b","message":{"role":"assistant","content":"Hel"},"done":false}`,
+		`{"model":"llama3.1:8b","message":{"role":"assistant","content":"lo"},"done":false}`,
+		`{"model":"llama3.1:8b","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":7,"eval_count":2}`,
+	}, "\n")
+	resp := newTestResponse("application/x-ndjson", stream)
+	if err := newTestOllama().ModifyResponse(resp, &Request{Stream: true, Model: "llama3.1:8b"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", ct)
+	}
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading translated stream failed: %v", err)
+	}
+
+	var chunks []chatCompletion
+	readEvents(strings.NewReader(string(out)), func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	if !strings.HasSuffix(string(out), "data: [DONE]\n\n") {
+		t.Error("expected stream to end with [DONE]")
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d: %s", len(chunks), out)
+	}
+	final := chunks[3]
+	if *final.Choices[0].FinishReason != "length" || final.Usage == nil || final.Usage.TotalTokens != 9 {
+		t.Errorf("unexpected final chunk %+v", final)
+	}
+}
+
+func TestOllamaModifyResponse(t *testing.T) {
+	resp := newTestResponse("application/json", `{
+		"model": "llama3.1:8b",
+		"message": {"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "weather", "arguments": {"city": "Paris"}}}]},
+		"done": true,
+		"done_reason": "stop",
+		"prompt_eval_count": 5,
+		"eval_count": 3
+	}`)
+	if err := newTestOllama().ModifyResponse(resp, &Request{Model: "llama3.1:8b"}); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+
+	var completion chatCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	choice := completion.Choices[0]
+	if *choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("unexpected choice %+v", choice)
+	}
+	if completion.Usage.TotalTokens != 8 {
+		t.Errorf("unexpected usage %+v", completion.Usage)
+	}
+}
+
+func TestOllamaParseModels(t *testing.T) {
+	models, err := newTestOllama().ParseModels([]byte(`{"models":[{"name":"llama3.1:8b","modified_at":"2024-08-01T10:00:00.000000000+02:00"}]}`))
+	if err != nil {
+		t.Fatalf("ParseModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "llama3.1:8b" || models[0].OwnedBy != "ollama" || models[0].Created == 0 {
+		t.Errorf("unexpected models %+v", models)
+	}
+}
@@ -0,0 +1,95 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// openAI is the adapter for OpenAI-compatible providers. Requests and
+// responses are passed through unchanged.
+type openAI struct {
+	cfg config.Provider
+}
+
+func newOpenAI(p config.Provider) *openAI {
+	return &openAI{cfg: p}
+}
+
+// NewRequest forwards the request to the same path on the provider.
+func (a *openAI) NewRequest(path string, query url.Values, body []byte) (*Request, error) {
+	u, err := joinURL(a.cfg.TargetURL, path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	json.Unmarshal(body, &req) // Not every endpoint has a JSON body; fields stay empty then.
+
+	header := make(http.Header)
+	a.Authenticate(header)
+	return &Request{
+		Method: http.MethodPost,
+		URL:    u,
+		Header: header,
+		Body:   body,
+		Model:  req.Model,
+		Stream: req.Stream,
+	}, nil
+}
+
+// ModifyResponse leaves the response untouched.
+func (a *openAI) ModifyResponse(resp *http.Response, req *Request) error {
+	return nil
+}
+
+// Authenticate sets the bearer token. Without an API key the header is
+// removed so that the client's own credentials are never forwarded.
+func (a *openAI) Authenticate(header http.Header) {
+	if a.cfg.APIKey == "" {
+		header.Del("Authorization")
+		return
+	}
+	header.Set("Authorization", "Bearer "+a.cfg.APIKey)
+}
+
+// ModelsRequest lists models via GET /v1/models.
+func (a *openAI) ModelsRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(a.cfg.TargetURL, "/")+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	a.Authenticate(req.Header)
+	return req, nil
+}
+
+// ParseModels parses an OpenAI model list.
+func (a *openAI) ParseModels(body []byte) ([]Model, error) {
+	var list struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+			OwnedBy string `json:"owned_by"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, len(list.Data))
+	for i, m := range list.Data {
+		models[i] = Model{ID: m.ID, Created: m.Created, OwnedBy: m.OwnedBy}
+	}
+	return models, nil
+}
+
+// Endpoints reports every endpoint type, as requests are passed through.
+func (a *openAI) Endpoints() []string {
+	return config.Endpoints
+}
@@ -0,0 +1,226 @@
+package adapter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// The types below are the subset of the OpenAI chat completions API that the
+// translating adapters need. Fields the gateway does not translate are
+// deliberately left out.
+
+// chatRequest is an OpenAI chat completion request.
+type chatRequest struct {
+	Model               string          `json:"model"`
+	Messages            []chatMessage   `json:"messages"`
+	Stream              bool            `json:"stream,omitempty"`
+	MaxTokens           *int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	Stop                json.RawMessage `json:"stop,omitempty"`
+	Tools               []chatTool      `json:"tools,omitempty"`
+	ToolChoice          json.RawMessage `json:"tool_choice,omitempty"`
+	ResponseFormat      *responseFormat `json:"response_format,omitempty"`
+	Seed                *int            `json:"seed,omitempty"`
+	User                string          `json:"user,omitempty"`
+}
+
+// responseFormat requests plain text or JSON output.
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+// maxTokens returns the requested output token limit, if any.
+func (r *chatRequest) maxTokens() (int, bool) {
+	if r.MaxCompletionTokens != nil {
+		return *r.MaxCompletionTokens, true
+	}
+	if r.MaxTokens != nil {
+		return *r.MaxTokens, true
+	}
+	return 0, false
+}
+
+// stopSequences returns the stop field, which may be a string or a list.
+func (r *chatRequest) stopSequences() []string {
+	if len(r.Stop) == 0 {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(r.Stop, &single); err == nil {
+		return []string{single}
+	}
+	var list []string
+	json.Unmarshal(r.Stop, &list)
+	return list
+}
+
+// toolChoice returns the tool_choice field as either a mode ("auto", "none",
+// "required") or the name of a forced function.
+func (r *chatRequest) toolChoice() (mode, function string) {
+	if len(r.ToolChoice) == 0 {
+		return "", ""
+	}
+	if err := json.Unmarshal(r.ToolChoice, &mode); err == nil {
+		return mode, ""
+	}
+	var forced struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	json.Unmarshal(r.ToolChoice, &forced)
+	return "function", forced.Function.Name
+}
+
+// chatMessage is a message of an OpenAI chat completion request.
+type chatMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content,omitempty"`
+	ToolCalls  []toolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+	Name       string          `json:"name,omitempty"`
+}
+
+// contentPart is an element of a multi-part message content.
+type contentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// parts returns the message content as a list of parts; plain string content
+// becomes a single text part.
+func (m *chatMessage) parts() []contentPart {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(m.Content, &text); err == nil {
+		return []contentPart{{Type: "text", Text: text}}
+	}
+	var parts []contentPart
+	json.Unmarshal(m.Content, &parts)
+	return parts
+}
+
+// text returns the concatenated text parts of the message content.
+func (m *chatMessage) text() string {
+	var b strings.Builder
+	for _, p := range m.parts() {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+// toolCall is a function call made by the assistant.
+type toolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function functionCall `json:"function"`
+}
+
+// functionCall holds the name and JSON-encoded arguments of a function call.
+type functionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// arguments encodes native function call input as the arguments string of
+// a tool call. Missing or invalid input becomes an empty object.
+func arguments(input json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, input); err != nil {
+		return "{}"
+	}
+	return b.String()
+}
+
+// chatTool is a function the model may call.
+type chatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// chatCompletion is an OpenAI chat completion or, when streaming, a chunk.
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+// chatChoice is a choice of a completion (Message) or of a chunk (Delta).
+type chatChoice struct {
+	Index        int              `json:"index"`
+	Message      *responseMessage `json:"message,omitempty"`
+	Delta        *responseMessage `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+// responseMessage is the assistant message of a completion or a chunk delta.
+type responseMessage struct {
+	Role      string     `json:"role,omitempty"`
+	Content   *string    `json:"content,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+}
+
+// usage is the token usage of a completion.
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// newUsage builds a usage from prompt and completion token counts.
+func newUsage(prompt, completion int) *usage {
+	return &usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// apiError is an OpenAI error body.
+type apiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// newAPIError builds an OpenAI error body.
+func newAPIError(errType, message string) apiError {
+	var e apiError
+	e.Error.Type = errType
+	e.Error.Message = message
+	return e
+}
+
+// newID returns a random identifier with the given prefix, for providers that
+// do not assign their own completion or tool call IDs.
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T {
+	return &v
+}
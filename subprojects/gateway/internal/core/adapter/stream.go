@@ -0,0 +1,181 @@
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxLineSize bounds a single line of a streamed response.
+const maxLineSize = 1 << 20
+
+// readEvents reads server-sent events from r and calls fn with the type and
+// data of every event. Multi-line data is joined with newlines.
+func readEvents(r io.Reader, fn func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	var event string
+	var data bytes.Buffer
+	dispatch := func() error {
+		if data.Len() == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, bytes.TrimSuffix(data.Bytes(), []byte("\n")))
+		event = ""
+		data.Reset()
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case line[0] == ':':
+			// Comment, used as keep-alive.
+		default:
+			field, value, _ := bytes.Cut(line, []byte(":"))
+			value = bytes.TrimPrefix(value, []byte(" "))
+			switch string(field) {
+			case "event":
+				event = string(value)
+			case "data":
+				data.Write(value)
+				data.WriteByte('\n')
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// readLines calls fn for every non-empty line of r, as used by
+// newline-delimited JSON streams.
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// chunkWriter writes OpenAI chat completion chunks as server-sent events.
+type chunkWriter struct {
+	w       io.Writer
+	id      string
+	model   string
+	created int64
+}
+
+// newChunkWriter creates a chunk writer for a completion of the given model.
+func newChunkWriter(w io.Writer, id, model string) *chunkWriter {
+	return &chunkWriter{
+		w:       w,
+		id:      id,
+		model:   model,
+		created: time.Now().Unix(),
+	}
+}
+
+// send writes a chunk with the given delta, finish reason and usage.
+func (c *chunkWriter) send(delta responseMessage, finishReason *string, u *usage) error {
+	return c.write(chatCompletion{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []chatChoice{{Index: 0, Delta: &delta, FinishReason: finishReason}},
+		Usage:   u,
+	})
+}
+
+// fail writes an error event, which ends the stream for OpenAI clients.
+func (c *chunkWriter) fail(errType, message string) error {
+	return c.write(newAPIError(errType, message))
+}
+
+// done writes the terminating [DONE] event.
+func (c *chunkWriter) done() error {
+	_, err := io.WriteString(c.w, "data: [DONE]\n\n")
+	return err
+}
+
+func (c *chunkWriter) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "data: %s\n\n", b)
+	return err
+}
+
+// pipeBody is the translated body of a streamed response. Closing it also
+// closes the upstream body, which stops the translating goroutine.
+type pipeBody struct {
+	*io.PipeReader
+	upstream io.Closer
+}
+
+func (b *pipeBody) Close() error {
+	b.PipeReader.Close()
+	return b.upstream.Close()
+}
+
+// translateStream replaces the body of a streamed response with the output of
+// translate, which consumes the upstream body in a separate goroutine.
+func translateStream(resp *http.Response, translate func(src io.Reader, dst io.Writer) error) {
+	pr, pw := io.Pipe()
+	upstream := resp.Body
+	go func() {
+		pw.CloseWithError(translate(upstream, pw))
+	}()
+
+	resp.Body = &pipeBody{PipeReader: pr, upstream: upstream}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Type", "text/event-stream")
+	resp.Header.Set("Cache-Control", "no-cache")
+}
+
+// translateBody replaces the body of a non-streamed response with the result
+// of translate applied to the full upstream body.
+func translateBody(resp *http.Response, translate func(body []byte) (any, error)) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	translated, err := translate(body)
+	if err != nil {
+		return err
+	}
+	out, err := json.Marshal(translated)
+	if err != nil {
+		return err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(out))
+	resp.ContentLength = int64(len(out))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(out)))
+	resp.Header.Set("Content-Type", "application/json")
+	return nil
+}
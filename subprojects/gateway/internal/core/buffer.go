@@ -0,0 +1,54 @@
+package core
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// ResponseBuffer is an http.ResponseWriter that keeps the response in memory,
+// for requests the gateway sends through its own handlers, such as those of
+// batches and asynchronous jobs.
+type ResponseBuffer struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+// NewResponseBuffer returns an empty ResponseBuffer.
+func NewResponseBuffer() *ResponseBuffer {
+	return &ResponseBuffer{header: make(http.Header)}
+}
+
+func (b *ResponseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *ResponseBuffer) WriteHeader(statusCode int) {
+	if b.statusCode == 0 {
+		b.statusCode = statusCode
+	}
+}
+
+func (b *ResponseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// StatusCode returns the status code of the response, which is 200 if the
+// handler wrote none.
+func (b *ResponseBuffer) StatusCode() int {
+	b.WriteHeader(http.StatusOK)
+	return b.statusCode
+}
+
+// Body returns the body written so far.
+func (b *ResponseBuffer) Body() []byte {
+	return b.body.Bytes()
+}
+
+// response returns the buffered response, ready to be relayed.
+func (b *ResponseBuffer) response() *upstreamResponse {
+	header := b.header.Clone()
+	header.Del("Content-Length")
+	return &upstreamResponse{statusCode: b.StatusCode(), header: header, body: b.Body()}
+}
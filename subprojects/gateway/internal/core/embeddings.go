@@ -0,0 +1,303 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults of the embedding batcher.
+const (
+	defaultEmbeddingBatchWindow    = 10 * time.Millisecond
+	defaultEmbeddingBatchMaxInputs = 256
+)
+
+// errMismatchedEmbeddings is returned when a batch response does not hold
+// exactly one embedding per input.
+var errMismatchedEmbeddings = errors.New("embeddings response does not match the batch inputs")
+
+// EmbeddingBatcher coalesces embedding requests that only differ in their
+// input into a single upstream request and splits the result back to the
+// callers. Requests are sent through the proxy, so batches are routed like
+// any other request. Requests with token inputs, or with more inputs than a
+// batch may hold, are proxied unchanged.
+type EmbeddingBatcher struct {
+	proxy     http.Handler
+	window    time.Duration
+	maxInputs int
+
+	mu      sync.Mutex
+	pending map[string]*embeddingBatch
+}
+
+// embeddingBatch collects the calls waiting for the same upstream request.
+type embeddingBatch struct {
+	// params are the request fields other than input, shared by all calls.
+	params map[string]json.RawMessage
+	inputs []json.RawMessage
+	calls  []*embeddingCall
+	timer  *time.Timer
+}
+
+// embeddingCall is a single client request within a batch.
+type embeddingCall struct {
+	body   []byte
+	offset int
+	count  int
+	result chan *upstreamResponse
+}
+
+// NewEmbeddingBatcher creates a batcher sending its batches through proxy.
+func NewEmbeddingBatcher(proxy http.Handler, cfg config.EmbeddingBatching) *EmbeddingBatcher {
+	b := &EmbeddingBatcher{
+		proxy:     proxy,
+		window:    cfg.Window,
+		maxInputs: cfg.MaxInputs,
+		pending:   make(map[string]*embeddingBatch),
+	}
+	if b.window <= 0 {
+		b.window = defaultEmbeddingBatchWindow
+	}
+	if b.maxInputs <= 0 {
+		b.maxInputs = defaultEmbeddingBatchMaxInputs
+	}
+	return b
+}
+
+// ServeHTTP adds the request to a batch and writes its share of the result.
+func (b *EmbeddingBatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+	r.Body.Close()
+
+	params, inputs, ok := parseEmbeddingRequest(body)
+	if !ok || len(inputs) > b.maxInputs {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		b.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	call := &embeddingCall{body: body, count: len(inputs), result: make(chan *upstreamResponse, 1)}
+	b.add(params, inputs, call)
+
+	select {
+	case resp := <-call.result:
+		writeUpstreamResponse(w, resp)
+	case <-r.Context().Done():
+		// The batch still completes for the other callers.
+	}
+}
+
+// parseEmbeddingRequest splits a request into its input strings and the
+// remaining fields. It fails for inputs other than a string or a list of
+// strings, such as token arrays.
+func parseEmbeddingRequest(body []byte) (map[string]json.RawMessage, []json.RawMessage, bool) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, nil, false
+	}
+	input, ok := params["input"]
+	if !ok {
+		return nil, nil, false
+	}
+	delete(params, "input")
+
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return params, []json.RawMessage{input}, true
+	}
+	var texts []string
+	if err := json.Unmarshal(input, &texts); err != nil || len(texts) == 0 {
+		return nil, nil, false
+	}
+	inputs := make([]json.RawMessage, len(texts))
+	for i, t := range texts {
+		inputs[i], _ = json.Marshal(t)
+	}
+	return params, inputs, true
+}
+
+// add appends a call to the pending batch of its parameters, sending the
+// batch first if the call would not fit and afterwards if it is full.
+func (b *EmbeddingBatcher) add(params map[string]json.RawMessage, inputs []json.RawMessage, call *embeddingCall) {
+	// Maps are marshaled with sorted keys, so equal parameters give equal keys.
+	keyBytes, _ := json.Marshal(params)
+	key := string(keyBytes)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch := b.pending[key]
+	if batch != nil && len(batch.inputs)+len(inputs) > b.maxInputs {
+		b.dispatchLocked(key, batch)
+		batch = nil
+	}
+	if batch == nil {
+		batch = &embeddingBatch{params: params}
+		b.pending[key] = batch
+		batch.timer = time.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.pending[key] == batch {
+				b.dispatchLocked(key, batch)
+			}
+		})
+	}
+
+	call.offset = len(batch.inputs)
+	batch.inputs = append(batch.inputs, inputs...)
+	batch.calls = append(batch.calls, call)
+	if len(batch.inputs) >= b.maxInputs {
+		b.dispatchLocked(key, batch)
+	}
+}
+
+// dispatchLocked removes a batch from the pending ones and sends it. The
+// caller must hold b.mu.
+func (b *EmbeddingBatcher) dispatchLocked(key string, batch *embeddingBatch) {
+	batch.timer.Stop()
+	delete(b.pending, key)
+	go b.send(batch)
+}
+
+// send proxies a batch and hands every call its part of the result.
+func (b *EmbeddingBatcher) send(batch *embeddingBatch) {
+	// A lone call is sent as it came in.
+	body := batch.calls[0].body
+	if len(batch.calls) > 1 {
+		params := make(map[string]json.RawMessage, len(batch.params)+1)
+		for k, v := range batch.params {
+			params[k] = v
+		}
+		params["input"], _ = json.Marshal(batch.inputs)
+		body, _ = json.Marshal(params)
+	}
+
+	// The batch outlives any single caller, so it is not bound to their contexts.
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		b.fail(batch, http.StatusInternalServerError, "Failed to create batch request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := NewResponseBuffer()
+	b.proxy.ServeHTTP(rec, req)
+	resp := rec.response()
+
+	if len(batch.calls) == 1 {
+		batch.calls[0].result <- resp
+		return
+	}
+	if resp.statusCode >= 300 {
+		for _, call := range batch.calls {
+			call.result <- resp
+		}
+		return
+	}
+
+	results, err := splitEmbeddings(resp, batch)
+	if err != nil {
+		logrus.WithField("inputs", len(batch.inputs)).Errorf("Failed to split embedding batch: %v", err)
+		b.fail(batch, http.StatusBadGateway, "Invalid embeddings response from provider")
+		return
+	}
+	for i, call := range batch.calls {
+		call.result <- results[i]
+	}
+}
+
+// fail answers every call of a batch with the same error.
+func (b *EmbeddingBatcher) fail(batch *embeddingBatch, status int, message string) {
+	header := make(http.Header)
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp := &upstreamResponse{statusCode: status, header: header, body: []byte(message + "\n")}
+	for _, call := range batch.calls {
+		call.result <- resp
+	}
+}
+
+// embeddingList is an embeddings response; the embeddings are kept raw so
+// that both float and base64 encodings pass through.
+type embeddingList struct {
+	Object string           `json:"object"`
+	Data   []embeddingEntry `json:"data"`
+	Model  string           `json:"model"`
+	Usage  *embeddingUsage  `json:"usage,omitempty"`
+}
+
+type embeddingEntry struct {
+	Object    string          `json:"object"`
+	Embedding json.RawMessage `json:"embedding"`
+	Index     int             `json:"index"`
+}
+
+type embeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// splitEmbeddings splits a batch response into one response per call. The
+// usage of the batch is shared out in proportion to the number of inputs.
+func splitEmbeddings(resp *upstreamResponse, batch *embeddingBatch) ([]*upstreamResponse, error) {
+	var list embeddingList
+	if err := json.Unmarshal(resp.body, &list); err != nil {
+		return nil, err
+	}
+	byIndex := make(map[int]embeddingEntry, len(list.Data))
+	for _, entry := range list.Data {
+		byIndex[entry.Index] = entry
+	}
+	if len(byIndex) != len(batch.inputs) {
+		return nil, errMismatchedEmbeddings
+	}
+
+	header := resp.header.Clone()
+	header.Set("Content-Type", "application/json")
+
+	results := make([]*upstreamResponse, len(batch.calls))
+	var promptTokens, totalTokens int
+	for i, call := range batch.calls {
+		part := embeddingList{Object: list.Object, Model: list.Model, Data: make([]embeddingEntry, call.count)}
+		for j := range call.count {
+			entry, ok := byIndex[call.offset+j]
+			if !ok {
+				return nil, errMismatchedEmbeddings
+			}
+			entry.Index = j
+			part.Data[j] = entry
+		}
+
+		if list.Usage != nil {
+			part.Usage = &embeddingUsage{}
+			if i == len(batch.calls)-1 {
+				// The last call takes the remainder, so the parts add up.
+				part.Usage.PromptTokens = list.Usage.PromptTokens - promptTokens
+				part.Usage.TotalTokens = list.Usage.TotalTokens - totalTokens
+			} else {
+				part.Usage.PromptTokens = list.Usage.PromptTokens * call.count / len(batch.inputs)
+				part.Usage.TotalTokens = list.Usage.TotalTokens * call.count / len(batch.inputs)
+			}
+			promptTokens += part.Usage.PromptTokens
+			totalTokens += part.Usage.TotalTokens
+		}
+
+		body, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = &upstreamResponse{statusCode: resp.statusCode, header: header, body: body}
+	}
+	return results, nil
+}
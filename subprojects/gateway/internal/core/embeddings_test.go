@@ -0,0 +1,125 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// embeddingsStub answers embedding requests with one embedding per input,
+// whose single value is the length of the input.
+func embeddingsStub(t *testing.T, calls *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected upstream body: %v", err)
+		}
+		list := embeddingList{Object: "list", Model: "text-embedding-3-small", Usage: &embeddingUsage{PromptTokens: 10, TotalTokens: 10}}
+		for i, input := range req.Input {
+			list.Data = append(list.Data, embeddingEntry{Object: "embedding", Embedding: json.RawMessage(fmt.Sprintf("[%d]", len(input))), Index: i})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+func TestEmbeddingBatcherCoalescesRequests(t *testing.T) {
+	var calls atomic.Int32
+	batcher := NewEmbeddingBatcher(embeddingsStub(t, &calls), config.EmbeddingBatching{Window: 50 * time.Millisecond})
+
+	inputs := []string{`"a"`, `["bb", "ccc"]`, `"dddd"`}
+	results := make([]embeddingList, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"model": "openai/text-embedding-3-small", "input": ` + input + `}`
+			rec := httptest.NewRecorder()
+			batcher.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Errorf("unexpected status %d: %s", rec.Code, rec.Body)
+			}
+			json.Unmarshal(rec.Body.Bytes(), &results[i])
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", n)
+	}
+	if got := results[1]; len(got.Data) != 2 || string(got.Data[0].Embedding) != "[2]" || got.Data[1].Index != 1 || string(got.Data[1].Embedding) != "[3]" {
+		t.Errorf("unexpected result %+v", got)
+	}
+	if got := results[2]; len(got.Data) != 1 || string(got.Data[0].Embedding) != "[4]" || got.Data[0].Index != 0 {
+		t.Errorf("unexpected result %+v", got)
+	}
+
+	var promptTokens int
+	for _, r := range results {
+		promptTokens += r.Usage.PromptTokens
+	}
+	if promptTokens != 10 {
+		t.Errorf("expected the usage parts to add up to 10, got %d", promptTokens)
+	}
+}
+
+func TestEmbeddingBatcherSendsFullBatches(t *testing.T) {
+	var calls atomic.Int32
+	batcher := NewEmbeddingBatcher(embeddingsStub(t, &calls), config.EmbeddingBatching{Window: time.Hour, MaxInputs: 2})
+
+	rec := httptest.NewRecorder()
+	body := `{"model": "m", "input": ["a", "b"]}`
+	batcher.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || calls.Load() != 1 {
+		t.Errorf("expected a full batch to be sent without waiting, got %d after %d calls", rec.Code, calls.Load())
+	}
+}
+
+func TestEmbeddingBatcherRelaysErrors(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "bad"}}`, http.StatusBadRequest)
+	})
+	batcher := NewEmbeddingBatcher(upstream, config.EmbeddingBatching{Window: 20 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			batcher.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model": "m", "input": "a"}`)))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "bad") {
+				t.Errorf("unexpected response %d: %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEmbeddingBatcherPassesTokenInputsThrough(t *testing.T) {
+	var body string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{}`))
+	})
+	batcher := NewEmbeddingBatcher(upstream, config.EmbeddingBatching{Window: time.Hour})
+
+	rec := httptest.NewRecorder()
+	batcher.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model": "m", "input": [1, 2, 3]}`)))
+	if rec.Code != http.StatusOK || body != `{"model": "m", "input": [1, 2, 3]}` {
+		t.Errorf("expected the request to be proxied unchanged, got %d with body %s", rec.Code, body)
+	}
+}
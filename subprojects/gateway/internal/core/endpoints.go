@@ -0,0 +1,54 @@
+package core
+
+import (
+	"llm-gateway/internal/config"
+	"slices"
+	"strings"
+)
+
+// inferEndpoints guesses the endpoint types of a model from its name, for
+// providers whose model list does not tell. Models that are not recognizably
+// specialized are assumed to be text generation models.
+func inferEndpoints(modelID string) []string {
+	id := strings.ToLower(modelID)
+	switch {
+	case strings.Contains(id, "rerank"):
+		return []string{config.EndpointRerank}
+	case strings.Contains(id, "embed"):
+		return []string{config.EndpointEmbeddings}
+	case strings.Contains(id, "moderation"):
+		return []string{config.EndpointModerations}
+	case strings.Contains(id, "whisper") || strings.Contains(id, "transcribe"):
+		return []string{config.EndpointTranscriptions}
+	case strings.HasPrefix(id, "tts") || strings.Contains(id, "-tts"):
+		return []string{config.EndpointSpeech}
+	case strings.HasPrefix(id, "dall-e") || strings.HasPrefix(id, "gpt-image") || strings.Contains(id, "imagen") || strings.Contains(id, "stable-diffusion"):
+		return []string{config.EndpointImages}
+	case strings.HasPrefix(id, "babbage") || strings.HasPrefix(id, "davinci") || strings.HasPrefix(id, "gpt-3.5-turbo-instruct"):
+		return []string{config.EndpointCompletions}
+	default:
+		return []string{config.EndpointChat, config.EndpointCompletions}
+	}
+}
+
+// modelEndpoints returns the endpoint types of a listed model: those
+// configured for it, or else those reported by the provider or inferred from
+// its name, limited to what the provider's adapter can serve. inferred
+// reports whether they were guessed from the name.
+func modelEndpoints(configured, reported []string, modelID string, served []string) (endpoints []string, inferred bool) {
+	if len(configured) > 0 {
+		return configured, false
+	}
+	endpoints = reported
+	if endpoints == nil {
+		endpoints = inferEndpoints(modelID)
+		inferred = true
+	}
+	supported := []string{}
+	for _, endpoint := range endpoints {
+		if slices.Contains(served, endpoint) {
+			supported = append(supported, endpoint)
+		}
+	}
+	return supported, inferred
+}
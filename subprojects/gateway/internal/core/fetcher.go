@@ -1,12 +1,13 @@
 package core
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"llm-gateway/internal/config"
 	"llm-gateway/internal/core/provider"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -57,7 +58,12 @@ func (mf *ModelFetcher) Stop() {
 
 func (mf *ModelFetcher) fetchAllModels() {
 	logrus.Println("Fetching models from all providers...")
-	providers := mf.providerManager.GetAllProviderConfigs()
+	mf.Fetch(mf.providerManager.GetAllProviderConfigs())
+}
+
+// Fetch fetches the models of the enabled providers among providers right
+// away, rather than at the next refresh, and waits for it to finish.
+func (mf *ModelFetcher) Fetch(providers []config.Provider) {
 	var wg sync.WaitGroup
 	for _, p := range providers {
 		if p.Enabled {
@@ -78,15 +84,16 @@ func (mf *ModelFetcher) fetchModelsForProvider(p config.Provider) {
 		return
 	}
 
-	req, err := http.NewRequest("GET", p.TargetURL+"/v1/models", nil)
-	if err != nil {
-		logrus.Printf("Error creating request for provider %s: %v", p.Name, err)
+	providerAdapter := mf.providerManager.GetAdapter(p.Name)
+	if providerAdapter == nil {
+		logrus.Printf("Failed to get adapter for provider: %s", p.Name)
 		return
 	}
 
-	// Add API key if it exists
-	if p.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req, err := providerAdapter.ModelsRequest(context.Background())
+	if err != nil {
+		logrus.Printf("Error creating request for provider %s: %v", p.Name, err)
+		return
 	}
 
 	resp, err := client.Do(req)
@@ -107,24 +114,38 @@ func (mf *ModelFetcher) fetchModelsForProvider(p config.Provider) {
 		return
 	}
 
-	var providerModelsList ProviderModelsList
-	if err := json.Unmarshal(body, &providerModelsList); err != nil {
+	models, err := providerAdapter.ParseModels(body)
+	if err != nil {
 		logrus.Printf("Error unmarshaling models from provider %s: %v", p.Name, err)
 		return
 	}
 
-	// Namespace the models and update the cache
-	namespacedModels := make([]Model, len(providerModelsList.Data))
-	for i, m := range providerModelsList.Data {
+	// Configured models may be named with or without the provider namespace.
+	configured := make(map[string][]string, len(p.Models))
+	for _, m := range p.Models {
+		configured[strings.TrimPrefix(m.Name, p.Name+"/")] = m.Endpoints
+	}
+
+	// Namespace the models, tag their endpoints and update the cache
+	namespacedModels := make([]Model, len(models))
+	for i, m := range models {
+		id := fmt.Sprintf("%s/%s", p.Name, m.ID)
+		endpoints, inferred := modelEndpoints(configured[m.ID], m.Endpoints, m.ID, providerAdapter.Endpoints())
 		namespacedModels[i] = Model{
-			ID:       fmt.Sprintf("%s/%s", p.Name, m.ID),
-			Object:   m.Object,
-			Created:  m.Created,
-			OwnedBy:  m.OwnedBy,
-			Provider: p.Name,
+			ID:                id,
+			Object:            "model",
+			Created:           m.Created,
+			OwnedBy:           m.OwnedBy,
+			Provider:          p.Name,
+			Endpoints:         endpoints,
+			EndpointsInferred: inferred,
 		}
 	}
 
+	// A provider removed while its models were fetched stays out of the cache.
+	if _, ok := mf.providerManager.GetConfig(p.Name); !ok {
+		return
+	}
 	mf.modelsCache.SetModels(p.Name, namespacedModels)
 	logrus.Printf("Successfully fetched and updated %d models for provider: %s", len(namespacedModels), p.Name)
 }
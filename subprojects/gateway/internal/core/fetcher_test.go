@@ -0,0 +1,113 @@
+package core
+
+import (
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/provider"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModelFetcherNamespacesGeminiModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models" || r.Header.Get("x-goog-api-key") != "test-api-key" {
+			t.Errorf("unexpected models request %s with headers %v", r.URL.Path, r.Header)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"models": [{"name": "models/gemini-2.0-flash"}, {"name": "models/text-embedding-004"}]}`))
+	}))
+	defer server.Close()
+
+	pm := provider.NewManager([]config.Provider{{
+		Name: "gemini", Enabled: true, Type: config.ProviderTypeGemini,
+		TargetURL: server.URL, APIKey: "test-api-key", Timeout: 5 * time.Second,
+	}})
+	mc := NewModelsCache()
+	fetcher := NewModelFetcher(pm, mc, time.Hour)
+	fetcher.fetchAllModels()
+
+	models := mc.GetAllModels()
+	if len(models) != 2 {
+		t.Fatalf("expected 2 models, got %+v", models)
+	}
+	if models[0].ID != "gemini/gemini-2.0-flash" || models[0].Provider != "gemini" || models[0].Object != "model" {
+		t.Errorf("unexpected model %+v", models[0])
+	}
+}
+
+func TestModelFetcherSignsBedrockRequests(t *testing.T) {
+	server := sigV4StandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"modelSummaries": [{"modelId": "amazon.titan-text-express-v1", "providerName": "Amazon"}]}`))
+	})
+	defer server.Close()
+
+	pm := provider.NewManager([]config.Provider{sigV4Provider(server.URL)})
+	mc := NewModelsCache()
+	NewModelFetcher(pm, mc, time.Hour).fetchAllModels()
+
+	models := mc.GetAllModels()
+	if len(models) != 1 || models[0].ID != "bedrock/amazon.titan-text-express-v1" {
+		t.Errorf("unexpected models %+v", models)
+	}
+}
+
+func TestModelFetcherTagsEndpoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [{"id": "gpt-4o"}, {"id": "text-embedding-3-small"}, {"id": "bge-reranker-v2"}, {"id": "custom"}]}`))
+	}))
+	defer server.Close()
+
+	pm := provider.NewManager([]config.Provider{{
+		Name: "openai", Enabled: true, TargetURL: server.URL, Timeout: 5 * time.Second,
+		Models: []config.Model{{Name: "openai/custom", Endpoints: []string{config.EndpointModerations}}},
+	}})
+	mc := NewModelsCache()
+	NewModelFetcher(pm, mc, time.Hour).fetchAllModels()
+
+	want := map[string]string{
+		"openai/gpt-4o":                 "chat,completions",
+		"openai/text-embedding-3-small": "embeddings",
+		"openai/bge-reranker-v2":        "rerank",
+		"openai/custom":                 "moderations",
+	}
+	for _, m := range mc.GetAllModels() {
+		if got := strings.Join(m.Endpoints, ","); got != want[m.ID] {
+			t.Errorf("model %s has endpoints %s, want %s", m.ID, got, want[m.ID])
+		}
+	}
+
+	// Tags guessed from the name are not enforced, configured ones are.
+	if _, known := mc.SupportsEndpoint("openai/gpt-4o", config.EndpointImages); known {
+		t.Error("expected the guessed endpoints of gpt-4o not to be known")
+	}
+	if supported, known := mc.SupportsEndpoint("openai/custom", config.EndpointChat); supported || !known {
+		t.Error("expected custom to be known not to support chat")
+	}
+}
+
+func TestModelFetcherLimitsEndpointsToAdapter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models": [
+			{"name": "models/gemini-2.0-flash", "supportedGenerationMethods": ["generateContent", "countTokens"]},
+			{"name": "models/text-embedding-004", "supportedGenerationMethods": ["embedContent"]}
+		]}`))
+	}))
+	defer server.Close()
+
+	pm := provider.NewManager([]config.Provider{{
+		Name: "gemini", Enabled: true, Type: config.ProviderTypeGemini, TargetURL: server.URL, Timeout: 5 * time.Second,
+	}})
+	mc := NewModelsCache()
+	NewModelFetcher(pm, mc, time.Hour).fetchAllModels()
+
+	if supported, known := mc.SupportsEndpoint("gemini/gemini-2.0-flash", config.EndpointChat); !supported || !known {
+		t.Error("expected gemini-2.0-flash to support chat")
+	}
+	// The gemini adapter only translates chat completions.
+	if supported, known := mc.SupportsEndpoint("gemini/text-embedding-004", config.EndpointEmbeddings); supported || !known {
+		t.Error("expected text-embedding-004 not to be served for embeddings")
+	}
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/provider"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+)
+
+// HealthChecker actively probes providers and records the results in the
+// provider manager, so that routing avoids providers that are down.
+type HealthChecker struct {
+	providerManager *provider.Manager
+
+	// mu guards probes, which holds the running probe of every provider
+	// with health checks, by name.
+	mu      sync.Mutex
+	probes  map[string]*probe
+	stopped bool
+}
+
+// probe is the background health check of one provider configuration.
+type probe struct {
+	cfg    config.Provider
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewHealthChecker creates a new health checker.
+func NewHealthChecker(pm *provider.Manager) *HealthChecker {
+	return &HealthChecker{
+		providerManager: pm,
+		probes:          make(map[string]*probe),
+	}
+}
+
+// Start begins probing every enabled provider that has health checks
+// configured, each on its own interval.
+func (hc *HealthChecker) Start() {
+	logrus.Println("Starting health checker...")
+	hc.Reconcile()
+}
+
+// Reconcile matches the running probes to the current provider
+// configurations: providers that were added are probed, and those that were
+// removed or changed stop being probed with their old configuration. The
+// health of a changed provider starts over.
+func (hc *HealthChecker) Reconcile() {
+	current := make(map[string]config.Provider)
+	for _, p := range hc.providerManager.GetAllProviderConfigs() {
+		if p.Enabled && p.HealthCheck.Enabled {
+			current[p.Name] = p
+		}
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.stopped {
+		return
+	}
+	for name, pr := range hc.probes {
+		if p, ok := current[name]; ok && reflect.DeepEqual(p, pr.cfg) {
+			continue
+		}
+		pr.stop()
+		delete(hc.probes, name)
+		// The stopped probe may have recorded a result for the old
+		// configuration after the provider manager was updated.
+		hc.providerManager.ResetHealth(name)
+	}
+	for name, p := range current {
+		if _, ok := hc.probes[name]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		pr := &probe{cfg: p, cancel: cancel, done: make(chan struct{})}
+		hc.probes[name] = pr
+		go hc.run(ctx, pr)
+	}
+}
+
+// Stop halts all probes and waits for them to finish.
+func (hc *HealthChecker) Stop() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.stopped = true
+	for _, pr := range hc.probes {
+		pr.stop()
+	}
+}
+
+// stop cancels the probe and waits for it to return.
+func (pr *probe) stop() {
+	pr.cancel()
+	<-pr.done
+}
+
+func (hc *HealthChecker) run(ctx context.Context, pr *probe) {
+	defer close(pr.done)
+	p := pr.cfg
+
+	interval := p.HealthCheck.Interval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	var successes, failures int
+	for {
+		err := hc.check(ctx, p)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			successes = 0
+			failures++
+			if failures >= max(p.HealthCheck.UnhealthyThreshold, 1) {
+				if healthy {
+					logrus.Warnf("Provider %s is unhealthy: %v", p.Name, err)
+				}
+				healthy = false
+				hc.providerManager.SetHealth(p.Name, false, err.Error())
+			}
+		} else {
+			failures = 0
+			successes++
+			if successes >= max(p.HealthCheck.HealthyThreshold, 1) {
+				if !healthy {
+					logrus.Infof("Provider %s is healthy again", p.Name)
+				}
+				healthy = true
+				hc.providerManager.SetHealth(p.Name, true, "")
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check performs a single probe of the provider. Without a configured path,
+// it requests the provider's model list, wherever its type serves it.
+func (hc *HealthChecker) check(ctx context.Context, p config.Provider) error {
+	client := hc.providerManager.GetClient(p.Name)
+	providerAdapter := hc.providerManager.GetAdapter(p.Name)
+	if client == nil || providerAdapter == nil {
+		return fmt.Errorf("no client for provider %s", p.Name)
+	}
+
+	timeout := p.HealthCheck.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var req *http.Request
+	var err error
+	if p.HealthCheck.Path == "" {
+		req, err = providerAdapter.ModelsRequest(ctx)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(p.TargetURL, "/")+p.HealthCheck.Path, nil)
+		if err == nil {
+			providerAdapter.Authenticate(req.Header)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	expected := p.HealthCheck.ExpectedStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if resp.StatusCode != expected {
+		return fmt.Errorf("unexpected status %d, want %d", resp.StatusCode, expected)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/provider"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerMarksProviders(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("health check requested %s, want /health", r.URL.Path)
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pm := provider.NewManager([]config.Provider{{
+		Name:      "vllm",
+		Enabled:   true,
+		TargetURL: server.URL,
+		Timeout:   time.Second,
+		HealthCheck: config.HealthCheck{
+			Enabled:        true,
+			Interval:       10 * time.Millisecond,
+			Path:           "/health",
+			ExpectedStatus: http.StatusNoContent,
+		},
+	}})
+
+	hc := NewHealthChecker(pm)
+	hc.Start()
+	defer hc.Stop()
+
+	waitFor(t, func() bool { return !pm.Available("vllm") })
+
+	healthy.Store(true)
+	waitFor(t, func() bool { return pm.Available("vllm") })
+}
+
+func TestHealthCheckerReconcile(t *testing.T) {
+	var oldHits, newHits atomic.Int32
+	oldServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oldHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer oldServer.Close()
+	newServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newHits.Add(1)
+	}))
+	defer newServer.Close()
+
+	healthCheck := config.HealthCheck{Enabled: true, Interval: 10 * time.Millisecond, Path: "/health"}
+	pm := provider.NewManager(nil)
+	hc := NewHealthChecker(pm)
+	hc.Start()
+	defer hc.Stop()
+
+	// Providers added after the start are probed.
+	pm.Update([]config.Provider{{Name: "vllm", Enabled: true, TargetURL: oldServer.URL, Timeout: time.Second, HealthCheck: healthCheck}})
+	hc.Reconcile()
+	waitFor(t, func() bool { return !pm.Available("vllm") })
+
+	// Changed providers are probed at their new URL and start over.
+	pm.Update([]config.Provider{{Name: "vllm", Enabled: true, TargetURL: newServer.URL, Timeout: time.Second, HealthCheck: healthCheck}})
+	hc.Reconcile()
+	stale := oldHits.Load()
+	waitFor(t, func() bool { return newHits.Load() > 0 })
+	if !pm.Available("vllm") {
+		t.Error("expected vllm to be healthy at its new URL")
+	}
+
+	// Removed providers are no longer probed.
+	pm.Update(nil)
+	hc.Reconcile()
+	removed := newHits.Load()
+	time.Sleep(50 * time.Millisecond)
+	if oldHits.Load() != stale || newHits.Load() != removed {
+		t.Errorf("expected no more probes, got %d and %d more", oldHits.Load()-stale, newHits.Load()-removed)
+	}
+}
+
+func TestHealthCheckerProbesModelListOfProviderType(t *testing.T) {
+	tests := []struct {
+		providerType, path string
+	}{
+		{config.ProviderTypeAnthropic, "/v1/models"},
+		{config.ProviderTypeGemini, "/v1beta/models"},
+		{config.ProviderTypeAzureOpenAI, "/openai/models"},
+		{config.ProviderTypeOllama, "/api/tags"},
+		{config.ProviderTypeBedrock, "/foundation-models"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.providerType, func(t *testing.T) {
+			var probes atomic.Int32
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				probes.Add(1)
+				if r.URL.Path != tt.path {
+					t.Errorf("health check requested %s, want %s", r.URL.Path, tt.path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}
+			var p config.Provider
+			if tt.providerType == config.ProviderTypeBedrock {
+				// The stand-in rejects probes that are not signed.
+				server := sigV4StandIn(t, handler)
+				defer server.Close()
+				p = sigV4Provider(server.URL)
+			} else {
+				server := httptest.NewServer(http.HandlerFunc(handler))
+				defer server.Close()
+				p = config.Provider{Name: tt.providerType, Enabled: true, Type: tt.providerType, TargetURL: server.URL, Timeout: time.Second}
+			}
+			p.HealthCheck = config.HealthCheck{Enabled: true, Interval: 10 * time.Millisecond}
+
+			pm := provider.NewManager([]config.Provider{p})
+			hc := NewHealthChecker(pm)
+			hc.Start()
+			defer hc.Stop()
+
+			// The result of the first probe is recorded before the second.
+			waitFor(t, func() bool { return probes.Load() >= 2 })
+			if !pm.Available(p.Name) {
+				t.Errorf("expected %s to be healthy", p.Name)
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
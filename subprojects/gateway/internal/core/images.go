@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/upload"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultImageRetention = time.Hour
+	// maxImageDownload bounds the size of an image fetched from an upstream URL.
+	maxImageDownload = 64 << 20
+	// ImageFilesPath is where the gateway serves stored images.
+	ImageFilesPath = "/v1/images/files/"
+)
+
+// ImageStore keeps images converted from b64_json to url in a local
+// directory, and serves them under ImageFilesPath until they expire.
+type ImageStore struct {
+	dir       string
+	baseURL   string
+	retention time.Duration
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewImageStore creates the storage directory if needed.
+func NewImageStore(cfg config.ImageStorage) (*ImageStore, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	s := &ImageStore{
+		dir:       cfg.Dir,
+		baseURL:   strings.TrimSuffix(cfg.BaseURL, "/"),
+		retention: cfg.Retention,
+	}
+	if s.retention <= 0 {
+		s.retention = defaultImageRetention
+	}
+	return s, nil
+}
+
+// Save stores an image under a random name and returns its URL.
+func (s *ImageStore) Save(data []byte) (string, error) {
+	s.sweep()
+
+	var id [16]byte
+	rand.Read(id[:])
+	name := hex.EncodeToString(id[:]) + imageExtension(data)
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0o640); err != nil {
+		return "", err
+	}
+	return s.baseURL + ImageFilesPath + name, nil
+}
+
+// imageExtension returns the file extension matching the image format.
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ".bin"
+	}
+}
+
+// sweep removes expired images, at most once per minute.
+func (s *ImageStore) sweep() {
+	s.mu.Lock()
+	if time.Since(s.lastSweep) < time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = time.Now()
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		logrus.Warnf("Failed to list stored images: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && s.expired(info) {
+			os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+}
+
+func (s *ImageStore) expired(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) > s.retention
+}
+
+// ServeHTTP serves a stored image. The names are unguessable, so the images
+// are served without authentication, like the URLs returned by providers.
+func (s *ImageStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, ImageFilesPath)
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || s.expired(info) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeFile(w, r, path)
+}
+
+// ImageProcessor converts image responses between url and b64_json, so that
+// clients get the format they asked for, or the configured one, whichever
+// format the provider answers with.
+type ImageProcessor struct {
+	next   http.Handler
+	format string
+	store  *ImageStore
+	client *http.Client
+}
+
+// NewImageProcessor wraps next, usually the proxy. Without a store, b64_json
+// images cannot be converted to url and are left as they are.
+func NewImageProcessor(next http.Handler, cfg config.Images, store *ImageStore) *ImageProcessor {
+	return &ImageProcessor{
+		next:   next,
+		format: cfg.ResponseFormat,
+		store:  store,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (p *ImageProcessor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fields, _ := upload.Fields(r)
+	format := p.format
+	if format == "" {
+		format = fields["response_format"]
+	}
+	// Streamed partial images are passed through as they arrive.
+	if fields["stream"] == "true" || (format != config.ImageFormatURL && format != config.ImageFormatB64JSON) {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+
+	buf := NewResponseBuffer()
+	p.next.ServeHTTP(buf, r)
+	resp := buf.response()
+	if resp.statusCode == http.StatusOK {
+		body, err := p.convert(r.Context(), resp.body, format)
+		if err != nil {
+			logrus.Errorf("Failed to convert image response to %s: %v", format, err)
+			http.Error(w, "Failed to convert image response: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.body = body
+	}
+	writeUpstreamResponse(w, resp)
+}
+
+// convert rewrites every image of a response to the given format. Fields
+// other than the images are passed through unchanged.
+func (p *ImageProcessor) convert(ctx context.Context, body []byte, format string) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	var images []map[string]json.RawMessage
+	if err := json.Unmarshal(raw["data"], &images); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for _, image := range images {
+		var url, b64 string
+		json.Unmarshal(image["url"], &url)
+		json.Unmarshal(image["b64_json"], &b64)
+
+		switch {
+		case format == config.ImageFormatB64JSON && b64 == "" && url != "":
+			data, err := p.download(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+			image["b64_json"], _ = json.Marshal(base64.StdEncoding.EncodeToString(data))
+			delete(image, "url")
+		case format == config.ImageFormatURL && url == "" && b64 != "":
+			if p.store == nil {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid b64_json: %w", err)
+			}
+			stored, err := p.store.Save(data)
+			if err != nil {
+				return nil, err
+			}
+			image["url"], _ = json.Marshal(stored)
+			delete(image, "b64_json")
+		default:
+			continue
+		}
+		changed = true
+	}
+	if !changed {
+		return body, nil
+	}
+
+	raw["data"], _ = json.Marshal(images)
+	return json.Marshal(raw)
+}
+
+// download fetches an image from the URL returned by a provider.
+func (p *ImageProcessor) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image download returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageDownload {
+		return nil, errors.New("image download is too large")
+	}
+	return data, nil
+}
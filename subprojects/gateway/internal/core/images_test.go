@@ -0,0 +1,102 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a PNG file for content type detection.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type imageList struct {
+	Created int64 `json:"created"`
+	Data    []struct {
+		URL     string `json:"url"`
+		B64JSON string `json:"b64_json"`
+	} `json:"data"`
+}
+
+func TestImageProcessorConvertsURLToB64(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngHeader)
+	}))
+	defer files.Close()
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"created": 1, "data": [{"url": "` + files.URL + `/a.png", "revised_prompt": "a cat"}]}`))
+	})
+	processor := NewImageProcessor(upstream, config.Images{}, nil)
+
+	rec := httptest.NewRecorder()
+	body := `{"model": "openai/dall-e-3", "prompt": "cat", "response_format": "b64_json"}`
+	processor.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/images/generations", strings.NewReader(body)))
+
+	var list imageList
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Data) != 1 {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body)
+	}
+	if list.Data[0].URL != "" || list.Data[0].B64JSON != base64.StdEncoding.EncodeToString(pngHeader) || list.Created != 1 {
+		t.Errorf("unexpected conversion %+v", list)
+	}
+	if !strings.Contains(rec.Body.String(), "revised_prompt") {
+		t.Errorf("expected other fields to pass through: %s", rec.Body)
+	}
+}
+
+func TestImageProcessorStoresB64AsURL(t *testing.T) {
+	store, err := NewImageStore(config.ImageStorage{Dir: t.TempDir(), BaseURL: "https://gateway.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"created": 1, "data": [{"b64_json": "` + base64.StdEncoding.EncodeToString(pngHeader) + `"}]}`))
+	})
+	processor := NewImageProcessor(upstream, config.Images{ResponseFormat: config.ImageFormatURL}, store)
+
+	rec := httptest.NewRecorder()
+	processor.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/images/generations", strings.NewReader(`{"model": "openai/gpt-image-1"}`)))
+
+	var list imageList
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].B64JSON != "" {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body)
+	}
+	url := list.Data[0].URL
+	path, ok := strings.CutPrefix(url, "https://gateway.example.com")
+	if !ok || !strings.HasPrefix(path, ImageFilesPath) || !strings.HasSuffix(path, ".png") {
+		t.Fatalf("unexpected image URL %q", url)
+	}
+
+	rec = httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != string(pngHeader) || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("unexpected stored image %d (%s)", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	for _, path := range []string{ImageFilesPath + "missing.png", ImageFilesPath + "..%2Fsecret", ImageFilesPath} {
+		rec = httptest.NewRecorder()
+		store.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestImageProcessorPassesThroughWithoutFormat(t *testing.T) {
+	const response = `{"data": [{"url": "https://provider.example.com/a.png"}]}`
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	})
+	processor := NewImageProcessor(upstream, config.Images{}, nil)
+
+	rec := httptest.NewRecorder()
+	processor.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/images/generations", strings.NewReader(`{"model": "openai/dall-e-3"}`)))
+	if rec.Body.String() != response {
+		t.Errorf("expected the response unchanged, got %s", rec.Body)
+	}
+}
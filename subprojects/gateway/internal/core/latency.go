@@ -0,0 +1,49 @@
+package core
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// timedBody wraps a response body to measure the time to its first byte and
+// the total duration of the request, reported once the body is closed.
+type timedBody struct {
+	io.ReadCloser
+	start     time.Time
+	firstByte time.Time
+	onClose   func(ttfb, total time.Duration)
+	once      sync.Once
+}
+
+// newTimedBody creates a timed body for a request started at start.
+func newTimedBody(body io.ReadCloser, start time.Time, onClose func(ttfb, total time.Duration)) *timedBody {
+	return &timedBody{
+		ReadCloser: body,
+		start:      start,
+		onClose:    onClose,
+	}
+}
+
+// Read reads from the wrapped body, noting when the first byte arrives.
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.firstByte.IsZero() {
+		b.firstByte = time.Now()
+	}
+	return n, err
+}
+
+// Close closes the wrapped body and reports the measurements.
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		total := time.Since(b.start)
+		ttfb := total
+		if !b.firstByte.IsZero() {
+			ttfb = b.firstByte.Sub(b.start)
+		}
+		b.onClose(ttfb, total)
+	})
+	return err
+}
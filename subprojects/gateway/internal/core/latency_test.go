@@ -0,0 +1,53 @@
+package core
+
+import (
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyRecordsLatency(t *testing.T) {
+	server := mockProviderServer(t, "test-model", `{"choices": []}`)
+	defer server.Close()
+
+	proxy := newFallbackProxy(config.Provider{Name: "primary", Enabled: true, TargetURL: server.URL, APIKey: "test-api-key", Timeout: 5 * time.Second})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	ttfb, total, ok := proxy.providerManager.Latency("primary")
+	if !ok {
+		t.Fatal("no latency was recorded for the provider")
+	}
+	if ttfb <= 0 || total < ttfb {
+		t.Errorf("unexpected latency: ttfb=%v total=%v", ttfb, total)
+	}
+}
+
+func TestProxyDoesNotRecordLatencyOfErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	proxy := newFallbackProxy(config.Provider{Name: "primary", Enabled: true, TargetURL: server.URL, Timeout: 5 * time.Second})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if _, _, ok := proxy.providerManager.Latency("primary"); ok {
+		t.Error("latency was recorded for an error response")
+	}
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"llm-gateway/internal/config"
+	"slices"
 	"sync"
 )
 
@@ -11,28 +13,21 @@ type Model struct {
 	Object   string `json:"object"`
 	Created  int64  `json:"created"`
 	OwnedBy  string `json:"owned_by"`
-	Provider string `json:"provider"`
+	Provider string `json:"provider,omitempty"`
+	// Endpoints are the endpoint types the model supports.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// EndpointsInferred marks endpoints guessed from the model name, which
+	// are listed but not enforced.
+	EndpointsInferred bool `json:"-"`
 }
 
-// ProviderModel is a temporary struct to unmarshal the response from a downstream provider.
-// It does not include the provider name, as that's added during aggregation.
-type ProviderModel struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	OwnedBy string `json:"owned_by"`
-}
-
-// ProviderModelsList is a temporary struct to unmarshal the list response from a provider.
-type ProviderModelsList struct {
-	Data []ProviderModel `json:"data"`
-}
-
-
 // ModelsCache holds the aggregated list of models from all providers.
 type ModelsCache struct {
-	models map[string][]Model
-	mu     sync.RWMutex
+	models  map[string][]Model
+	aliases []Model
+	// aliasTargets maps alias names to their target models.
+	aliasTargets map[string][]string
+	mu           sync.RWMutex
 }
 
 // NewModelsCache creates a new model cache.
@@ -49,7 +44,46 @@ func (c *ModelsCache) SetModels(providerName string, models []Model) {
 	c.models[providerName] = models
 }
 
-// GetAllModels returns a flattened list of all models from all providers.
+// SetProviders drops the models of providers that are no longer configured
+// or enabled, so that they are not listed anymore. The models of the other
+// providers are kept until they are fetched again.
+func (c *ModelsCache) SetProviders(providers []config.Provider) {
+	enabled := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		enabled[p.Name] = p.Enabled
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.models {
+		if !enabled[name] {
+			delete(c.models, name)
+		}
+	}
+}
+
+// SetAliases sets the configured aliases, which are listed alongside the
+// provider models under their public name.
+func (c *ModelsCache) SetAliases(aliases []config.Alias) {
+	models := make([]Model, len(aliases))
+	targets := make(map[string][]string, len(aliases))
+	for i, a := range aliases {
+		models[i] = Model{
+			ID:      a.Name,
+			Object:  "model",
+			OwnedBy: "gateway",
+		}
+		targets[a.Name] = a.Targets
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.aliases = models
+	c.aliasTargets = targets
+}
+
+// GetAllModels returns a flattened list of all models from all providers,
+// followed by the aliases.
 func (c *ModelsCache) GetAllModels() []Model {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -58,5 +92,41 @@ func (c *ModelsCache) GetAllModels() []Model {
 	for _, providerModels := range c.models {
 		allModels = append(allModels, providerModels...)
 	}
+	allModels = append(allModels, c.aliases...)
 	return allModels
 }
+
+// SupportsEndpoint reports whether the model supports the endpoint type. An
+// alias supports it if any of its targets does. Models that are not cached,
+// were never tagged or whose tags were guessed from their name are reported
+// as unknown, leaving the decision to the provider.
+func (c *ModelsCache) SupportsEndpoint(modelID, endpoint string) (supported, known bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := []string{modelID}
+	if targets, ok := c.aliasTargets[modelID]; ok {
+		ids = targets
+	}
+	for _, id := range ids {
+		if m, ok := c.findLocked(id); ok && m.Endpoints != nil && !m.EndpointsInferred {
+			known = true
+			if slices.Contains(m.Endpoints, endpoint) {
+				return true, true
+			}
+		}
+	}
+	return false, known
+}
+
+// findLocked looks up a provider model. The caller must hold c.mu.
+func (c *ModelsCache) findLocked(id string) (Model, bool) {
+	for _, providerModels := range c.models {
+		for _, m := range providerModels {
+			if m.ID == id {
+				return m, true
+			}
+		}
+	}
+	return Model{}, false
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"llm-gateway/internal/config"
+	"testing"
+)
+
+func TestModelsCacheSupportsEndpoint(t *testing.T) {
+	mc := NewModelsCache()
+	mc.SetModels("openai", []Model{
+		{ID: "openai/gpt-4o", Endpoints: []string{config.EndpointChat}},
+		{ID: "openai/text-embedding-3-small", Endpoints: []string{config.EndpointEmbeddings}},
+		{ID: "openai/untagged"},
+	})
+	mc.SetAliases([]config.Alias{{Name: "embed-default", Targets: []string{"openai/text-embedding-3-small"}}})
+
+	tests := []struct {
+		model, endpoint  string
+		supported, known bool
+	}{
+		{"openai/gpt-4o", config.EndpointChat, true, true},
+		{"openai/gpt-4o", config.EndpointEmbeddings, false, true},
+		{"embed-default", config.EndpointEmbeddings, true, true},
+		{"embed-default", config.EndpointChat, false, true},
+		{"openai/untagged", config.EndpointChat, false, false},
+		{"vllm/llama-3", config.EndpointChat, false, false},
+	}
+	for _, tt := range tests {
+		supported, known := mc.SupportsEndpoint(tt.model, tt.endpoint)
+		if supported != tt.supported || known != tt.known {
+			t.Errorf("SupportsEndpoint(%s, %s) = %v, %v, want %v, %v", tt.model, tt.endpoint, supported, known, tt.supported, tt.known)
+		}
+	}
+}
+
+func TestModelsCacheSetProviders(t *testing.T) {
+	mc := NewModelsCache()
+	mc.SetModels("openai", []Model{{ID: "openai/gpt-4o"}})
+	mc.SetModels("vllm", []Model{{ID: "vllm/llama-3"}})
+	mc.SetModels("azure", []Model{{ID: "azure/gpt-4o"}})
+
+	// vllm is disabled and azure was removed.
+	mc.SetProviders([]config.Provider{{Name: "openai", Enabled: true}, {Name: "vllm"}})
+
+	models := mc.GetAllModels()
+	if len(models) != 1 || models[0].ID != "openai/gpt-4o" {
+		t.Errorf("GetAllModels() = %+v, want only openai/gpt-4o", models)
+	}
+}
@@ -0,0 +1,230 @@
+package provider
+
+import (
+	"llm-gateway/internal/config"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a provider's circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets all traffic through.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all traffic until the open duration has elapsed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a limited number of probes through to test recovery.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultWindowSize       = 20
+	defaultMinRequests      = 10
+	defaultOpenDuration     = 30 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+// BreakerStatus is a snapshot of a circuit breaker.
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	ErrorRate           float64      `json:"error_rate"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// breaker is a circuit breaker tracking consecutive failures and the error
+// rate over a sliding window of the most recent requests.
+type breaker struct {
+	cfg config.CircuitBreaker
+	now func() time.Time
+
+	mu                  sync.Mutex
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	halfOpenInFlight    int
+
+	// outcomes is a ring buffer of recent results; true marks a failure.
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+}
+
+// newBreaker creates a closed breaker, filling in defaults for unset thresholds.
+func newBreaker(cfg config.CircuitBreaker) *breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = defaultWindowSize
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultMinRequests
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = defaultOpenDuration
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = defaultHalfOpenRequests
+	}
+
+	return &breaker{
+		cfg:      cfg,
+		now:      time.Now,
+		state:    BreakerClosed,
+		outcomes: make([]bool, cfg.WindowSize),
+	}
+}
+
+// available reports whether the breaker would currently let a request through,
+// without reserving a probe slot.
+func (b *breaker) available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		return b.now().Sub(b.openedAt) >= b.cfg.OpenDuration
+	case BreakerHalfOpen:
+		return b.halfOpenInFlight < b.cfg.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// allow reports whether a request may be sent. Once the open duration has
+// elapsed it moves the breaker to half-open and reserves a probe slot, which
+// is released by the next call to onSuccess, onFailure or onCanceled.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenDuration {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.halfOpenInFlight = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight >= b.cfg.HalfOpenRequests {
+			return false
+		}
+		b.halfOpenInFlight++
+		return true
+	default:
+		return true
+	}
+}
+
+// onSuccess records a successful request. A successful probe closes the circuit.
+func (b *breaker) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.reset()
+		return
+	}
+	b.consecutiveFailures = 0
+	b.record(false)
+}
+
+// onFailure records a failed request and opens the circuit once a threshold is reached.
+func (b *breaker) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.open()
+		return
+	case BreakerOpen:
+		return
+	}
+
+	b.consecutiveFailures++
+	b.record(true)
+
+	if b.consecutiveFailures >= b.cfg.FailureThreshold {
+		b.open()
+		return
+	}
+	if b.cfg.ErrorRateThreshold > 0 && b.count >= b.cfg.MinRequests && b.errorRate() >= b.cfg.ErrorRateThreshold {
+		b.open()
+	}
+}
+
+// onCanceled releases a probe slot without recording an outcome.
+func (b *breaker) onCanceled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.halfOpenInFlight > 0 {
+		b.halfOpenInFlight--
+	}
+}
+
+// status returns a snapshot of the breaker.
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		ErrorRate:           b.errorRate(),
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
+
+// record adds an outcome to the sliding window. Callers must hold b.mu.
+func (b *breaker) record(failed bool) {
+	if b.count == len(b.outcomes) {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % len(b.outcomes)
+}
+
+// errorRate returns the share of failures in the window. Callers must hold b.mu.
+func (b *breaker) errorRate() float64 {
+	if b.count == 0 {
+		return 0
+	}
+	return float64(b.failures) / float64(b.count)
+}
+
+// open trips the breaker. Callers must hold b.mu.
+func (b *breaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.halfOpenInFlight = 0
+}
+
+// reset closes the breaker and clears its history. Callers must hold b.mu.
+func (b *breaker) reset() {
+	b.state = BreakerClosed
+	b.consecutiveFailures = 0
+	b.halfOpenInFlight = 0
+	b.openedAt = time.Time{}
+	b.next, b.count, b.failures = 0, 0, 0
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+}
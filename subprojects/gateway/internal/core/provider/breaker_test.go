@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"llm-gateway/internal/config"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker driven by a fake clock.
+func newTestBreaker(cfg config.CircuitBreaker) (*breaker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker(cfg)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(config.CircuitBreaker{Enabled: true, FailureThreshold: 3})
+
+	for i := 0; i < 2; i++ {
+		b.onFailure()
+	}
+	if !b.allow() {
+		t.Fatal("breaker opened before reaching the failure threshold")
+	}
+	b.onFailure()
+
+	if got := b.status().State; got != BreakerOpen {
+		t.Fatalf("state = %s, want %s", got, BreakerOpen)
+	}
+	if b.available() || b.allow() {
+		t.Error("open breaker let a request through")
+	}
+}
+
+func TestBreakerOpensOnErrorRate(t *testing.T) {
+	b, _ := newTestBreaker(config.CircuitBreaker{
+		Enabled:            true,
+		FailureThreshold:   100,
+		ErrorRateThreshold: 0.5,
+		WindowSize:         4,
+		MinRequests:        4,
+	})
+
+	b.onSuccess()
+	b.onFailure()
+	b.onSuccess()
+	if got := b.status().State; got != BreakerClosed {
+		t.Fatalf("state = %s before reaching min requests, want %s", got, BreakerClosed)
+	}
+	b.onFailure()
+
+	if got := b.status().State; got != BreakerOpen {
+		t.Fatalf("state = %s, want %s", got, BreakerOpen)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreaker{Enabled: true, FailureThreshold: 1, OpenDuration: time.Minute})
+
+	b.onFailure()
+	*now = now.Add(time.Minute)
+
+	if !b.available() {
+		t.Fatal("breaker should be available once the open duration has elapsed")
+	}
+	if !b.allow() {
+		t.Fatal("breaker should let a probe through")
+	}
+	if b.allow() {
+		t.Fatal("breaker let a second concurrent probe through")
+	}
+
+	// A failed probe re-opens the circuit.
+	b.onFailure()
+	if got := b.status().State; got != BreakerOpen {
+		t.Fatalf("state = %s after failed probe, want %s", got, BreakerOpen)
+	}
+
+	// A successful probe closes it.
+	*now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("breaker should let a probe through")
+	}
+	b.onSuccess()
+	if got := b.status().State; got != BreakerClosed {
+		t.Fatalf("state = %s after successful probe, want %s", got, BreakerClosed)
+	}
+}
+
+func TestBreakerCanceledProbeReleasesSlot(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreaker{Enabled: true, FailureThreshold: 1, OpenDuration: time.Minute})
+
+	b.onFailure()
+	*now = now.Add(time.Minute)
+
+	if !b.allow() {
+		t.Fatal("breaker should let a probe through")
+	}
+	b.onCanceled()
+	if !b.allow() {
+		t.Error("canceled probe did not release its slot")
+	}
+}
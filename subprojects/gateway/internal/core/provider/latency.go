@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyAlpha is the smoothing factor of the latency moving averages. Higher
+// values make the estimates react faster to recent requests.
+const latencyAlpha = 0.3
+
+// LatencyStatus is a snapshot of the observed latency of a provider.
+type LatencyStatus struct {
+	TimeToFirstByteMs float64 `json:"time_to_first_byte_ms"`
+	TotalMs           float64 `json:"total_ms"`
+	Samples           int64   `json:"samples"`
+}
+
+// latencyTracker keeps exponentially weighted moving averages of the time to
+// first byte and the total duration of successful requests.
+type latencyTracker struct {
+	mu      sync.Mutex
+	ttfb    float64
+	total   float64
+	samples int64
+}
+
+func (l *latencyTracker) record(ttfb, total time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.samples == 0 {
+		l.ttfb, l.total = float64(ttfb), float64(total)
+	} else {
+		l.ttfb += latencyAlpha * (float64(ttfb) - l.ttfb)
+		l.total += latencyAlpha * (float64(total) - l.total)
+	}
+	l.samples++
+}
+
+func (l *latencyTracker) get() (ttfb, total time.Duration, samples int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Duration(l.ttfb), time.Duration(l.total), l.samples
+}
+
+func (l *latencyTracker) status() LatencyStatus {
+	ttfb, total, samples := l.get()
+	return LatencyStatus{
+		TimeToFirstByteMs: float64(ttfb) / float64(time.Millisecond),
+		TotalMs:           float64(total) / float64(time.Millisecond),
+		Samples:           samples,
+	}
+}
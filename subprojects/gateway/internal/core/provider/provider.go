@@ -2,29 +2,66 @@ package provider
 
 import (
 	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/adapter"
+	"llm-gateway/internal/core/sigv4"
 	"net/http"
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Manager holds the configuration and clients for all downstream providers.
 type Manager struct {
-	providers map[string]*http.Client
-	configs   map[string]config.Provider
-	mu        sync.RWMutex
+	providers   map[string]*http.Client
+	configs     map[string]config.Provider
+	adapters    map[string]adapter.Adapter
+	breakers    map[string]*breaker
+	health      map[string]*HealthStatus
+	outstanding map[string]*atomic.Int64 // in-flight requests per provider
+	latency     map[string]*latencyTracker
+	mu          sync.RWMutex
+}
+
+// HealthStatus is the result of the most recent active health check of a provider.
+type HealthStatus struct {
+	Healthy     bool      `json:"healthy"`
+	LastChecked time.Time `json:"last_checked"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// Status is a snapshot of the runtime state of a provider.
+type Status struct {
+	Name        string         `json:"name"`
+	Available   bool           `json:"available"`
+	Outstanding int64          `json:"outstanding"`
+	Latency     *LatencyStatus `json:"latency,omitempty"`
+	Health      *HealthStatus  `json:"health,omitempty"`
+	Circuit     *BreakerStatus `json:"circuit,omitempty"`
 }
 
 // NewManager creates and returns a new provider manager.
 func NewManager(providers []config.Provider) *Manager {
 	m := &Manager{
-		providers: make(map[string]*http.Client),
-		configs:   make(map[string]config.Provider),
+		providers:   make(map[string]*http.Client),
+		configs:     make(map[string]config.Provider),
+		adapters:    make(map[string]adapter.Adapter),
+		breakers:    make(map[string]*breaker),
+		health:      make(map[string]*HealthStatus),
+		outstanding: make(map[string]*atomic.Int64),
+		latency:     make(map[string]*latencyTracker),
 	}
 
 	for _, p := range providers {
 		if p.Enabled {
 			m.configs[p.Name] = p
-			m.providers[p.Name] = &http.Client{
-				Timeout: p.Timeout,
+			m.adapters[p.Name] = adapter.New(p)
+			m.providers[p.Name] = newClient(p)
+			m.outstanding[p.Name] = &atomic.Int64{}
+			m.latency[p.Name] = &latencyTracker{}
+			if p.CircuitBreaker.Enabled {
+				m.breakers[p.Name] = newBreaker(p.CircuitBreaker)
 			}
 		}
 	}
@@ -32,6 +69,54 @@ func NewManager(providers []config.Provider) *Manager {
 	return m
 }
 
+// newClient creates the HTTP client of a provider.
+func newClient(p config.Provider) *http.Client {
+	// The transport bounds the wait for response headers so that a hanging
+	// provider fails fast enough for the proxy to fall back, without
+	// cutting off long-running streams.
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = p.Timeout
+	var transport http.RoundTripper = base
+	if p.Auth.Mode == config.AuthModeSigV4 {
+		// Signing at the transport covers proxied requests, model listing
+		// and health checks alike.
+		transport = sigv4.NewTransport(base, sigv4.NewSigner(p.Auth.SigV4))
+	}
+	return &http.Client{
+		Timeout:   p.Timeout,
+		Transport: transport,
+	}
+}
+
+// Update replaces the configuration of all providers at once. Providers that
+// keep their name keep their in-flight counts and latency estimates; their
+// health is kept unless their configuration changed, and their circuit
+// breakers unless the breaker configuration changed.
+func (m *Manager) Update(providers []config.Provider) {
+	next := NewManager(providers)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, p := range next.configs {
+		old, existed := m.configs[name]
+		if !existed {
+			continue
+		}
+		next.outstanding[name] = m.outstanding[name]
+		next.latency[name] = m.latency[name]
+		// A provider that was down may have been fixed, for instance by
+		// pointing it at another URL, so a changed provider starts over.
+		if health, ok := m.health[name]; ok && reflect.DeepEqual(old, p) {
+			next.health[name] = health
+		}
+		if b, ok := m.breakers[name]; ok && p.CircuitBreaker.Enabled && b.cfg == newBreaker(p.CircuitBreaker).cfg {
+			next.breakers[name] = b
+		}
+	}
+	m.providers, m.configs, m.adapters = next.providers, next.configs, next.adapters
+	m.breakers, m.health, m.outstanding, m.latency = next.breakers, next.health, next.outstanding, next.latency
+}
+
 // GetClient returns the http.Client for a given provider.
 func (m *Manager) GetClient(providerName string) *http.Client {
 	m.mu.RLock()
@@ -47,14 +132,180 @@ func (m *Manager) GetConfig(providerName string) (config.Provider, bool) {
 	return cfg, ok
 }
 
+// GetAdapter returns the adapter translating requests for a given provider.
+func (m *Manager) GetAdapter(providerName string) adapter.Adapter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.adapters[providerName]
+}
+
 // GetAllProviderConfigs returns a slice of all provider configurations.
 func (m *Manager) GetAllProviderConfigs() []config.Provider {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	
+
 	configs := make([]config.Provider, 0, len(m.configs))
 	for _, cfg := range m.configs {
 		configs = append(configs, cfg)
 	}
 	return configs
 }
+
+// Available reports whether a provider is enabled, healthy and its circuit
+// would let a request through. It does not reserve a half-open probe; use
+// Allow for that.
+func (m *Manager) Available(providerName string) bool {
+	m.mu.RLock()
+	_, ok := m.configs[providerName]
+	b := m.breakers[providerName]
+	health := m.health[providerName]
+	m.mu.RUnlock()
+
+	if !ok || (health != nil && !health.Healthy) {
+		return false
+	}
+	return b == nil || b.available()
+}
+
+// SetHealth records the result of an active health check. Providers that
+// have never been checked are considered healthy.
+func (m *Manager) SetHealth(providerName string, healthy bool, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.health[providerName] = &HealthStatus{
+		Healthy:     healthy,
+		LastChecked: time.Now(),
+		Reason:      reason,
+	}
+}
+
+// ResetHealth forgets the health check results of a provider, which is
+// considered healthy again until it is next checked.
+func (m *Manager) ResetHealth(providerName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.health, providerName)
+}
+
+// Allow reports whether a request may be sent to the provider right now.
+// Every allowed request must be followed by ReportSuccess or ReportFailure.
+func (m *Manager) Allow(providerName string) bool {
+	if b := m.getBreaker(providerName); b != nil {
+		return b.allow()
+	}
+	return true
+}
+
+// ReportSuccess records a successful request to the provider.
+func (m *Manager) ReportSuccess(providerName string) {
+	if b := m.getBreaker(providerName); b != nil {
+		b.onSuccess()
+	}
+}
+
+// ReportFailure records a failed request to the provider.
+func (m *Manager) ReportFailure(providerName string) {
+	if b := m.getBreaker(providerName); b != nil {
+		b.onFailure()
+	}
+}
+
+// ReportCanceled releases a request that ended without telling anything
+// about the provider's health, such as one aborted by the client.
+func (m *Manager) ReportCanceled(providerName string) {
+	if b := m.getBreaker(providerName); b != nil {
+		b.onCanceled()
+	}
+}
+
+// BeginRequest marks a request to the provider as in flight. It must be
+// paired with a call to EndRequest once the response has been delivered.
+func (m *Manager) BeginRequest(providerName string) {
+	if c := m.getOutstanding(providerName); c != nil {
+		c.Add(1)
+	}
+}
+
+// EndRequest marks an in-flight request to the provider as finished.
+func (m *Manager) EndRequest(providerName string) {
+	if c := m.getOutstanding(providerName); c != nil {
+		c.Add(-1)
+	}
+}
+
+// Outstanding returns the number of in-flight requests to the provider.
+func (m *Manager) Outstanding(providerName string) int64 {
+	if c := m.getOutstanding(providerName); c != nil {
+		return c.Load()
+	}
+	return 0
+}
+
+// RecordLatency records the time to first byte and the total duration of a
+// successful request to the provider.
+func (m *Manager) RecordLatency(providerName string, ttfb, total time.Duration) {
+	if l := m.getLatency(providerName); l != nil {
+		l.record(ttfb, total)
+	}
+}
+
+// Latency returns the moving averages of the provider's time to first byte
+// and total duration. ok is false until at least one request was recorded.
+func (m *Manager) Latency(providerName string) (ttfb, total time.Duration, ok bool) {
+	l := m.getLatency(providerName)
+	if l == nil {
+		return 0, 0, false
+	}
+	ttfb, total, samples := l.get()
+	return ttfb, total, samples > 0
+}
+
+// Status returns the runtime state of all enabled providers, sorted by name.
+func (m *Manager) Status() []Status {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.configs))
+	for name := range m.configs {
+		names = append(names, name)
+	}
+	m.mu.RUnlock()
+	sort.Strings(names)
+
+	statuses := make([]Status, 0, len(names))
+	for _, name := range names {
+		s := Status{Name: name, Available: m.Available(name), Outstanding: m.Outstanding(name)}
+		m.mu.RLock()
+		if health, ok := m.health[name]; ok {
+			h := *health
+			s.Health = &h
+		}
+		m.mu.RUnlock()
+		if l := m.getLatency(name); l != nil {
+			latency := l.status()
+			s.Latency = &latency
+		}
+		if b := m.getBreaker(name); b != nil {
+			circuit := b.status()
+			s.Circuit = &circuit
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+func (m *Manager) getBreaker(providerName string) *breaker {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.breakers[providerName]
+}
+
+func (m *Manager) getOutstanding(providerName string) *atomic.Int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.outstanding[providerName]
+}
+
+func (m *Manager) getLatency(providerName string) *latencyTracker {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latency[providerName]
+}
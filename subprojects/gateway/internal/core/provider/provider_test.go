@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"llm-gateway/internal/config"
+	"testing"
+	"time"
+)
+
+func TestManagerStatus(t *testing.T) {
+	m := NewManager([]config.Provider{
+		{Name: "vllm", Enabled: true, CircuitBreaker: config.CircuitBreaker{Enabled: true, FailureThreshold: 1}},
+		{Name: "openai", Enabled: true},
+		{Name: "disabled", Enabled: false},
+	})
+
+	m.ReportFailure("vllm")
+
+	statuses := m.Status()
+	if len(statuses) != 2 {
+		t.Fatalf("Status() returned %d providers, want 2", len(statuses))
+	}
+	if statuses[0].Name != "openai" || !statuses[0].Available || statuses[0].Circuit != nil {
+		t.Errorf("unexpected status for openai: %+v", statuses[0])
+	}
+	if statuses[1].Name != "vllm" || statuses[1].Available || statuses[1].Circuit.State != BreakerOpen {
+		t.Errorf("unexpected status for vllm: %+v", statuses[1])
+	}
+	if m.Available("disabled") {
+		t.Error("disabled provider reported as available")
+	}
+}
+
+func TestManagerRecordLatency(t *testing.T) {
+	m := NewManager([]config.Provider{{Name: "vllm", Enabled: true}})
+
+	if _, _, ok := m.Latency("vllm"); ok {
+		t.Fatal("Latency() reported measurements before any request")
+	}
+
+	m.RecordLatency("vllm", 100*time.Millisecond, time.Second)
+	m.RecordLatency("vllm", 200*time.Millisecond, 2*time.Second)
+
+	ttfb, total, ok := m.Latency("vllm")
+	if !ok {
+		t.Fatal("Latency() reported no measurements")
+	}
+	// The second sample moves the average by the smoothing factor.
+	if want := 130 * time.Millisecond; ttfb != want {
+		t.Errorf("ttfb = %v, want %v", ttfb, want)
+	}
+	if want := 1300 * time.Millisecond; total != want {
+		t.Errorf("total = %v, want %v", total, want)
+	}
+}
+
+func TestManagerUpdate(t *testing.T) {
+	breaker := config.CircuitBreaker{Enabled: true, FailureThreshold: 1}
+	m := NewManager([]config.Provider{
+		{Name: "vllm", Enabled: true, CircuitBreaker: breaker},
+		{Name: "openai", Enabled: true, CircuitBreaker: breaker},
+		{Name: "azure", Enabled: true},
+	})
+	m.ReportFailure("vllm")
+	m.ReportFailure("openai")
+	m.BeginRequest("vllm")
+
+	changed := breaker
+	changed.FailureThreshold = 5
+	m.Update([]config.Provider{
+		{Name: "vllm", Enabled: true, CircuitBreaker: breaker, TargetURL: "http://vllm:8000"},
+		{Name: "openai", Enabled: true, CircuitBreaker: changed},
+		{Name: "anthropic", Enabled: true},
+	})
+
+	if cfg, _ := m.GetConfig("vllm"); cfg.TargetURL != "http://vllm:8000" {
+		t.Errorf("expected the new configuration, got %+v", cfg)
+	}
+	if m.Available("vllm") || m.Outstanding("vllm") != 1 {
+		t.Error("expected vllm to keep its open circuit and in-flight request")
+	}
+	if !m.Available("openai") {
+		t.Error("expected openai to get a new circuit breaker")
+	}
+	if m.Available("azure") || !m.Available("anthropic") {
+		t.Error("expected azure to be removed and anthropic to be added")
+	}
+}
+
+func TestManagerUpdateResetsHealthOfChangedProviders(t *testing.T) {
+	m := NewManager([]config.Provider{
+		{Name: "vllm", Enabled: true, TargetURL: "http://vllm:8000"},
+		{Name: "openai", Enabled: true, TargetURL: "https://api.openai.com"},
+	})
+	m.SetHealth("vllm", false, "connection refused")
+	m.SetHealth("openai", false, "connection refused")
+
+	m.Update([]config.Provider{
+		{Name: "vllm", Enabled: true, TargetURL: "http://vllm-2:8000"},
+		{Name: "openai", Enabled: true, TargetURL: "https://api.openai.com"},
+	})
+
+	if !m.Available("vllm") {
+		t.Error("expected vllm to start over as healthy after its URL changed")
+	}
+	if m.Available("openai") {
+		t.Error("expected the unchanged openai to stay unhealthy")
+	}
+}
@@ -2,40 +2,82 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/adapter"
 	coremw "llm-gateway/internal/core/middleware"
 	"llm-gateway/internal/core/provider"
 	"llm-gateway/internal/core/router"
+	"llm-gateway/internal/core/upload"
+	"mime"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
-	"path"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// modifyRequestBody rewrites the model name in the request body and returns the new body and the translated model name.
-func modifyRequestBody(body []byte, providerName string) ([]byte, string, error) {
+// ProviderHeader is the response header naming the provider that served the request.
+const ProviderHeader = "X-Gateway-Provider"
+
+// maxErrorBodySize bounds how much of a failed upstream response is kept
+// so that it can be relayed if every provider in the chain fails.
+const maxErrorBodySize = 64 << 10
+
+// defaultRetryOn lists the upstream status codes that trigger a fallback
+// when a strategy does not configure its own.
+var defaultRetryOn = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// modifyRequestBody rewrites the model name in the request body and returns the new body.
+func modifyRequestBody(body []byte, model string) ([]byte, error) {
 	var data map[string]interface{}
 	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	var translatedModel string
-	if model, ok := data["model"].(string); ok {
-		// Strip the provider prefix
-		translatedModel = strings.TrimPrefix(model, providerName+"/")
-		data["model"] = translatedModel
+	if _, ok := data["model"].(string); ok {
+		data["model"] = model
 	}
 
-	newBody, err := json.Marshal(data)
-	if err != nil {
-		return nil, "", err
-	}
+	return json.Marshal(data)
+}
 
-	return newBody, translatedModel, nil
+// upstreamResponse is a buffered copy of a provider response that was not
+// relayed to the client because it was eligible for a fallback.
+type upstreamResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// statusError is returned from ModifyResponse when the provider answered
+// with a status code that should trigger a fallback.
+type statusError struct {
+	resp *upstreamResponse
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("upstream returned status %d", e.resp.statusCode)
+}
+
+// attemptError describes why a single provider attempt failed.
+type attemptError struct {
+	reason string
+	// resp holds the upstream response, if the provider answered at all.
+	resp *upstreamResponse
 }
 
 // Proxy is the core engine that handles request routing and proxying.
@@ -43,6 +85,22 @@ type Proxy struct {
 	providerManager    *provider.Manager
 	router             *router.Router
 	responseMiddleware coremw.ResponseMiddleware
+	// active counts the in-flight requests that are not low priority.
+	active atomic.Int64
+}
+
+type lowPriorityKey struct{}
+
+// WithLowPriority marks a request context as background work, such as a
+// batch, that is not counted by ActiveRequests.
+func WithLowPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lowPriorityKey{}, true)
+}
+
+// ActiveRequests returns the number of in-flight requests that are not low
+// priority, so that background work can yield to clients.
+func (p *Proxy) ActiveRequests() int64 {
+	return p.active.Load()
 }
 
 // NewProxy creates a new proxy.
@@ -55,33 +113,62 @@ func NewProxy(pm *provider.Manager, r *router.Router, responseMiddleware coremw.
 }
 
 // ServeHTTP handles the incoming request, selects a provider, and proxies the request.
+// Providers in the strategy are tried in order until one of them answers with a
+// response that is not eligible for a fallback. Nothing is written to the client
+// before that point, so a failed attempt can always be retried elsewhere.
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Read the body to determine the strategy.
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		return
+	if low, _ := r.Context().Value(lowPriorityKey{}).(bool); !low {
+		p.active.Add(1)
+		defer p.active.Add(-1)
 	}
-	r.Body.Close() // We've read it, so close it.
 
-	// Create a new reader for the router and the downstream request.
-	bodyReader := bytes.NewReader(body)
+	var (
+		form  *upload.Form
+		body  []byte
+		route *router.Route
+		err   error
+	)
+	if upload.IsMultipart(r) {
+		// Multipart uploads are spooled to disk rather than read into memory.
+		form, err = upload.FromRequest(r)
+		if errors.Is(err, upload.ErrTooLarge) {
+			http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read multipart body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		route, err = p.router.SelectStrategyForModel(form.Value("model"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Read the body to determine the strategy.
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			return
+		}
+		r.Body.Close() // We've read it, so close it.
 
-	strategy, err := p.router.SelectStrategy(bodyReader)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		route, err = p.router.SelectStrategy(bytes.NewReader(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
+	strategy := route.Strategy
 
-	// Restore the body for the downstream request.
-	r.Body = io.NopCloser(bytes.NewReader(body))
-
-	// Get the original model name for logging
-	var reqBody router.RequestBody
-	json.Unmarshal(body, &reqBody) // Ignore error, router already validated it
+	retryOn := strategy.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOn
+	}
 
 	// Attempt to proxy the request using the fallback chain.
-	for _, providerName := range strategy.Providers {
+	var lastFailure *attemptError
+	for _, providerName := range p.router.Providers(strategy) {
 		providerConfig, ok := p.providerManager.GetConfig(providerName)
 		if !ok {
 			logrus.Warnf("Provider '%s' not found or not enabled", providerName)
@@ -89,56 +176,278 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Rewrite the request body for the downstream provider.
-		modifiedBody, translatedModel, err := modifyRequestBody(body, providerName)
+		translatedModel, ok := route.ModelFor(providerName)
+		if !ok {
+			translatedModel = p.upstreamModel(route.Model)
+		}
+		modified := requestBody{form: form, model: translatedModel}
+		if form == nil {
+			modified.data, err = modifyRequestBody(body, translatedModel)
+		} else {
+			// Adapters only see the model of a form; its encoding is
+			// streamed from the spool file.
+			modified.data, err = json.Marshal(map[string]string{"model": translatedModel})
+		}
 		if err != nil {
 			http.Error(w, "Failed to modify request body", http.StatusInternalServerError)
 			return
 		}
-		r.Body = io.NopCloser(bytes.NewReader(modifiedBody))
-		r.ContentLength = int64(len(modifiedBody))
 
-		targetURL, err := url.Parse(providerConfig.TargetURL)
-		if err != nil {
-			logrus.Errorf("Error parsing target URL for provider %s: %v", providerName, err)
-			continue
+		// Log the detailed routing information
+		logrus.WithFields(logrus.Fields{
+			"original_model":   route.Model,
+			"provider":         providerName,
+			"translated_model": translatedModel,
+			"strategy":         strategy.Name,
+		}).Info("Routing request")
+
+		failure := p.tryProvider(w, r, providerConfig, modified, retryOn)
+		if failure == nil {
+			return
 		}
 
-		proxy := &httputil.ReverseProxy{
-			Director: func(req *http.Request) {
-				req.URL.Scheme = targetURL.Scheme
-				req.URL.Host = targetURL.Host
-				req.Host = targetURL.Host
-				req.URL.Path = path.Join(targetURL.Path, r.URL.Path) // Join paths
-				req.Header.Set("Authorization", "Bearer "+providerConfig.APIKey)
-			},
-			ModifyResponse: func(resp *http.Response) error {
-				if p.responseMiddleware == nil {
-					return nil
-				}
+		logrus.WithFields(logrus.Fields{
+			"original_model": route.Model,
+			"provider":       providerName,
+			"strategy":       strategy.Name,
+			"reason":         failure.reason,
+		}).Warn("Provider attempt failed")
+
+		if r.Context().Err() != nil {
+			// The client is gone; there is nobody left to fall back for.
+			return
+		}
+		// Keep an earlier upstream error over a later failure without a
+		// response, so a connection error does not hide the real cause.
+		if lastFailure == nil || failure.resp != nil {
+			lastFailure = failure
+		}
+	}
+
+	// Relay the last upstream error, if any, so the client sees the real cause.
+	if lastFailure != nil && lastFailure.resp != nil {
+		writeUpstreamResponse(w, lastFailure.resp)
+		return
+	}
+
+	http.Error(w, "All providers in the fallback chain failed", http.StatusServiceUnavailable)
+}
+
+// requestBody is the body sent to one provider, with the model rewritten:
+// either JSON held in memory, or a multipart form re-encoded from its spool
+// file on every attempt.
+type requestBody struct {
+	data  []byte
+	form  *upload.Form
+	model string
+}
+
+// tryProvider proxies the request to a single provider, retrying up to the
+// provider's MaxRetries with backoff. Every retry replays the buffered body.
+// It returns nil once a response has been committed to the client, or the
+// reason of the last failed attempt otherwise.
+func (p *Proxy) tryProvider(w http.ResponseWriter, r *http.Request, providerConfig config.Provider, body requestBody, retryOn []int) *attemptError {
+	providerAdapter := p.providerManager.GetAdapter(providerConfig.Name)
+	if providerAdapter == nil {
+		return &attemptError{reason: "no adapter for provider"}
+	}
+	out, err := providerAdapter.NewRequest(r.URL.Path, r.URL.Query(), body.data)
+	if err != nil {
+		return &attemptError{reason: fmt.Sprintf("failed to translate request: %v", err)}
+	}
+	if form := body.form; form != nil {
+		overrides := map[string]string{"model": body.model}
+		out.Header.Set("Content-Type", form.ContentType())
+		out.BodyReader = func() (io.Reader, int64) { return form.Encode(overrides) }
+	}
+
+	var failure *attemptError
+	for retry := 0; retry <= providerConfig.MaxRetries; retry++ {
+		if retry > 0 {
+			delay, ok := retryDelay(providerConfig, retry, failure)
+			if !ok {
+				break
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"provider": providerConfig.Name,
+				"retry":    retry,
+				"delay":    delay.String(),
+				"reason":   failure.reason,
+			}).Warn("Retrying provider")
+
+			if !waitForRetry(r.Context(), delay) {
+				break
+			}
+		}
+
+		if !p.providerManager.Allow(providerConfig.Name) {
+			if failure == nil {
+				failure = &attemptError{reason: "circuit breaker is open"}
+			}
+			break
+		}
+
+		failure = p.attempt(w, r, providerConfig.Name, providerAdapter, out, retryOn)
+		p.reportOutcome(r, providerConfig.Name, failure)
+		if failure == nil {
+			return nil
+		}
+	}
+
+	return failure
+}
+
+// reportOutcome feeds the result of an attempt into the provider's circuit breaker.
+// Attempts aborted by the client say nothing about the provider's health.
+func (p *Proxy) reportOutcome(r *http.Request, providerName string, failure *attemptError) {
+	switch {
+	case failure == nil:
+		p.providerManager.ReportSuccess(providerName)
+	case r.Context().Err() != nil:
+		p.providerManager.ReportCanceled(providerName)
+	default:
+		p.providerManager.ReportFailure(providerName)
+	}
+}
+
+// attempt proxies the request to a single provider once. It returns nil once
+// the response has been committed to the client, or the reason the attempt
+// failed if nothing has been written yet.
+func (p *Proxy) attempt(w http.ResponseWriter, r *http.Request, providerName string, providerAdapter adapter.Adapter, out *adapter.Request, retryOn []int) *attemptError {
+	if out.BodyReader != nil {
+		body, size := out.BodyReader()
+		r.Body, r.ContentLength = io.NopCloser(body), size
+	} else {
+		r.Body = io.NopCloser(bytes.NewReader(out.Body))
+		r.ContentLength = int64(len(out.Body))
+	}
+
+	var transport http.RoundTripper
+	if client := p.providerManager.GetClient(providerName); client != nil {
+		transport = client.Transport
+	}
+
+	var failure *attemptError
+	start := time.Now()
+	proxy := &httputil.ReverseProxy{
+		Transport: transport,
+		Director: func(req *http.Request) {
+			target := *out.URL
+			req.Method = out.Method
+			req.URL = &target
+			req.Host = target.Host
+			// The client's credentials are never forwarded, and compression is
+			// left to the transport so that adapters see plain bodies.
+			req.Header.Del("Authorization")
+			req.Header.Del("Accept-Encoding")
+			for key, values := range out.Header {
+				req.Header[key] = values
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if slices.Contains(retryOn, resp.StatusCode) {
+				return &statusError{resp: bufferResponse(resp)}
+			}
+
+			if err := providerAdapter.ModifyResponse(resp, out); err != nil {
+				return fmt.Errorf("failed to translate response: %w", err)
+			}
+
+			resp.Header.Set(ProviderHeader, providerName)
+
+			if p.responseMiddleware != nil {
 				onCompletion, err := p.responseMiddleware(resp)
 				if err != nil {
 					logrus.Errorf("Error in response middleware: %v", err)
 					return err
 				}
-				if onCompletion != nil {
+				// Binary bodies, such as generated speech, are passed
+				// through without being buffered for the middleware.
+				if onCompletion != nil && !isBinary(resp) {
 					resp.Body = coremw.NewStreamInterceptor(resp.Body, onCompletion)
 				}
-				return nil
-			},
+			}
+
+			// Only successful responses are timed: a provider that quickly
+			// rejects every request must not look like the fastest one.
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				resp.Body = newTimedBody(resp.Body, start, func(ttfb, total time.Duration) {
+					p.providerManager.RecordLatency(providerName, ttfb, total)
+				})
+			}
+			return nil
+		},
+		// The error handler only runs before the response is committed, which
+		// is exactly when falling back to another provider is still possible.
+		ErrorHandler: func(_ http.ResponseWriter, _ *http.Request, err error) {
+			var se *statusError
+			if errors.As(err, &se) {
+				se.resp.header.Set(ProviderHeader, providerName)
+				failure = &attemptError{reason: se.Error(), resp: se.resp}
+				return
+			}
+			failure = &attemptError{reason: err.Error()}
+		},
+	}
+
+	p.providerManager.BeginRequest(providerName)
+	defer p.providerManager.EndRequest(providerName)
+
+	proxy.ServeHTTP(w, r)
+	return failure
+}
+
+// upstreamModel returns the model name to send downstream. The namespace is
+// stripped when it names a configured provider, so "openai/gpt-4" is sent as
+// "gpt-4" to every provider in the fallback chain.
+func (p *Proxy) upstreamModel(model string) string {
+	if prefix, name, ok := strings.Cut(model, "/"); ok {
+		if _, known := p.providerManager.GetConfig(prefix); known {
+			return name
 		}
+	}
+	return model
+}
 
-		// Log the detailed routing information
-		logrus.WithFields(logrus.Fields{
-			"original_model": reqBody.Model,
-			"provider":       providerName,
-			"translated_model": translatedModel,
-		}).Info("Routing request")
+// bufferResponse reads a bounded copy of the response so that it can be relayed later.
+func bufferResponse(resp *http.Response) *upstreamResponse {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	header := resp.Header.Clone()
+	header.Del("Content-Length")
+	return &upstreamResponse{
+		statusCode: resp.StatusCode,
+		header:     header,
+		body:       body,
+	}
+}
 
-		proxy.ServeHTTP(w, r)
-		// This is a simplification. A real implementation would need to inspect
-		// the response status code before deciding to fall back.
-		return // For now, we don't fall back.
+// writeUpstreamResponse writes a buffered upstream response to the client.
+func writeUpstreamResponse(w http.ResponseWriter, resp *upstreamResponse) {
+	for key, values := range resp.header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
 	}
+	w.WriteHeader(resp.statusCode)
+	w.Write(resp.body)
+}
 
-	http.Error(w, "All providers in the fallback chain failed", http.StatusServiceUnavailable)
+// isBinary reports whether a response carries binary content, such as
+// audio, rather than JSON or text.
+func isBinary(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "json"):
+		return false
+	case mediaType == "application/octet-stream",
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return true
+	}
+	return false
 }
@@ -1,10 +1,15 @@
 package core
 
 import (
+	"bytes"
 	"io"
 	"llm-gateway/internal/config"
+	coremw "llm-gateway/internal/core/middleware"
 	"llm-gateway/internal/core/provider"
 	"llm-gateway/internal/core/router"
+	"llm-gateway/internal/core/sigv4"
+	"llm-gateway/internal/core/upload"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -14,7 +19,12 @@ import (
 
 // mockProviderServer creates a fake downstream LLM provider for testing.
 func mockProviderServer(t *testing.T, expectedModel string, responseBody string) *httptest.Server {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return httptest.NewServer(mockProviderHandler(t, expectedModel, responseBody))
+}
+
+// mockProviderHandler checks the rewritten request and answers with the given body.
+func mockProviderHandler(t *testing.T, expectedModel string, responseBody string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if the model name was correctly rewritten.
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -41,7 +51,6 @@ func mockProviderServer(t *testing.T, expectedModel string, responseBody string)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(responseBody))
 	})
-	return httptest.NewServer(handler)
 }
 
 func TestProxyServeHTTPSuccess(t *testing.T) {
@@ -62,6 +71,7 @@ func TestProxyServeHTTPSuccess(t *testing.T) {
 				Timeout:   5 * time.Second,
 			},
 		},
+		Routing: config.Routing{DefaultStrategy: "default"},
 		Strategies: []config.Strategy{
 			{Name: "default", Providers: []string{"mock-provider"}},
 		},
@@ -69,7 +79,7 @@ func TestProxyServeHTTPSuccess(t *testing.T) {
 
 	// 3. Initialize gateway components
 	providerManager := provider.NewManager(cfg.Providers)
-	coreRouter := router.NewRouter(cfg.Strategies)
+	coreRouter := router.NewRouter(cfg.Strategies, cfg.Routing, providerManager)
 	proxy := NewProxy(providerManager, coreRouter, nil) // Pass nil for middleware
 
 	// 4. Create the incoming request to the gateway
@@ -88,4 +98,471 @@ func TestProxyServeHTTPSuccess(t *testing.T) {
 	if !strings.Contains(rr.Body.String(), "Hello there!") {
 		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
 	}
-}
\ No newline at end of file
+}
+
+// newFallbackProxy builds a proxy with a single strategy chaining the given providers.
+func newFallbackProxy(providers ...config.Provider) *Proxy {
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		names[i] = p.Name
+	}
+	strategies := []config.Strategy{{Name: "chain", Providers: names}}
+	routing := config.Routing{DefaultStrategy: "chain"}
+	pm := provider.NewManager(providers)
+	return NewProxy(pm, router.NewRouter(strategies, routing, pm), nil)
+}
+
+func TestProxyFallsBackOnRetryableStatus(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	// The fallback provider must receive the model without the primary's namespace.
+	healthy := mockProviderServer(t, "test-model", `{"choices": [{"message": {"content": "from secondary"}}]}`)
+	defer healthy.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{Name: "primary", Enabled: true, TargetURL: failing.URL, APIKey: "test-api-key", Timeout: 5 * time.Second},
+		config.Provider{Name: "secondary", Enabled: true, TargetURL: healthy.URL, APIKey: "test-api-key", Timeout: 5 * time.Second},
+	)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get(ProviderHeader); got != "secondary" {
+		t.Errorf("%s header = %q, want %q", ProviderHeader, got, "secondary")
+	}
+	if !strings.Contains(rr.Body.String(), "from secondary") {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestProxyFallsBackOnConnectionError(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	healthy := mockProviderServer(t, "test-model", `{"choices": []}`)
+	defer healthy.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{Name: "primary", Enabled: true, TargetURL: unreachable.URL, APIKey: "test-api-key", Timeout: 5 * time.Second},
+		config.Provider{Name: "secondary", Enabled: true, TargetURL: healthy.URL, APIKey: "test-api-key", Timeout: 5 * time.Second},
+	)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get(ProviderHeader); got != "secondary" {
+		t.Errorf("%s header = %q, want %q", ProviderHeader, got, "secondary")
+	}
+}
+
+func TestProxyRelaysLastFailureWhenChainIsExhausted(t *testing.T) {
+	rateLimited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer rateLimited.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{Name: "primary", Enabled: true, TargetURL: rateLimited.URL, Timeout: 5 * time.Second},
+	)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(rr.Body.String(), "slow down") {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestProxyRelaysUpstreamErrorOverLaterConnectionError(t *testing.T) {
+	rateLimited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer rateLimited.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{Name: "primary", Enabled: true, TargetURL: rateLimited.URL, Timeout: 5 * time.Second},
+		config.Provider{Name: "secondary", Enabled: true, TargetURL: unreachable.URL, Timeout: 5 * time.Second},
+	)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(rr.Body.String(), "slow down") {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestProxyDoesNotFallBackOnClientError(t *testing.T) {
+	var secondaryCalled bool
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer badRequest.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryCalled = true
+	}))
+	defer secondary.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{Name: "primary", Enabled: true, TargetURL: badRequest.URL, Timeout: 5 * time.Second},
+		config.Provider{Name: "secondary", Enabled: true, TargetURL: secondary.URL, Timeout: 5 * time.Second},
+	)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if secondaryCalled {
+		t.Error("secondary provider was called for a non-retryable status")
+	}
+}
+
+func TestProxySkipsProviderWithOpenCircuit(t *testing.T) {
+	var primaryCalls int
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthy := mockProviderServer(t, "test-model", `{"choices": []}`)
+	defer healthy.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{
+			Name:           "primary",
+			Enabled:        true,
+			TargetURL:      failing.URL,
+			Timeout:        5 * time.Second,
+			CircuitBreaker: config.CircuitBreaker{Enabled: true, FailureThreshold: 1, OpenDuration: time.Minute},
+		},
+		config.Provider{Name: "secondary", Enabled: true, TargetURL: healthy.URL, APIKey: "test-api-key", Timeout: 5 * time.Second},
+	)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: handler returned wrong status code: got %v want %v", i, rr.Code, http.StatusOK)
+		}
+	}
+
+	if primaryCalls != 1 {
+		t.Errorf("primary provider was called %d times, want 1", primaryCalls)
+	}
+}
+
+func TestProxyRewritesAliasPerProvider(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	healthy := mockProviderServer(t, "llama-3-70b", `{"choices": [{"message": {"content": "from vllm"}}]}`)
+	defer healthy.Close()
+
+	providers := []config.Provider{
+		{Name: "openai", Enabled: true, TargetURL: failing.URL, Timeout: 5 * time.Second},
+		{Name: "vllm", Enabled: true, TargetURL: healthy.URL, APIKey: "test-api-key", Timeout: 5 * time.Second},
+	}
+	routing := config.Routing{
+		Aliases: []config.Alias{{Name: "chat-default", Targets: []string{"openai/gpt-4", "vllm/llama-3-70b"}}},
+	}
+	pm := provider.NewManager(providers)
+	proxy := NewProxy(pm, router.NewRouter(nil, routing, pm), nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "chat-default"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get(ProviderHeader); got != "vllm" {
+		t.Errorf("%s header = %q, want %q", ProviderHeader, got, "vllm")
+	}
+}
+
+func TestProxyTranslatesAnthropicProvider(t *testing.T) {
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("anthropic stand-in called on %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-api-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected credentials: x-api-key=%q authorization=%q", r.Header.Get("x-api-key"), r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"system":"Be brief."`) || !strings.Contains(string(body), `"model":"claude-sonnet"`) {
+			t.Errorf("unexpected request body %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","model":"claude-sonnet","content":[{"type":"text","text":"Hello there!"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":2}}`))
+	}))
+	defer anthropic.Close()
+
+	proxy := newFallbackProxy(config.Provider{
+		Name: "anthropic", Enabled: true, Type: config.ProviderTypeAnthropic,
+		TargetURL: anthropic.URL, APIKey: "test-api-key", Timeout: 5 * time.Second,
+	})
+
+	body := `{"model": "anthropic/claude-sonnet", "messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-token")
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	want := []string{`"object":"chat.completion"`, `"content":"Hello there!"`, `"finish_reason":"stop"`, `"total_tokens":5`}
+	for _, s := range want {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("response %s does not contain %s", rr.Body.String(), s)
+		}
+	}
+}
+
+func TestProxyUsesAzureDeploymentURL(t *testing.T) {
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/prod-gpt4o/chat/completions" || r.URL.Query().Get("api-version") != "2024-06-01" {
+			t.Errorf("unexpected request URL %s", r.URL)
+		}
+		if r.Header.Get("api-key") != "test-api-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected credentials: api-key=%q authorization=%q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "from azure"}}]}`))
+	}))
+	defer azure.Close()
+
+	proxy := newFallbackProxy(config.Provider{
+		Name: "azure", Enabled: true, Type: config.ProviderTypeAzureOpenAI,
+		TargetURL: azure.URL, APIKey: "test-api-key", Timeout: 5 * time.Second,
+		AzureOpenAI: config.AzureOpenAI{APIVersion: "2024-06-01", Deployments: map[string]string{"gpt-4o": "prod-gpt4o"}},
+	})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "azure/gpt-4o"}`))
+	req.Header.Set("Authorization", "Bearer client-token")
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "from azure") {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// sigV4StandIn is a Bedrock stand-in that rejects requests whose SigV4
+// signature does not match the test credentials.
+func sigV4StandIn(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signedAt, err := time.Parse(sigv4.TimeFormat, r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Errorf("missing or invalid X-Amz-Date: %v", err)
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+
+		expected := r.Clone(r.Context())
+		expected.Header = r.Header.Clone()
+		expected.Header.Del("Authorization")
+		// Only the signed headers take part in the signature.
+		for name := range expected.Header {
+			lower := strings.ToLower(name)
+			if lower != "content-type" && !strings.HasPrefix(lower, "x-amz-") {
+				expected.Header.Del(name)
+			}
+		}
+		creds := sigv4.Credentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "test-secret"}
+		sigv4.Sign(expected, body, creds, "us-east-1", "bedrock", signedAt)
+		if got, want := r.Header.Get("Authorization"), expected.Header.Get("Authorization"); got != want {
+			t.Errorf("signature mismatch:\ngot  %s\nwant %s", got, want)
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler(w, r)
+	}))
+}
+
+func sigV4Provider(targetURL string) config.Provider {
+	return config.Provider{
+		Name: "bedrock", Enabled: true, Type: config.ProviderTypeBedrock,
+		TargetURL: targetURL, Timeout: 5 * time.Second,
+		Bedrock: config.Bedrock{ModelsURL: targetURL},
+		Auth: config.ProviderAuth{Mode: config.AuthModeSigV4, SigV4: config.SigV4{
+			Region: "us-east-1", Service: "bedrock", AccessKeyID: "AKIDTEST", SecretAccessKey: "test-secret",
+		}},
+	}
+}
+
+func TestProxySignsBedrockRequests(t *testing.T) {
+	server := sigV4StandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse" {
+			t.Errorf("unexpected path %s", r.URL.EscapedPath())
+		}
+		w.Write([]byte(`{"output":{"message":{"role":"assistant","content":[{"text":"signed"}]}},"stopReason":"end_turn","usage":{"inputTokens":1,"outputTokens":1}}`))
+	})
+	defer server.Close()
+
+	proxy := newFallbackProxy(sigV4Provider(server.URL))
+	body := `{"model": "bedrock/anthropic.claude-3-haiku-20240307-v1:0", "messages": [{"role": "user", "content": "Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-token")
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"content":"signed"`) {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestProxyStreamsMultipartUploads(t *testing.T) {
+	audio := bytes.Repeat([]byte("RIFF"), 100000)
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("model", "primary/whisper-1")
+	fw, _ := mw.CreateFormFile("file", "speech.wav")
+	fw.Write(audio)
+	mw.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	// The fallback must receive the whole file again, with the model rewritten.
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("upstream body is not a valid form: %v", err)
+			return
+		}
+		if got := r.FormValue("model"); got != "whisper-1" {
+			t.Errorf("model = %q, want %q", got, "whisper-1")
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("file missing: %v", err)
+			return
+		}
+		if got, _ := io.ReadAll(file); !bytes.Equal(got, audio) {
+			t.Errorf("file was not passed through unchanged (%d bytes)", len(got))
+		}
+		w.Write([]byte(`{"text": "hello"}`))
+	}))
+	defer healthy.Close()
+
+	proxy := newFallbackProxy(
+		config.Provider{Name: "primary", Enabled: true, TargetURL: failing.URL, Timeout: 5 * time.Second},
+		config.Provider{Name: "secondary", Enabled: true, TargetURL: healthy.URL, Timeout: 5 * time.Second},
+	)
+
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "hello") {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestProxyRejectsOversizedUploads(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("model", "primary/whisper-1")
+	fw, _ := mw.CreateFormFile("file", "speech.wav")
+	fw.Write(bytes.Repeat([]byte("RIFF"), 1000))
+	mw.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("an oversized upload reached the provider")
+	}))
+	defer upstream.Close()
+
+	proxy := newFallbackProxy(config.Provider{Name: "primary", Enabled: true, TargetURL: upstream.URL, Timeout: 5 * time.Second})
+
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	upload.Limit(rr, req, 1024)
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestProxyPassesBinaryResponsesThrough(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 1000)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(audio)
+	}))
+	defer upstream.Close()
+
+	proxy := newFallbackProxy(config.Provider{Name: "openai", Enabled: true, TargetURL: upstream.URL, Timeout: 5 * time.Second})
+	intercepted := false
+	proxy.responseMiddleware = func(resp *http.Response) (coremw.OnCompletionFunc, error) {
+		return func(body []byte) { intercepted = true }, nil
+	}
+
+	req := httptest.NewRequest("POST", "/v1/audio/speech", strings.NewReader(`{"model": "openai/tts-1", "input": "hi", "voice": "alloy"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "audio/mpeg" || !bytes.Equal(rr.Body.Bytes(), audio) {
+		t.Fatalf("unexpected response %d (%s, %d bytes)", rr.Code, rr.Header().Get("Content-Type"), rr.Body.Len())
+	}
+	if intercepted {
+		t.Error("expected binary responses not to be buffered for the response middleware")
+	}
+}
+
+func TestProxyCountsActiveRequests(t *testing.T) {
+	var proxy *Proxy
+	var seen []int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, proxy.ActiveRequests())
+		w.Write([]byte(`{"choices": []}`))
+	}))
+	defer upstream.Close()
+	proxy = newFallbackProxy(config.Provider{Name: "primary", Enabled: true, TargetURL: upstream.URL, Timeout: 5 * time.Second})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	proxy.ServeHTTP(httptest.NewRecorder(), req.WithContext(WithLowPriority(req.Context())))
+
+	// Low priority requests are not counted.
+	if len(seen) != 2 || seen[0] != 1 || seen[1] != 0 || proxy.ActiveRequests() != 0 {
+		t.Errorf("unexpected active requests %v, %d after", seen, proxy.ActiveRequests())
+	}
+}
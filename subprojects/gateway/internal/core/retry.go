@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"llm-gateway/internal/config"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 200 * time.Millisecond
+	defaultMaxRetryBackoff = 10 * time.Second
+)
+
+// retryDelay returns how long to wait before the given retry (starting at 1)
+// of a provider. An upstream Retry-After header takes precedence over the
+// exponential backoff. The second return value is false when the provider
+// asked for a longer pause than the configured maximum, in which case the
+// caller should fall back to the next provider instead of waiting.
+func retryDelay(p config.Provider, retry int, failure *attemptError) (time.Duration, bool) {
+	base := p.RetryBackoff
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	maxDelay := p.MaxRetryBackoff
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRetryBackoff
+	}
+
+	if failure.resp != nil {
+		if d, ok := parseRetryAfter(failure.resp.header.Get("Retry-After"), time.Now()); ok {
+			return d, d <= maxDelay
+		}
+	}
+
+	delay := base
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	// Equal jitter: keep half of the delay and randomize the other half so
+	// that concurrent clients do not retry in lockstep.
+	half := delay / 2
+	return half + rand.N(half+1), true
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// waitForRetry sleeps for the given delay. It returns false without waiting
+// out the delay if the context is cancelled or its deadline would pass first.
+func waitForRetry(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "", ok: false},
+		{value: "3", want: 3 * time.Second, ok: true},
+		{value: "-1", ok: false},
+		{value: now.Add(5 * time.Second).Format(http.TimeFormat), want: 5 * time.Second, ok: true},
+		{value: now.Add(-5 * time.Second).Format(http.TimeFormat), want: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = (%v, %v), want (%v, %v)", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryDelayBackoff(t *testing.T) {
+	p := config.Provider{RetryBackoff: 100 * time.Millisecond, MaxRetryBackoff: 300 * time.Millisecond}
+	failure := &attemptError{reason: "connection refused"}
+
+	// Each delay is within [backoff/2, backoff], with the backoff doubling and capped.
+	bounds := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for i, upper := range bounds {
+		delay, ok := retryDelay(p, i+1, failure)
+		if !ok {
+			t.Fatalf("retry %d: expected retry to be allowed", i+1)
+		}
+		if delay < upper/2 || delay > upper {
+			t.Errorf("retry %d: delay %v outside [%v, %v]", i+1, delay, upper/2, upper)
+		}
+	}
+}
+
+func TestRetryDelayHonorsRetryAfter(t *testing.T) {
+	p := config.Provider{MaxRetryBackoff: 5 * time.Second}
+
+	failure := &attemptError{resp: &upstreamResponse{header: http.Header{"Retry-After": {"2"}}}}
+	if delay, ok := retryDelay(p, 1, failure); !ok || delay != 2*time.Second {
+		t.Errorf("retryDelay() = (%v, %v), want (2s, true)", delay, ok)
+	}
+
+	failure = &attemptError{resp: &upstreamResponse{header: http.Header{"Retry-After": {"60"}}}}
+	if _, ok := retryDelay(p, 1, failure); ok {
+		t.Error("expected a Retry-After beyond the maximum backoff to skip the retry")
+	}
+}
+
+func TestWaitForRetryRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if waitForRetry(ctx, time.Second) {
+		t.Error("expected waitForRetry to refuse a delay beyond the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("waitForRetry blocked for %v", elapsed)
+	}
+}
+
+func TestProxyRetriesProviderBeforeFallingBack(t *testing.T) {
+	var calls atomic.Int32
+	succeed := mockProviderHandler(t, "test-model", `{"choices": [{"message": {"content": "second try"}}]}`)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "try again", http.StatusBadGateway)
+			return
+		}
+		succeed(w, r)
+	}))
+	defer flaky.Close()
+
+	proxy := newFallbackProxy(config.Provider{
+		Name:         "primary",
+		Enabled:      true,
+		TargetURL:    flaky.URL,
+		APIKey:       "test-api-key",
+		Timeout:      5 * time.Second,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "primary/test-model"}`))
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "second try") {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("provider was called %d times, want 2", got)
+	}
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"llm-gateway/internal/config"
+	"sort"
+	"time"
+)
+
+// defaultExploration is the share of requests a latency strategy sends to a
+// provider other than the fastest one when the strategy does not set it.
+const defaultExploration = 0.1
+
+// orderWeighted orders providers by weighted random sampling without
+// replacement, so the first provider is picked in proportion to its weight
+// and the remaining ones follow as fallbacks in the same fashion.
+func (r *Router) orderWeighted(providers []string, weights map[string]int) {
+	weightOf := func(name string) int {
+		if w, ok := weights[name]; ok {
+			return w
+		}
+		return 1
+	}
+
+	for i := 0; i < len(providers)-1; i++ {
+		total := 0
+		for _, name := range providers[i:] {
+			total += weightOf(name)
+		}
+		if total == 0 {
+			// Only zero-weight providers are left; keep their configured order.
+			return
+		}
+
+		pick := r.intN(total)
+		for j := i; j < len(providers); j++ {
+			pick -= weightOf(providers[j])
+			if pick < 0 {
+				providers[i], providers[j] = providers[j], providers[i]
+				break
+			}
+		}
+	}
+}
+
+// orderRoundRobin rotates providers so that successive requests to the same
+// strategy start with the next provider in the configured order.
+func (r *Router) orderRoundRobin(providers []string, strategyName string) {
+	counter, ok := r.table.Load().counters[strategyName]
+	if !ok {
+		return
+	}
+	offset := int((counter.Add(1) - 1) % uint64(len(providers)))
+
+	rotated := append(append(make([]string, 0, len(providers)), providers[offset:]...), providers[:offset]...)
+	copy(providers, rotated)
+}
+
+// orderLeastOutstanding orders providers by their number of in-flight
+// requests, keeping the configured order between equally loaded providers.
+func (r *Router) orderLeastOutstanding(providers []string) {
+	if r.state == nil {
+		return
+	}
+
+	outstanding := make(map[string]int64, len(providers))
+	for _, name := range providers {
+		outstanding[name] = r.state.Outstanding(name)
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return outstanding[providers[i]] < outstanding[providers[j]]
+	})
+}
+
+// orderLatency orders providers by their observed latency, fastest first.
+// Providers that have not been measured yet follow in their configured order.
+// To measure them and to keep the estimates of slower providers fresh, a share
+// of the requests is sent to a random other provider first.
+func (r *Router) orderLatency(providers []string, strategy *config.Strategy) {
+	if r.state == nil {
+		return
+	}
+
+	type estimate struct {
+		latency  time.Duration
+		measured bool
+	}
+	estimates := make(map[string]estimate, len(providers))
+	for _, name := range providers {
+		ttfb, total, ok := r.state.Latency(name)
+		latency := ttfb
+		if strategy.LatencyMetric == config.LatencyMetricTotal {
+			latency = total
+		}
+		estimates[name] = estimate{latency: latency, measured: ok}
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		a, b := estimates[providers[i]], estimates[providers[j]]
+		if a.measured != b.measured {
+			return a.measured
+		}
+		return a.latency < b.latency
+	})
+
+	exploration := defaultExploration
+	if strategy.Exploration != nil {
+		exploration = *strategy.Exploration
+	}
+	if r.float64() < exploration {
+		// Move a random provider other than the fastest one to the front.
+		j := 1 + r.intN(len(providers)-1)
+		explored := providers[j]
+		copy(providers[1:j+1], providers[:j])
+		providers[0] = explored
+	}
+}
@@ -3,9 +3,14 @@ package router
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"llm-gateway/internal/config"
+	"math/rand/v2"
+	"path"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // RequestBody is a partial representation of the incoming request body
@@ -14,51 +19,213 @@ type RequestBody struct {
 	Model string `json:"model"`
 }
 
+// ProviderState reports the runtime state of providers that routing
+// decisions depend on. It is implemented by provider.Manager.
+type ProviderState interface {
+	// Available reports whether a provider can currently take traffic.
+	Available(providerName string) bool
+	// Outstanding returns the number of in-flight requests to a provider.
+	Outstanding(providerName string) int64
+	// Latency returns the moving averages of a provider's time to first byte
+	// and total duration; ok is false while the provider has not been measured.
+	Latency(providerName string) (ttfb, total time.Duration, ok bool)
+}
+
+// Route is the outcome of routing a request: the strategy whose providers
+// should be tried and, for aliases, the model to request from each of them.
+type Route struct {
+	Strategy *config.Strategy
+	// Model is the model name requested by the client.
+	Model string
+	// Alias is the alias the requested model resolved through, if any.
+	Alias *config.Alias
+	// models maps provider names to the model to request from them.
+	models map[string]string
+}
+
+// ModelFor returns the model to request from the given provider. ok is false
+// when the route does not prescribe one, in which case the requested model
+// is used as is.
+func (rt *Route) ModelFor(providerName string) (string, bool) {
+	model, ok := rt.models[providerName]
+	return model, ok
+}
+
 // Router determines the provider strategy for a given request.
 type Router struct {
-strategies map[string]*config.Strategy
+	// table is replaced as a whole by Update, so that a request is routed
+	// either entirely by the old or entirely by the new configuration.
+	table atomic.Pointer[table]
+	state ProviderState
+	// intN and float64 are the sources of randomness; replaced in tests.
+	intN    func(n int) int
+	float64 func() float64
+}
+
+// table is the routing configuration of a Router.
+type table struct {
+	strategies      map[string]*config.Strategy
+	aliases         map[string]*Route
+	exact           map[string]string
+	patterns        []config.ModelBinding
+	defaultStrategy string
+	// counters holds the round-robin position of each strategy.
+	counters map[string]*atomic.Uint64
 }
 
-// NewRouter creates a new router.
-func NewRouter(strategies []config.Strategy) *Router {
+// NewRouter creates a new router. Model bindings without glob metacharacters
+// are matched exactly; the others are matched as patterns in configuration order.
+// If state is nil, every provider is considered available and idle.
+func NewRouter(strategies []config.Strategy, routing config.Routing, state ProviderState) *Router {
 	r := &Router{
-		strategies: make(map[string]*config.Strategy),
+		state:   state,
+		intN:    rand.IntN,
+		float64: rand.Float64,
+	}
+	r.table.Store(newTable(strategies, routing, nil))
+	return r
+}
+
+// Update replaces the strategies and routing of the router. Requests being
+// routed keep the configuration they started with; round-robin positions of
+// strategies that still exist are kept.
+func (r *Router) Update(strategies []config.Strategy, routing config.Routing) {
+	r.table.Store(newTable(strategies, routing, r.table.Load().counters))
+}
+
+func newTable(strategies []config.Strategy, routing config.Routing, counters map[string]*atomic.Uint64) *table {
+	t := &table{
+		strategies:      make(map[string]*config.Strategy),
+		exact:           make(map[string]string),
+		defaultStrategy: routing.DefaultStrategy,
+		aliases:         make(map[string]*Route),
+		counters:        make(map[string]*atomic.Uint64),
 	}
 	for i, s := range strategies {
-		r.strategies[s.Name] = &strategies[i]
+		t.strategies[s.Name] = &strategies[i]
+		if counter, ok := counters[s.Name]; ok {
+			t.counters[s.Name] = counter
+		} else {
+			t.counters[s.Name] = &atomic.Uint64{}
+		}
 	}
-	return r
+	for i, a := range routing.Aliases {
+		t.aliases[a.Name] = newAliasRoute(&routing.Aliases[i])
+	}
+	for _, b := range routing.Models {
+		if isPattern(b.Model) {
+			t.patterns = append(t.patterns, b)
+			continue
+		}
+		if _, exists := t.exact[b.Model]; !exists {
+			t.exact[b.Model] = b.Strategy
+		}
+	}
+	return t
 }
 
-// SelectStrategy selects a provider strategy based on the model name in the request body.
-// For now, it uses a simple logic of matching the provider name from the model string.
-// e.g. "openai/gpt-4o" -> "openai" strategy.
-// This will be expanded to use the configured strategies.
-func (r *Router) SelectStrategy(body io.Reader) (*config.Strategy, error) {
+// SelectStrategy selects a route based on the model name in the request body.
+// Aliases take precedence over exact model bindings, which take precedence over
+// glob bindings, which take precedence over the default strategy.
+func (r *Router) SelectStrategy(body io.Reader) (*Route, error) {
 	var reqBody RequestBody
 	if err := json.NewDecoder(body).Decode(&reqBody); err != nil {
 		return nil, err
 	}
+	return r.SelectStrategyForModel(reqBody.Model)
+}
 
-	if reqBody.Model == "" {
+// SelectStrategyForModel selects a route for a model name taken from a
+// request body that is not JSON, such as the model field of a multipart form.
+func (r *Router) SelectStrategyForModel(model string) (*Route, error) {
+	if model == "" {
 		return nil, errors.New("model not found in request body")
 	}
 
-	// Simple strategy: find a strategy that has the provider from the model name.
-	// This is a placeholder for the full strategy selection logic.
-	parts := strings.Split(reqBody.Model, "/")
-	if len(parts) < 2 {
-		return nil, errors.New("invalid model format; expected 'provider/model_name'")
+	t := r.table.Load()
+	if route, ok := t.aliases[model]; ok {
+		return route, nil
+	}
+
+	name, ok := t.strategyFor(model)
+	if !ok {
+		return nil, fmt.Errorf("no strategy configured for model '%s'", model)
 	}
-	providerName := parts[0]
 
-	// A real implementation would look up the strategy from the config.
-	// For now, we create a dummy strategy on the fly.
-	// This will be replaced with a lookup in r.strategies.
-	strategy := &config.Strategy{
-		Name:      "dynamic",
-		Providers: []string{providerName},
+	strategy, ok := t.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("strategy '%s' for model '%s' is not defined", name, model)
 	}
 
-	return strategy, nil
+	return &Route{Strategy: strategy, Model: model}, nil
+}
+
+// Providers returns the providers of a strategy that can currently take
+// traffic, in the order they should be tried. Unavailable providers, such as
+// unhealthy ones or those whose circuit is open, are skipped. The first
+// provider is chosen according to the strategy's mode; the others follow as
+// fallbacks.
+func (r *Router) Providers(strategy *config.Strategy) []string {
+	providers := make([]string, 0, len(strategy.Providers))
+	for _, name := range strategy.Providers {
+		if r.state == nil || r.state.Available(name) {
+			providers = append(providers, name)
+		}
+	}
+	if len(providers) < 2 {
+		return providers
+	}
+
+	switch strategy.Mode {
+	case config.StrategyModeWeighted:
+		r.orderWeighted(providers, strategy.Weights)
+	case config.StrategyModeRoundRobin:
+		r.orderRoundRobin(providers, strategy.Name)
+	case config.StrategyModeLeastOutstanding:
+		r.orderLeastOutstanding(providers)
+	case config.StrategyModeLatency:
+		r.orderLatency(providers, strategy)
+	}
+	return providers
+}
+
+// strategyFor returns the name of the strategy bound to the given model.
+func (t *table) strategyFor(model string) (string, bool) {
+	if name, ok := t.exact[model]; ok {
+		return name, true
+	}
+
+	for _, b := range t.patterns {
+		if matched, _ := path.Match(b.Model, model); matched {
+			return b.Strategy, true
+		}
+	}
+
+	if t.defaultStrategy != "" {
+		return t.defaultStrategy, true
+	}
+
+	return "", false
+}
+
+// newAliasRoute builds the route of an alias: a fallback chain over the
+// providers of its targets, each with its own model.
+func newAliasRoute(alias *config.Alias) *Route {
+	route := &Route{
+		Strategy: &config.Strategy{Name: "alias:" + alias.Name},
+		Model:    alias.Name,
+		Alias:    alias,
+		models:   make(map[string]string, len(alias.Targets)),
+	}
+	for _, target := range alias.Targets {
+		providerName, model, _ := strings.Cut(target, "/")
+		route.Strategy.Providers = append(route.Strategy.Providers, providerName)
+		route.models[providerName] = model
+	}
+	return route
+}
+
+// isPattern reports whether the binding contains glob metacharacters.
+func isPattern(model string) bool {
+	return strings.ContainsAny(model, `*?[\`)
 }
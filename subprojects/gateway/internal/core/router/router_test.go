@@ -0,0 +1,243 @@
+package router
+
+import (
+	"llm-gateway/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRouter() *Router {
+	strategies := []config.Strategy{
+		{Name: "gpt4", Providers: []string{"openai", "azure"}},
+		{Name: "gpt4-turbo", Providers: []string{"openai"}},
+		{Name: "default", Providers: []string{"vllm"}},
+	}
+	routing := config.Routing{
+		DefaultStrategy: "default",
+		Models: []config.ModelBinding{
+			{Model: "openai/gpt-4*", Strategy: "gpt4"},
+			{Model: "openai/gpt-4-turbo", Strategy: "gpt4-turbo"},
+		},
+	}
+	return NewRouter(strategies, routing, nil)
+}
+
+func TestSelectStrategy(t *testing.T) {
+	r := newTestRouter()
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{model: "openai/gpt-4", want: "gpt4"},
+		{model: "openai/gpt-4o", want: "gpt4"},
+		{model: "openai/gpt-4-turbo", want: "gpt4-turbo"},
+		{model: "vllm/llama-3-70b", want: "default"},
+	}
+
+	for _, tt := range tests {
+		body := `{"model": "` + tt.model + `"}`
+		route, err := r.SelectStrategy(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("SelectStrategy(%q) returned error: %v", tt.model, err)
+		}
+		if route.Strategy.Name != tt.want {
+			t.Errorf("SelectStrategy(%q) = %q, want %q", tt.model, route.Strategy.Name, tt.want)
+		}
+	}
+}
+
+func TestSelectStrategyWithoutDefault(t *testing.T) {
+	strategies := []config.Strategy{{Name: "gpt4", Providers: []string{"openai"}}}
+	routing := config.Routing{
+		Models: []config.ModelBinding{{Model: "openai/gpt-4", Strategy: "gpt4"}},
+	}
+	r := NewRouter(strategies, routing, nil)
+
+	if _, err := r.SelectStrategy(strings.NewReader(`{"model": "openai/gpt-3.5-turbo"}`)); err == nil {
+		t.Error("expected an error for a model without a strategy, got nil")
+	}
+	if _, err := r.SelectStrategy(strings.NewReader(`{"messages": []}`)); err == nil {
+		t.Error("expected an error for a request without a model, got nil")
+	}
+}
+
+func TestSelectStrategyAlias(t *testing.T) {
+	routing := config.Routing{
+		DefaultStrategy: "default",
+		Aliases: []config.Alias{
+			{Name: "chat-default", Targets: []string{"openai/gpt-4", "vllm/llama-3-70b"}},
+		},
+	}
+	r := NewRouter([]config.Strategy{{Name: "default", Providers: []string{"vllm"}}}, routing, nil)
+
+	route, err := r.SelectStrategy(strings.NewReader(`{"model": "chat-default"}`))
+	if err != nil {
+		t.Fatalf("SelectStrategy() returned error: %v", err)
+	}
+	if got := strings.Join(route.Strategy.Providers, ","); got != "openai,vllm" {
+		t.Errorf("alias providers = %v, want openai,vllm", got)
+	}
+	if route.Alias == nil || route.Alias.Name != "chat-default" {
+		t.Errorf("route.Alias = %+v, want chat-default", route.Alias)
+	}
+	for provider, want := range map[string]string{"openai": "gpt-4", "vllm": "llama-3-70b"} {
+		if got, ok := route.ModelFor(provider); !ok || got != want {
+			t.Errorf("ModelFor(%q) = (%q, %v), want (%q, true)", provider, got, ok, want)
+		}
+	}
+
+	// Concrete models are unaffected by aliases.
+	route, err = r.SelectStrategy(strings.NewReader(`{"model": "vllm/llama-3-70b"}`))
+	if err != nil {
+		t.Fatalf("SelectStrategy() returned error: %v", err)
+	}
+	if _, ok := route.ModelFor("vllm"); ok || route.Strategy.Name != "default" {
+		t.Errorf("unexpected route for a concrete model: %+v", route)
+	}
+}
+
+// fakeState is a ProviderState backed by fixed values.
+type fakeState struct {
+	down        map[string]bool
+	outstanding map[string]int64
+	ttfb        map[string]time.Duration
+}
+
+func (f fakeState) Available(name string) bool    { return !f.down[name] }
+func (f fakeState) Outstanding(name string) int64 { return f.outstanding[name] }
+
+func (f fakeState) Latency(name string) (time.Duration, time.Duration, bool) {
+	ttfb, ok := f.ttfb[name]
+	return ttfb, 2 * ttfb, ok
+}
+
+func TestProvidersSkipsUnavailable(t *testing.T) {
+	strategy := config.Strategy{Name: "chain", Providers: []string{"openai", "azure", "vllm"}}
+	state := fakeState{down: map[string]bool{"azure": true}}
+	r := NewRouter([]config.Strategy{strategy}, config.Routing{}, state)
+
+	got := r.Providers(&strategy)
+	want := []string{"openai", "vllm"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Providers() = %v, want %v", got, want)
+	}
+}
+
+func TestProvidersRoundRobin(t *testing.T) {
+	strategy := config.Strategy{Name: "replicas", Mode: config.StrategyModeRoundRobin, Providers: []string{"a", "b", "c"}}
+	r := NewRouter([]config.Strategy{strategy}, config.Routing{}, nil)
+
+	want := []string{"a,b,c", "b,c,a", "c,a,b", "a,b,c"}
+	for i, w := range want {
+		if got := strings.Join(r.Providers(&strategy), ","); got != w {
+			t.Errorf("request %d: Providers() = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestProvidersWeighted(t *testing.T) {
+	strategy := config.Strategy{
+		Name:      "replicas",
+		Mode:      config.StrategyModeWeighted,
+		Providers: []string{"a", "b", "c"},
+		Weights:   map[string]int{"a": 70, "b": 30, "c": 0},
+	}
+	r := NewRouter([]config.Strategy{strategy}, config.Routing{}, nil)
+
+	tests := []struct {
+		pick int
+		want string
+	}{
+		{pick: 0, want: "a,b,c"},
+		{pick: 69, want: "a,b,c"},
+		{pick: 70, want: "b,a,c"},
+		{pick: 99, want: "b,a,c"},
+	}
+	for _, tt := range tests {
+		first := true
+		r.intN = func(n int) int {
+			if first {
+				first = false
+				return tt.pick
+			}
+			return 0
+		}
+		if got := strings.Join(r.Providers(&strategy), ","); got != tt.want {
+			t.Errorf("pick %d: Providers() = %v, want %v", tt.pick, got, tt.want)
+		}
+	}
+}
+
+func TestProvidersLeastOutstanding(t *testing.T) {
+	strategy := config.Strategy{Name: "replicas", Mode: config.StrategyModeLeastOutstanding, Providers: []string{"a", "b", "c"}}
+	state := fakeState{outstanding: map[string]int64{"a": 4, "b": 1, "c": 1}}
+	r := NewRouter([]config.Strategy{strategy}, config.Routing{}, state)
+
+	if got := strings.Join(r.Providers(&strategy), ","); got != "b,c,a" {
+		t.Errorf("Providers() = %v, want b,c,a", got)
+	}
+}
+
+func TestProvidersLatency(t *testing.T) {
+	noExploration := 0.0
+	strategy := config.Strategy{
+		Name:        "mixed",
+		Mode:        config.StrategyModeLatency,
+		Providers:   []string{"hosted", "selfhosted", "new"},
+		Exploration: &noExploration,
+	}
+	state := fakeState{ttfb: map[string]time.Duration{
+		"hosted":     300 * time.Millisecond,
+		"selfhosted": 100 * time.Millisecond,
+	}}
+	r := NewRouter([]config.Strategy{strategy}, config.Routing{}, state)
+
+	// Unmeasured providers go last; exploration is what measures them.
+	if got := strings.Join(r.Providers(&strategy), ","); got != "selfhosted,hosted,new" {
+		t.Errorf("Providers() = %v, want selfhosted,hosted,new", got)
+	}
+
+	state.ttfb["new"] = 200 * time.Millisecond
+	if got := strings.Join(r.Providers(&strategy), ","); got != "selfhosted,new,hosted" {
+		t.Errorf("Providers() = %v, want selfhosted,new,hosted", got)
+	}
+}
+
+func TestProvidersLatencyExploration(t *testing.T) {
+	strategy := config.Strategy{Name: "mixed", Mode: config.StrategyModeLatency, Providers: []string{"slow", "medium", "fast"}}
+	state := fakeState{ttfb: map[string]time.Duration{
+		"slow":   300 * time.Millisecond,
+		"medium": 200 * time.Millisecond,
+		"fast":   100 * time.Millisecond,
+	}}
+	r := NewRouter([]config.Strategy{strategy}, config.Routing{}, state)
+	r.float64 = func() float64 { return 0 }
+	r.intN = func(n int) int { return n - 1 }
+
+	if got := strings.Join(r.Providers(&strategy), ","); got != "slow,fast,medium" {
+		t.Errorf("Providers() = %v, want slow,fast,medium", got)
+	}
+}
+
+func TestRouterUpdate(t *testing.T) {
+	r := newTestRouter()
+	strategy := config.Strategy{Name: "replicas", Mode: config.StrategyModeRoundRobin, Providers: []string{"a", "b"}}
+	r.Update([]config.Strategy{strategy}, config.Routing{DefaultStrategy: "replicas"})
+
+	route, err := r.SelectStrategy(strings.NewReader(`{"model": "openai/gpt-4"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.Strategy.Name != "replicas" {
+		t.Errorf("SelectStrategy() = %q after update, want %q", route.Strategy.Name, "replicas")
+	}
+
+	// Round-robin counters survive further updates.
+	r.Providers(&strategy)
+	r.Update([]config.Strategy{strategy}, config.Routing{DefaultStrategy: "replicas"})
+	if got := strings.Join(r.Providers(&strategy), ","); got != "b,a" {
+		t.Errorf("Providers() = %v after update, want b,a", got)
+	}
+}
@@ -0,0 +1,134 @@
+package sigv4
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"llm-gateway/internal/config"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials are AWS credentials. SessionToken is only set for temporary ones.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// credentialsSource resolves the credentials of a signer: static values from
+// the configuration win, then the credentials file, then the environment.
+type credentialsSource struct {
+	static  Credentials
+	file    string
+	profile string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cached  Credentials
+}
+
+func newCredentialsSource(cfg config.SigV4) *credentialsSource {
+	profile := cfg.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	return &credentialsSource{
+		static: Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			SessionToken:    cfg.SessionToken,
+		},
+		file:    cfg.CredentialsFile,
+		profile: profile,
+	}
+}
+
+func (s *credentialsSource) get() (Credentials, error) {
+	if s.static.AccessKeyID != "" {
+		return s.static, nil
+	}
+	if s.file != "" {
+		return s.fromFile()
+	}
+
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, errors.New("no AWS credentials configured")
+	}
+	return creds, nil
+}
+
+// fromFile returns the credentials of the profile, re-reading the file when
+// it has changed so that rotated session tokens are picked up.
+func (s *credentialsSource) fromFile() (Credentials, error) {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info.ModTime().Equal(s.modTime) {
+		return s.cached, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return Credentials{}, err
+	}
+	creds, err := parseCredentialsFile(data, s.profile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("%s: %w", s.file, err)
+	}
+	s.cached, s.modTime = creds, info.ModTime()
+	return creds, nil
+}
+
+// parseCredentialsFile reads a profile of a shared credentials file.
+func parseCredentialsFile(data []byte, profile string) (Credentials, error) {
+	var creds Credentials
+	var found bool
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, err
+	}
+	if !found || creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("no credentials for profile '%s'", profile)
+	}
+	return creds, nil
+}
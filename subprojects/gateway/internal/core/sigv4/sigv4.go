@@ -0,0 +1,211 @@
+// Package sigv4 signs outbound provider requests with AWS Signature Version 4.
+package sigv4
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "AWS4-HMAC-SHA256"
+	// TimeFormat is the format of the X-Amz-Date header.
+	TimeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+)
+
+// Sign adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers
+// for a request with the given body, signed at time t.
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+	req.Header.Del("Authorization")
+
+	headers, signedHeaders := canonicalHeaders(req)
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		headers,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format(dateFormat), region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		algorithm,
+		t.Format(TimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), t.Format(dateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalURI encodes the already escaped path a second time, as required
+// for every service but S3.
+func canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	return escape(path, false)
+}
+
+// canonicalQuery sorts the query by key and value and encodes it strictly.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, escape(key, true)+"="+escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaders returns the canonical headers block and the list of
+// signed headers. Host, Content-Type and all X-Amz-* headers are signed.
+func canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, v := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			values[name] = strings.Join(v, ",")
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(strings.Fields(values[name]), " "))
+		b.WriteByte('\n')
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// escape percent-encodes everything but unreserved characters, and slashes
+// unless encodeSlash is set.
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Signer signs requests for one provider.
+type Signer struct {
+	region  string
+	service string
+	creds   *credentialsSource
+	now     func() time.Time
+}
+
+// NewSigner creates a signer from the provider's sigv4 settings.
+func NewSigner(cfg config.SigV4) *Signer {
+	return &Signer{
+		region:  cfg.Region,
+		service: cfg.Service,
+		creds:   newCredentialsSource(cfg),
+		now:     time.Now,
+	}
+}
+
+// Sign signs the request with the given body.
+func (s *Signer) Sign(req *http.Request, body []byte) error {
+	creds, err := s.creds.get()
+	if err != nil {
+		return err
+	}
+	Sign(req, body, creds, s.region, s.service, s.now())
+	return nil
+}
+
+// transport signs every request before passing it to the wrapped transport.
+type transport struct {
+	base   http.RoundTripper
+	signer *Signer
+}
+
+// NewTransport wraps base so that every request is signed. The body is
+// buffered, since its hash is part of the signature.
+func NewTransport(base http.RoundTripper, signer *Signer) http.RoundTripper {
+	return &transport{base: base, signer: signer}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A RoundTripper must not modify the caller's request.
+	signed := req.Clone(req.Context())
+	signed.Header = req.Header.Clone()
+	if body != nil {
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+		signed.ContentLength = int64(len(body))
+		signed.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if err := t.signer.Sign(signed, body); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+	return t.base.RoundTrip(signed)
+}
@@ -0,0 +1,108 @@
+package sigv4
+
+import (
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The expected signature is the get-vanilla case of the AWS SigV4 test suite.
+func TestSignTestSuiteVector(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	Sign(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://bedrock-runtime.us-east-1.amazonaws.com/model/a%3A0/converse", nil)
+	Sign(req, []byte(`{}`), Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}, "us-east-1", "bedrock", time.Now())
+
+	if req.Header.Get("X-Amz-Security-Token") != "token" {
+		t.Errorf("expected session token header")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("expected session token to be signed: %s", req.Header.Get("Authorization"))
+	}
+}
+
+func TestTransportSignsBody(t *testing.T) {
+	var gotAuth, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotAuth, gotBody = r.Header.Get("Authorization"), string(body)
+	}))
+	defer server.Close()
+
+	signer := NewSigner(config.SigV4{Region: "us-east-1", Service: "bedrock", AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport, signer)}
+	req, _ := http.NewRequest("POST", server.URL+"/model/m/converse", strings.NewReader(`{"messages":[]}`))
+	req.Header.Set("Authorization", "Bearer client-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		t.Errorf("expected signed request, got Authorization %q", gotAuth)
+	}
+	if gotBody != `{"messages":[]}` {
+		t.Errorf("body was not forwarded: %q", gotBody)
+	}
+	if req.Header.Get("Authorization") != "Bearer client-token" {
+		t.Errorf("transport modified the caller's request")
+	}
+}
+
+func TestCredentialsFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials")
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, modTime, modTime)
+	}
+	write("[default]\naws_access_key_id = AKID1\naws_secret_access_key = s1\n\n[bedrock]\naws_access_key_id = AKID2\naws_secret_access_key = s2\naws_session_token = t2\n", time.Unix(1000, 0))
+
+	source := newCredentialsSource(config.SigV4{CredentialsFile: file, Profile: "bedrock"})
+	creds, err := source.get()
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if creds != (Credentials{AccessKeyID: "AKID2", SecretAccessKey: "s2", SessionToken: "t2"}) {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	// Rotated credentials are picked up once the file changes.
+	write("[bedrock]\naws_access_key_id = AKID3\naws_secret_access_key = s3\n", time.Unix(2000, 0))
+	if creds, _ := source.get(); creds.AccessKeyID != "AKID3" {
+		t.Errorf("expected rotated credentials, got %+v", creds)
+	}
+
+	if _, err := newCredentialsSource(config.SigV4{CredentialsFile: file, Profile: "missing"}).get(); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	creds, err := newCredentialsSource(config.SigV4{}).get()
+	if err != nil || creds.AccessKeyID != "AKIDENV" {
+		t.Errorf("unexpected credentials %+v, %v", creds, err)
+	}
+}
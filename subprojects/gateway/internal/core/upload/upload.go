@@ -0,0 +1,303 @@
+// Package upload handles multipart/form-data request bodies, such as audio
+// uploads, without holding them in memory. A form is spooled to a temporary
+// file once and re-encoded from it whenever the body is read again, with
+// selected fields replaced.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"sync"
+)
+
+// DefaultMaxSize is the size limit of multipart bodies when none is configured.
+const DefaultMaxSize = 100 << 20
+
+// ErrTooLarge is returned when a multipart body exceeds the limit set by Limit.
+var ErrTooLarge = errors.New("multipart body is too large")
+
+// maxValueSize bounds the parts kept in memory for Value; larger parts only
+// live in the spool file.
+const maxValueSize = 64 << 10
+
+// part is a form part spooled to the file at [offset, offset+size).
+type part struct {
+	header textproto.MIMEHeader
+	name   string
+	offset int64
+	size   int64
+	// value is the content of small parts without a file name.
+	value    string
+	hasValue bool
+}
+
+// Form is a spooled multipart/form-data body.
+type Form struct {
+	boundary string
+	file     *os.File
+	parts    []part
+	once     sync.Once
+}
+
+// IsMultipart reports whether the request has a multipart/form-data body.
+func IsMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// body is the request body installed by FromRequest. It reads the form's
+// encoding, and lets later calls find the form again.
+type body struct {
+	io.Reader
+	form *Form
+}
+
+func (b *body) Close() error { return nil }
+
+// Limit caps the body of a multipart request at maxSize bytes, or at
+// DefaultMaxSize if maxSize is zero. Spooling a larger body fails with
+// ErrTooLarge.
+func Limit(w http.ResponseWriter, r *http.Request, maxSize int64) {
+	if !IsMultipart(r) {
+		return
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+}
+
+// FromRequest returns the form of a multipart request, spooling the body on
+// the first call. The request body is replaced with an encoding of the form,
+// so that it can still be read by handlers unaware of it, and later calls
+// return the same form. The spool file is removed once the request's context
+// is done.
+func FromRequest(r *http.Request) (*Form, error) {
+	if b, ok := r.Body.(*body); ok {
+		return b.form, nil
+	}
+
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	form, err := Parse(r.Body, params["boundary"])
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(r.Context(), func() { form.Close() })
+
+	reader, size := form.Encode(nil)
+	r.Body = &body{Reader: reader, form: form}
+	r.ContentLength = size
+	r.Header.Set("Content-Type", form.ContentType())
+	return form, nil
+}
+
+// Parse spools a multipart body with the given boundary.
+func Parse(r io.Reader, boundary string) (*Form, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart body without boundary")
+	}
+	file, err := os.CreateTemp("", "gateway-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	form := &Form{boundary: boundary, file: file}
+	// The encoding must reproduce the boundary the client declared, which
+	// multipart.Writer rejects if it is not RFC 2046 compliant.
+	if err := multipart.NewWriter(io.Discard).SetBoundary(boundary); err != nil {
+		form.boundary = multipart.NewWriter(io.Discard).Boundary()
+	}
+
+	reader := multipart.NewReader(r, boundary)
+	var offset int64
+	for {
+		p, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			form.Close()
+			if tooLarge(err) {
+				return nil, ErrTooLarge
+			}
+			return nil, fmt.Errorf("invalid multipart body: %w", err)
+		}
+
+		var value bytes.Buffer
+		var dst io.Writer = file
+		keep := p.FileName() == ""
+		if keep {
+			dst = io.MultiWriter(file, &limitedBuffer{buf: &value, limit: maxValueSize + 1})
+		}
+		size, err := io.Copy(dst, p)
+		p.Close()
+		if err != nil {
+			form.Close()
+			if tooLarge(err) {
+				return nil, ErrTooLarge
+			}
+			return nil, fmt.Errorf("failed to spool multipart body: %w", err)
+		}
+
+		spooled := part{header: p.Header, name: p.FormName(), offset: offset, size: size}
+		if keep && size <= maxValueSize {
+			spooled.value, spooled.hasValue = value.String(), true
+		}
+		form.parts = append(form.parts, spooled)
+		offset += size
+	}
+	return form, nil
+}
+
+// tooLarge reports whether err comes from a body capped by Limit.
+func tooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes)
+}
+
+// limitedBuffer writes at most limit bytes to buf and discards the rest.
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := l.limit - l.buf.Len(); room > 0 {
+		l.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// Value returns the value of the first field with the given name, or "" if
+// there is none or it is too large to be kept in memory.
+func (f *Form) Value(name string) string {
+	for _, p := range f.parts {
+		if p.name == name && p.hasValue {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// Values returns the first value of every field kept in memory.
+func (f *Form) Values() map[string]string {
+	values := make(map[string]string)
+	for _, p := range f.parts {
+		if _, seen := values[p.name]; !seen && p.hasValue {
+			values[p.name] = p.value
+		}
+	}
+	return values
+}
+
+// ContentType returns the Content-Type header for the form's encoding.
+func (f *Form) ContentType() string {
+	return "multipart/form-data; boundary=" + f.boundary
+}
+
+// Encode returns a reader of the form's encoding and its length, with the
+// values of the named fields replaced. Fields that are not part of the form
+// are not added. Every call returns an independent reader.
+func (f *Form) Encode(overrides map[string]string) (io.Reader, int64) {
+	var readers []io.Reader
+	var size int64
+	var buf bytes.Buffer
+	flush := func() {
+		if buf.Len() > 0 {
+			readers = append(readers, bytes.NewReader(bytes.Clone(buf.Bytes())))
+			size += int64(buf.Len())
+			buf.Reset()
+		}
+	}
+
+	w := multipart.NewWriter(&buf)
+	w.SetBoundary(f.boundary)
+	for _, p := range f.parts {
+		// Writing to a buffer cannot fail.
+		w.CreatePart(p.header)
+		if value, ok := overrides[p.name]; ok && !isFile(p.header) {
+			buf.WriteString(value)
+			continue
+		}
+		flush()
+		readers = append(readers, io.NewSectionReader(f.file, p.offset, p.size))
+		size += p.size
+	}
+	w.Close()
+	flush()
+	return io.MultiReader(readers...), size
+}
+
+// isFile reports whether a part header describes a file.
+func isFile(header textproto.MIMEHeader) bool {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil {
+		return false
+	}
+	_, ok := params["filename"]
+	return ok
+}
+
+// Close removes the spool file. The form must not be encoded afterwards.
+func (f *Form) Close() error {
+	var err error
+	f.once.Do(func() {
+		f.file.Close()
+		err = os.Remove(f.file.Name())
+	})
+	return err
+}
+
+// Model returns the model requested by a JSON or multipart request, leaving
+// the body readable for the next handler.
+func Model(r *http.Request) (string, error) {
+	fields, err := Fields(r)
+	return fields["model"], err
+}
+
+// Fields returns the top-level fields of a JSON or multipart request as
+// strings, leaving the body readable for the next handler. JSON values other
+// than strings are returned as their JSON text; multipart values too large to
+// be kept in memory are left out.
+func Fields(r *http.Request) (map[string]string, error) {
+	if IsMultipart(r) {
+		form, err := FromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		return form.Values(), nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(raw))
+	for name, value := range raw {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			fields[name] = s
+		} else {
+			fields[name] = string(value)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newForm encodes a form with a model field and an audio file.
+func newForm(t *testing.T, audio []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("model", "openai/whisper-1")
+	fw, err := w.CreateFormFile("file", "speech.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(audio)
+	w.WriteField("language", "en")
+	w.Close()
+	return &buf, w.FormDataContentType()
+}
+
+func TestFormEncodeReplacesFields(t *testing.T) {
+	audio := bytes.Repeat([]byte{0, 1, 2, 0xff}, 50000)
+	buf, contentType := newForm(t, audio)
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", buf)
+	req.Header.Set("Content-Type", contentType)
+
+	form, err := FromRequest(req)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	defer form.Close()
+	if got := form.Value("model"); got != "openai/whisper-1" {
+		t.Errorf("model = %q", got)
+	}
+	if got := form.Value("file"); got != "" {
+		t.Errorf("expected file parts not to be kept in memory, got %d bytes", len(got))
+	}
+
+	// Encode twice to check that every reader is independent.
+	for range 2 {
+		body, size := form.Encode(map[string]string{"model": "whisper-1", "file": "ignored"})
+		data, _ := io.ReadAll(body)
+		if int64(len(data)) != size {
+			t.Fatalf("reported size %d, read %d bytes", size, len(data))
+		}
+
+		parsed := httptest.NewRequest("POST", "/", bytes.NewReader(data))
+		parsed.Header.Set("Content-Type", form.ContentType())
+		if err := parsed.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("encoding is not a valid form: %v", err)
+		}
+		if got := parsed.FormValue("model"); got != "whisper-1" {
+			t.Errorf("model = %q, want the override", got)
+		}
+		if got := parsed.FormValue("language"); got != "en" {
+			t.Errorf("language = %q", got)
+		}
+		file, header, err := parsed.FormFile("file")
+		if err != nil {
+			t.Fatalf("file missing: %v", err)
+		}
+		got, _ := io.ReadAll(file)
+		if header.Filename != "speech.mp3" || !bytes.Equal(got, audio) {
+			t.Errorf("file %q was not passed through unchanged", header.Filename)
+		}
+	}
+}
+
+func TestModelLeavesBodyReadable(t *testing.T) {
+	buf, contentType := newForm(t, []byte("audio"))
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", buf)
+	req.Header.Set("Content-Type", contentType)
+
+	model, err := Model(req)
+	if err != nil || model != "openai/whisper-1" {
+		t.Fatalf("Model = %q, %v", model, err)
+	}
+	form, _ := FromRequest(req)
+	defer form.Close()
+	if model, _ := Model(req); model != "openai/whisper-1" {
+		t.Errorf("second Model = %q", model)
+	}
+	data, _ := io.ReadAll(req.Body)
+	if !bytes.Contains(data, []byte("audio")) {
+		t.Errorf("body is no longer readable: %q", data)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "openai/gpt-4"}`))
+	if model, err := Model(req); err != nil || model != "openai/gpt-4" {
+		t.Errorf("Model = %q, %v", model, err)
+	}
+	if data, _ := io.ReadAll(req.Body); string(data) != `{"model": "openai/gpt-4"}` {
+		t.Errorf("body is no longer readable: %q", data)
+	}
+}
+
+func TestLimitRejectsLargeBodies(t *testing.T) {
+	buf, contentType := newForm(t, bytes.Repeat([]byte{1}, 4096))
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", buf)
+	req.Header.Set("Content-Type", contentType)
+	Limit(httptest.NewRecorder(), req, 1024)
+
+	if _, err := FromRequest(req); err != ErrTooLarge {
+		t.Errorf("FromRequest() error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestFormCloseRemovesSpoolFile(t *testing.T) {
+	buf, contentType := newForm(t, []byte("audio"))
+	_, boundary, _ := strings.Cut(contentType, "boundary=")
+	form, err := Parse(buf, boundary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := form.file.Name()
+	form.Close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", name, err)
+	}
+}
+
+func TestParseRejectsMalformedBodies(t *testing.T) {
+	if _, err := Parse(strings.NewReader("not a form"), "boundary"); err == nil {
+		t.Error("expected an error for a body without parts")
+	}
+	if _, err := Parse(strings.NewReader(""), ""); err == nil {
+		t.Error("expected an error without a boundary")
+	}
+}
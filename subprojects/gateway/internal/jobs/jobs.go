@@ -0,0 +1,453 @@
+// Package jobs runs API requests asynchronously. A request sent with
+// "Prefer: respond-async" is accepted with a job ID and executed in the
+// background through the normal request path; its response is stored in a
+// bbolt database until it is polled, and a signed webhook can be sent when it
+// finishes.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConcurrency    = 16
+	defaultRetention      = 24 * time.Hour
+	defaultMaxRequestSize = 32 << 20
+	defaultWebhookTimeout = 10 * time.Second
+	// sweepInterval is how often expired jobs are deleted.
+	sweepInterval = time.Minute
+	// webhookAttempts is how many times a callback is tried, with an
+	// exponential backoff starting at webhookBackoff.
+	webhookAttempts = 3
+	webhookBackoff  = time.Second
+)
+
+// Job statuses. A job is completed when it got a successful response and
+// failed otherwise.
+const (
+	StatusQueued     = "queued"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// Webhook headers. The signature has the form "t=<unix time>,v1=<hex>",
+// where the second part is Sign of the timestamp and the request body.
+const (
+	JobIDHeader     = "X-Gateway-Job-Id"
+	SignatureHeader = "X-Gateway-Signature"
+)
+
+var (
+	// ErrNotFound is returned for jobs that do not exist, have expired or
+	// belong to another user.
+	ErrNotFound = errors.New("not found")
+	// ErrPending is returned for the result of a job that has not finished.
+	ErrPending = errors.New("job has not finished")
+	// ErrInvalidRequest is wrapped by errors about a callback URL that is
+	// not accepted.
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// Job is an asynchronous request, as returned by /v1/jobs/{id}.
+type Job struct {
+	ID          string    `json:"id"`
+	Object      string    `json:"object"`
+	Status      string    `json:"status"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	CreatedAt   int64     `json:"created_at"`
+	StartedAt   *int64    `json:"started_at"`
+	CompletedAt *int64    `json:"completed_at"`
+	ExpiresAt   *int64    `json:"expires_at"`
+	Response    *Response `json:"response,omitempty"`
+	Error       *Error    `json:"error,omitempty"`
+}
+
+// Response is the response of a finished job.
+type Response struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	// Body is included when the response is JSON; any response can be
+	// downloaded from /v1/jobs/{id}/content.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Error explains why a job has no response.
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Service accepts, runs and stores jobs.
+type Service struct {
+	store          *store
+	sem            chan struct{}
+	retention      time.Duration
+	maxRequestSize int64
+	webhooks       config.Webhooks
+	client         *http.Client
+
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// NewService opens the job store in cfg.Dir.
+func NewService(cfg config.Jobs) (*Service, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	st, err := openStore(filepath.Join(cfg.Dir, "jobs.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	s := &Service{
+		store:          st,
+		sem:            make(chan struct{}, concurrency),
+		retention:      cfg.Retention,
+		maxRequestSize: cfg.MaxRequestSize,
+		webhooks:       cfg.Webhooks,
+		client: &http.Client{
+			Timeout: cfg.Webhooks.Timeout,
+			// Redirects are not followed, as they could lead callbacks to
+			// hosts that are not allowed.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	if s.retention <= 0 {
+		s.retention = defaultRetention
+	}
+	if s.maxRequestSize <= 0 {
+		s.maxRequestSize = defaultMaxRequestSize
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultWebhookTimeout
+	}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// Start fails the jobs interrupted by the last shutdown, whose requests were
+// only held in memory, and starts deleting expired jobs.
+func (s *Service) Start() {
+	logrus.Println("Starting job service...")
+	recs, err := s.store.jobs()
+	if err != nil {
+		logrus.Errorf("Failed to list jobs: %v", err)
+	}
+	for _, rec := range recs {
+		if rec.Status == StatusQueued || rec.Status == StatusInProgress {
+			rec.Error = &Error{Message: "The gateway restarted before the job finished."}
+			s.complete(rec, StatusFailed, nil)
+		}
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweep()
+			}
+		}
+	}()
+}
+
+// Stop abandons the running jobs and closes the store. Abandoned jobs are
+// failed on the next start.
+func (s *Service) Stop() {
+	s.stop()
+	s.wg.Wait()
+	s.store.close()
+}
+
+// MaxRequestSize returns the size limit of asynchronous request bodies.
+func (s *Service) MaxRequestSize() int64 {
+	return s.maxRequestSize
+}
+
+func newID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return "job_" + hex.EncodeToString(b[:])
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// CheckCallback verifies that a callback URL targets an allowed host.
+func (s *Service) CheckCallback(raw string) error {
+	if len(s.webhooks.AllowedHosts) == 0 {
+		return fmt.Errorf("%w: callbacks are not enabled", ErrInvalidRequest)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: invalid callback URL '%s'", ErrInvalidRequest, raw)
+	}
+	if !slices.Contains(s.webhooks.AllowedHosts, u.Hostname()) {
+		return fmt.Errorf("%w: callbacks to '%s' are not allowed", ErrInvalidRequest, u.Hostname())
+	}
+	return nil
+}
+
+// Submit accepts r, whose body has been read into body, as a job served by
+// handler in the background. The job keeps the values of r's context, such as
+// the authenticated user, but not its cancellation. callback, if not empty,
+// must have been checked with CheckCallback.
+func (s *Service) Submit(r *http.Request, body []byte, callback string, handler http.Handler) (Job, error) {
+	owner, _ := r.Context().Value("user_id").(string)
+	rec := jobRecord{
+		Job: Job{
+			ID:        newID(),
+			Object:    "job",
+			Status:    StatusQueued,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			CreatedAt: now(),
+		},
+		Owner:    owner,
+		Callback: callback,
+	}
+	if err := s.store.put(rec); err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	req := r.Clone(ctx)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Del("Prefer")
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		stop := context.AfterFunc(s.ctx, cancel)
+		defer stop()
+		s.run(ctx, rec, req, handler)
+	}()
+	return rec.Job, nil
+}
+
+// run waits for a free slot, serves the job's request and stores its response.
+func (s *Service) run(ctx context.Context, rec jobRecord, req *http.Request, handler http.Handler) {
+	select {
+	case <-ctx.Done():
+		return
+	case s.sem <- struct{}{}:
+	}
+	defer func() { <-s.sem }()
+
+	t := now()
+	rec.Status, rec.StartedAt = StatusInProgress, &t
+	if err := s.store.put(rec); err != nil {
+		logrus.Errorf("Job %s: failed to store its status: %v", rec.ID, err)
+	}
+
+	resp := core.NewResponseBuffer()
+	handler.ServeHTTP(resp, req)
+	// Responses cut short by the shutdown are not stored.
+	if ctx.Err() != nil {
+		return
+	}
+
+	rec.Response = &Response{StatusCode: resp.StatusCode(), ContentType: resp.Header().Get("Content-Type")}
+	status := StatusCompleted
+	if resp.StatusCode() >= 400 {
+		status = StatusFailed
+	}
+	s.complete(rec, status, resp.Body())
+}
+
+// complete stores the final state of a job and sends its callback.
+func (s *Service) complete(rec jobRecord, status string, body []byte) {
+	t := now()
+	expires := t + int64(s.retention/time.Second)
+	rec.Status, rec.CompletedAt, rec.ExpiresAt = status, &t, &expires
+	if err := s.store.finish(rec, body); err != nil {
+		logrus.Errorf("Job %s: failed to store its result: %v", rec.ID, err)
+		return
+	}
+	if rec.Callback != "" {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.notify(rec, body)
+		}()
+	}
+}
+
+// view returns the API representation of a job, with its JSON response body.
+func view(rec jobRecord, body []byte) Job {
+	job := rec.Job
+	if job.Response != nil && isJSON(job.Response.ContentType) && json.Valid(body) {
+		response := *job.Response
+		response.Body = body
+		job.Response = &response
+	}
+	return job
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json"
+}
+
+// lookup returns a job of owner that has not expired.
+func (s *Service) lookup(owner, id string) (jobRecord, error) {
+	rec, err := s.store.job(id)
+	if errors.Is(err, errMissing) || (err == nil && (rec.Owner != owner || expired(rec))) {
+		return jobRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+func expired(rec jobRecord) bool {
+	return rec.ExpiresAt != nil && *rec.ExpiresAt <= now()
+}
+
+// Job returns a job of owner.
+func (s *Service) Job(owner, id string) (Job, error) {
+	rec, err := s.lookup(owner, id)
+	if err != nil {
+		return Job{}, err
+	}
+	var body []byte
+	if rec.Response != nil && isJSON(rec.Response.ContentType) {
+		if body, err = s.store.result(id); err != nil {
+			return Job{}, err
+		}
+	}
+	return view(rec, body), nil
+}
+
+// Result returns a finished job of owner and its response body.
+func (s *Service) Result(owner, id string) (Job, []byte, error) {
+	rec, err := s.lookup(owner, id)
+	if err != nil {
+		return Job{}, nil, err
+	}
+	if rec.Response == nil {
+		if rec.Error != nil {
+			return Job{}, nil, ErrNotFound
+		}
+		return Job{}, nil, ErrPending
+	}
+	body, err := s.store.result(id)
+	if err != nil {
+		return Job{}, nil, err
+	}
+	return rec.Job, body, nil
+}
+
+// sweep deletes the expired jobs.
+func (s *Service) sweep() {
+	recs, err := s.store.jobs()
+	if err != nil {
+		logrus.Errorf("Failed to list jobs: %v", err)
+		return
+	}
+	for _, rec := range recs {
+		if expired(rec) {
+			if err := s.store.delete(rec.ID); err != nil {
+				logrus.Errorf("Failed to delete job %s: %v", rec.ID, err)
+			}
+		}
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<payload>" with secret, as
+// sent in the v1 part of the signature header.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify posts a finished job to its callback URL, retrying failed attempts.
+func (s *Service) notify(rec jobRecord, body []byte) {
+	payload, err := json.Marshal(view(rec, body))
+	if err != nil {
+		logrus.Errorf("Job %s: failed to encode its callback: %v", rec.ID, err)
+		return
+	}
+
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.deliver(rec, payload)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			logrus.Errorf("Job %s: callback failed after %d attempts: %v", rec.ID, attempt, err)
+			return
+		}
+		logrus.Warnf("Job %s: callback failed, retrying: %v", rec.ID, err)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *Service) deliver(rec jobRecord, payload []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, rec.Callback, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(JobIDHeader, rec.ID)
+	if s.webhooks.Secret != "" {
+		t := now()
+		req.Header.Set(SignatureHeader, "t="+strconv.FormatInt(t, 10)+",v1="+Sign(s.webhooks.Secret, t, payload))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T, cfg config.Jobs) *Service {
+	t.Helper()
+	cfg.Dir = t.TempDir()
+	s, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// submit sends body to handler as a job of user.
+func submit(t *testing.T, s *Service, user, body, callback string, handler http.Handler) Job {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	r.Header.Set("Prefer", "respond-async")
+	r = r.WithContext(context.WithValue(r.Context(), "user_id", user))
+	job, err := s.Submit(r, []byte(body), callback, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// waitFor polls a job until it is finished.
+func waitFor(t *testing.T, s *Service, owner, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := s.Job(owner, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == StatusCompleted || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobStoresResponse(t *testing.T) {
+	s := newTestService(t, config.Jobs{})
+	s.Start()
+	defer s.Stop()
+
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Prefer") != "" {
+			t.Error("expected the Prefer header to be removed")
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Upstream", "yes")
+		w.Write([]byte(`{"echo": ` + string(body) + `, "user": "` + r.Context().Value("user_id").(string) + `"}`))
+	})
+	job := submit(t, s, "alice", `{"model": "gpt-4"}`, "", handler)
+	if job.Status != StatusQueued || !strings.HasPrefix(job.ID, "job_") {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if _, _, err := s.Result("alice", job.ID); !errors.Is(err, ErrPending) {
+		t.Errorf("expected the result to be pending, got %v", err)
+	}
+	close(release)
+
+	job = waitFor(t, s, "alice", job.ID)
+	if job.Status != StatusCompleted || job.Response.StatusCode != 200 || job.ExpiresAt == nil {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if body := string(job.Response.Body); body != `{"echo": {"model": "gpt-4"}, "user": "alice"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+	if _, body, err := s.Result("alice", job.ID); err != nil || !strings.Contains(string(body), `"user": "alice"`) {
+		t.Errorf("unexpected result %s, %v", body, err)
+	}
+	if _, err := s.Job("bob", job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another user's job to be hidden, got %v", err)
+	}
+}
+
+func TestJobFailsOnErrorResponse(t *testing.T) {
+	s := newTestService(t, config.Jobs{})
+	s.Start()
+	defer s.Stop()
+
+	job := submit(t, s, "", `{}`, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("not json"))
+	}))
+	job = waitFor(t, s, "", job.ID)
+	if job.Status != StatusFailed || job.Response.StatusCode != http.StatusBadGateway || job.Response.Body != nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if _, body, _ := s.Result("", job.ID); string(body) != "not json" {
+		t.Errorf("unexpected result %q", body)
+	}
+}
+
+func TestJobSendsSignedCallback(t *testing.T) {
+	received := make(chan *http.Request, 2)
+	payloads := make(chan []byte, 2)
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		payloads <- body
+	}))
+	defer receiver.Close()
+	host, _ := url.Parse(receiver.URL)
+
+	s := newTestService(t, config.Jobs{Webhooks: config.Webhooks{AllowedHosts: []string{host.Hostname()}, Secret: "secret"}})
+	s.Start()
+	defer s.Stop()
+
+	if err := s.CheckCallback("http://evil.example/hook"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected a callback to another host to be rejected, got %v", err)
+	}
+	if err := s.CheckCallback("ftp://" + host.Host); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected a non-HTTP callback to be rejected, got %v", err)
+	}
+	if err := s.CheckCallback(receiver.URL + "/hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	job := submit(t, s, "", `{}`, receiver.URL+"/hook", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true}`))
+	}))
+
+	var r *http.Request
+	var payload []byte
+	select {
+	case r = <-received:
+		payload = <-payloads
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback received")
+	}
+	if r.Header.Get(JobIDHeader) != job.ID {
+		t.Errorf("unexpected job ID header %q", r.Header.Get(JobIDHeader))
+	}
+	var ts int64
+	var signature string
+	for _, part := range strings.Split(r.Header.Get(SignatureHeader), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if signature == "" || signature != Sign("secret", ts, payload) {
+		t.Errorf("invalid signature %q", r.Header.Get(SignatureHeader))
+	}
+	var notified Job
+	json.Unmarshal(payload, &notified)
+	if notified.ID != job.ID || notified.Status != StatusCompleted || string(notified.Response.Body) != `{"ok":true}` {
+		t.Errorf("unexpected payload %s", payload)
+	}
+}
+
+func TestCallbackDoesNotFollowRedirects(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a callback was redirected to a host that is not allowed")
+	}))
+	defer internal.Close()
+	redirector := httptest.NewServer(http.RedirectHandler(internal.URL+"/admin", http.StatusFound))
+	defer redirector.Close()
+	host, _ := url.Parse(redirector.URL)
+
+	s := newTestService(t, config.Jobs{Webhooks: config.Webhooks{AllowedHosts: []string{host.Hostname()}}})
+	defer s.Stop()
+
+	if err := s.CheckCallback(redirector.URL + "/hook"); err != nil {
+		t.Fatal(err)
+	}
+	rec := jobRecord{Job: Job{ID: "job_redirect", Object: "job", Status: StatusCompleted}, Callback: redirector.URL + "/hook"}
+	if err := s.deliver(rec, []byte(`{}`)); err == nil {
+		t.Error("expected a redirected callback to fail")
+	}
+}
+
+func TestCallbacksDisabledWithoutAllowedHosts(t *testing.T) {
+	s := newTestService(t, config.Jobs{})
+	defer s.Stop()
+	if err := s.CheckCallback("https://example.com/hook"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected callbacks to be rejected, got %v", err)
+	}
+}
+
+func TestJobFailsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewService(config.Jobs{Dir: dir, Retention: time.Hour})
+	s.Start()
+	started := make(chan struct{})
+	job := submit(t, s, "", `{}`, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	<-started
+	s.Stop()
+
+	s, _ = NewService(config.Jobs{Dir: dir, Retention: time.Hour})
+	s.Start()
+	defer s.Stop()
+	got, err := s.Job("", job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusFailed || got.Error == nil || got.Response != nil {
+		t.Errorf("unexpected job %+v", got)
+	}
+	if _, _, err := s.Result("", job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no result, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// resultsBucket holds the response body of each finished job.
+	resultsBucket = []byte("results")
+)
+
+// jobRecord is a stored job with the user who submitted it.
+type jobRecord struct {
+	Job
+	Owner string `json:"owner"`
+	// Callback is the URL notified when the job finishes.
+	Callback string `json:"callback,omitempty"`
+}
+
+// store persists jobs and their results in a bbolt database.
+type store struct {
+	db *bolt.DB
+}
+
+// errMissing is returned for jobs that do not exist.
+var errMissing = errors.New("missing")
+
+func openStore(path string) (*store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, resultsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &store{db: db}, nil
+}
+
+func (s *store) close() error {
+	return s.db.Close()
+}
+
+func (s *store) put(rec jobRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(rec.ID), data)
+	})
+}
+
+// job returns a job, or errMissing.
+func (s *store) job(id string) (jobRecord, error) {
+	var rec jobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return errMissing
+		}
+		return json.Unmarshal(data, &rec)
+	})
+	return rec, err
+}
+
+func (s *store) jobs() ([]jobRecord, error) {
+	var recs []jobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+			var rec jobRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+			return nil
+		})
+	})
+	return recs, err
+}
+
+// finish stores the final state of a job together with its response body.
+func (s *store) finish(rec jobRecord, body []byte) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if body != nil {
+			if err := tx.Bucket(resultsBucket).Put([]byte(rec.ID), body); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(jobsBucket).Put([]byte(rec.ID), data)
+	})
+}
+
+// result returns the response body of a finished job.
+func (s *store) result(id string) ([]byte, error) {
+	var body []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		body = append(body, tx.Bucket(resultsBucket).Get([]byte(id))...)
+		return nil
+	})
+	return body, err
+}
+
+func (s *store) delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(resultsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
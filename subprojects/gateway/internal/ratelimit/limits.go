@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"llm-gateway/internal/config"
+	"sync/atomic"
+)
+
+// Limits holds the rate limit configuration, which can be replaced at runtime.
+type Limits struct {
+	cfg atomic.Pointer[config.RateLimit]
+}
+
+// NewLimits creates Limits holding cfg.
+func NewLimits(cfg config.RateLimit) *Limits {
+	l := &Limits{}
+	l.Set(cfg)
+	return l
+}
+
+// Get returns the current configuration.
+func (l *Limits) Get() config.RateLimit {
+	return *l.cfg.Load()
+}
+
+// Set replaces the configuration.
+func (l *Limits) Set(cfg config.RateLimit) {
+	l.cfg.Store(&cfg)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"llm-gateway/internal/batch"
+	"llm-gateway/internal/config"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchListLimit = 20
+	maxBatchListLimit     = 100
+)
+
+// SetBatches enables /v1/files and /v1/batches, served by s.
+func (h *GatewayHandler) SetBatches(s *batch.Service) {
+	h.batches = s
+}
+
+// RegisterBatchRoutes registers the Files and Batch API routes. They do not
+// name a model, so they are meant to be mounted without model authorization;
+// the requests of a batch are authorized when they are sent.
+func (h *GatewayHandler) RegisterBatchRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /v1/files", h.batchesEnabled(h.CreateFile))
+	mux.HandleFunc("GET /v1/files", h.batchesEnabled(h.ListFiles))
+	mux.HandleFunc("GET /v1/files/{id}", h.batchesEnabled(h.GetFile))
+	mux.HandleFunc("DELETE /v1/files/{id}", h.batchesEnabled(h.DeleteFile))
+	mux.HandleFunc("GET /v1/files/{id}/content", h.batchesEnabled(h.GetFileContent))
+	mux.HandleFunc("POST /v1/batches", h.batchesEnabled(h.CreateBatch))
+	mux.HandleFunc("GET /v1/batches", h.batchesEnabled(h.ListBatches))
+	mux.HandleFunc("GET /v1/batches/{id}", h.batchesEnabled(h.GetBatch))
+	mux.HandleFunc("POST /v1/batches/{id}/cancel", h.batchesEnabled(h.CancelBatch))
+}
+
+func (h *GatewayHandler) batchesEnabled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.batches == nil {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestOwner returns the authenticated user, or "" without authentication.
+func requestOwner(r *http.Request) string {
+	userID, _ := r.Context().Value("user_id").(string)
+	return userID
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeBatchError maps an error of the batch service to a response.
+func writeBatchError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, batch.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, batch.ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logrus.Errorf("Batch service error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// CreateFile handles POST /v1/files, streaming the uploaded file to disk.
+func (h *GatewayHandler) CreateFile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.batches.MaxFileSize()+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	// OpenAI clients send the purpose before the file.
+	var purpose string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Invalid multipart body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch part.FormName() {
+		case "purpose":
+			value, _ := io.ReadAll(io.LimitReader(part, 64))
+			purpose = string(value)
+		case "file":
+			content := io.LimitReader(part, h.batches.MaxFileSize()+1)
+			file, err := h.batches.CreateFile(requestOwner(r), part.FileName(), purpose, content)
+			if err != nil {
+				writeBatchError(w, err)
+				return
+			}
+			if file.Bytes > h.batches.MaxFileSize() {
+				h.batches.DeleteFile(requestOwner(r), file.ID)
+				http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			writeJSON(w, file)
+			return
+		}
+	}
+	http.Error(w, "Missing file", http.StatusBadRequest)
+}
+
+// ListFiles handles GET /v1/files.
+func (h *GatewayHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := h.batches.Files(requestOwner(r), r.URL.Query().Get("purpose"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, struct {
+		Object string       `json:"object"`
+		Data   []batch.File `json:"data"`
+	}{Object: "list", Data: files})
+}
+
+// GetFile handles GET /v1/files/{id}.
+func (h *GatewayHandler) GetFile(w http.ResponseWriter, r *http.Request) {
+	file, err := h.batches.File(requestOwner(r), r.PathValue("id"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, file)
+}
+
+// DeleteFile handles DELETE /v1/files/{id}.
+func (h *GatewayHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.batches.DeleteFile(requestOwner(r), id); err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Deleted bool   `json:"deleted"`
+	}{ID: id, Object: "file", Deleted: true})
+}
+
+// GetFileContent handles GET /v1/files/{id}/content.
+func (h *GatewayHandler) GetFileContent(w http.ResponseWriter, r *http.Request) {
+	f, file, err := h.batches.OpenFile(requestOwner(r), r.PathValue("id"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	io.Copy(w, f)
+}
+
+// CreateBatch handles POST /v1/batches.
+func (h *GatewayHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	var req batch.CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	groups, _ := r.Context().Value("user_groups").([]string)
+	models, _ := r.Context().Value("allowed_models").([]string)
+	var rateLimit *config.RateLimitConfig
+	if limit, ok := r.Context().Value("rate_limit").(config.RateLimitConfig); ok {
+		rateLimit = &limit
+	}
+	b, err := h.batches.CreateBatch(requestOwner(r), groups, models, rateLimit, req)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, b)
+}
+
+// ListBatches handles GET /v1/batches, paginated with after and limit.
+func (h *GatewayHandler) ListBatches(w http.ResponseWriter, r *http.Request) {
+	limit := defaultBatchListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxBatchListLimit {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	batches, hasMore, err := h.batches.Batches(requestOwner(r), r.URL.Query().Get("after"), limit)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+
+	response := struct {
+		Object  string        `json:"object"`
+		Data    []batch.Batch `json:"data"`
+		FirstID *string       `json:"first_id"`
+		LastID  *string       `json:"last_id"`
+		HasMore bool          `json:"has_more"`
+	}{Object: "list", Data: batches, HasMore: hasMore}
+	if len(batches) > 0 {
+		response.FirstID, response.LastID = &batches[0].ID, &batches[len(batches)-1].ID
+	}
+	writeJSON(w, response)
+}
+
+// GetBatch handles GET /v1/batches/{id}.
+func (h *GatewayHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	b, err := h.batches.Batch(requestOwner(r), r.PathValue("id"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, b)
+}
+
+// CancelBatch handles POST /v1/batches/{id}/cancel.
+func (h *GatewayHandler) CancelBatch(w http.ResponseWriter, r *http.Request) {
+	b, err := h.batches.CancelBatch(requestOwner(r), r.PathValue("id"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, b)
+}
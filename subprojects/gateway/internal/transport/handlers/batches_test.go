@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"llm-gateway/internal/batch"
+	"llm-gateway/internal/config"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchRoutes(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	h.RegisterBatchRoutes(mux)
+
+	serve := func(method, target, user string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+		if body == nil {
+			body = &bytes.Buffer{}
+		}
+		req := httptest.NewRequest(method, target, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), "user_id", user))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without a batch service the routes do not exist.
+	if rec := serve("GET", "/v1/batches", "alice", nil, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with batches disabled, got %d", rec.Code)
+	}
+
+	s, err := batch.NewService(config.Batches{Dir: t.TempDir(), MaxFileSize: 1024}, http.NotFoundHandler(), func() int64 { return 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	h.SetBatches(s)
+
+	upload := func(content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("purpose", "batch")
+		fw, _ := mw.CreateFormFile("file", "input.jsonl")
+		fw.Write([]byte(content))
+		mw.Close()
+		return serve("POST", "/v1/files", "alice", &body, mw.FormDataContentType())
+	}
+
+	if rec := upload(strings.Repeat("x", 2048)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a large file, got %d: %s", rec.Code, rec.Body)
+	}
+	line := `{"custom_id": "1", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "openai/gpt-4"}}` + "\n"
+	rec := upload(line)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload failed with %d: %s", rec.Code, rec.Body)
+	}
+	var file batch.File
+	json.Unmarshal(rec.Body.Bytes(), &file)
+	if file.Bytes != int64(len(line)) || file.Purpose != batch.PurposeBatch {
+		t.Fatalf("unexpected file %+v", file)
+	}
+
+	if rec := serve("GET", "/v1/files/"+file.ID+"/content", "alice", nil, ""); rec.Body.String() != line {
+		t.Errorf("unexpected content %q", rec.Body)
+	}
+	if rec := serve("GET", "/v1/files/"+file.ID, "bob", nil, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected another user's file to be hidden, got %d", rec.Code)
+	}
+
+	create := bytes.NewBufferString(`{"input_file_id": "` + file.ID + `", "endpoint": "/v1/chat/completions", "completion_window": "24h"}`)
+	rec = serve("POST", "/v1/batches", "alice", create, "application/json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create failed with %d: %s", rec.Code, rec.Body)
+	}
+	var b batch.Batch
+	json.Unmarshal(rec.Body.Bytes(), &b)
+	if b.Object != "batch" || b.InputFileID != file.ID {
+		t.Errorf("unexpected batch %+v", b)
+	}
+
+	create = bytes.NewBufferString(`{"input_file_id": "` + file.ID + `", "endpoint": "/v1/audio/speech", "completion_window": "24h"}`)
+	if rec := serve("POST", "/v1/batches", "alice", create, "application/json"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unsupported endpoint, got %d", rec.Code)
+	}
+
+	var list struct {
+		Data    []batch.Batch `json:"data"`
+		FirstID *string       `json:"first_id"`
+		HasMore bool          `json:"has_more"`
+	}
+	rec = serve("GET", "/v1/batches?limit=1", "alice", nil, "")
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.FirstID == nil || *list.FirstID != b.ID || list.HasMore {
+		t.Errorf("unexpected list %s", rec.Body)
+	}
+	if rec := serve("GET", "/v1/batches?limit=0", "alice", nil, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit=0, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"fmt"
+	"llm-gateway/internal/core/upload"
+	"net/http"
+)
+
+// requireEndpoint wraps a handler so that requests for a model known not to
+// support the endpoint type are rejected with 400 instead of being routed.
+// Malformed bodies are left for the proxy to report.
+func (h *GatewayHandler) requireEndpoint(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		model, _ := upload.Model(r)
+		if message := h.unsupportedEndpoint(model, endpoint); message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// unsupportedEndpoint returns the error message for a model that does not
+// support the endpoint type, or "" if it does or nothing is known about it.
+func (h *GatewayHandler) unsupportedEndpoint(model, endpoint string) string {
+	if supported, known := h.modelsCache.SupportsEndpoint(model, endpoint); known && !supported {
+		return fmt.Sprintf("Model '%s' does not support the %s endpoint", model, endpoint)
+	}
+	return ""
+}
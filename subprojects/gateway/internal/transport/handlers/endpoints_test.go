@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireEndpoint(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object": "list", "data": []}`))
+	})
+	h.modelsCache.SetModels("openai", []core.Model{
+		{ID: "openai/gpt-4o", Endpoints: []string{config.EndpointChat}},
+		{ID: "openai/text-embedding-3-small", Endpoints: []string{config.EndpointEmbeddings}},
+		{ID: "openai/flux-schnell", Endpoints: []string{config.EndpointChat}, EndpointsInferred: true},
+	})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	tests := []struct {
+		path, model string
+		wantStatus  int
+	}{
+		{"/v1/embeddings", "openai/text-embedding-3-small", http.StatusOK},
+		{"/v1/embeddings", "openai/gpt-4o", http.StatusBadRequest},
+		{"/v1/chat/completions", "openai/text-embedding-3-small", http.StatusBadRequest},
+		{"/v1/messages", "openai/text-embedding-3-small", http.StatusBadRequest},
+		{"/v1/rerank", "openai/gpt-4o", http.StatusBadRequest},
+		// Models the gateway knows nothing about are left to the provider.
+		{"/v1/rerank", "openai/unknown", http.StatusOK},
+		// Endpoints guessed from the name do not reject requests.
+		{"/v1/embeddings", "openai/flux-schnell", http.StatusOK},
+	}
+	for _, tt := range tests {
+		body := `{"model": "` + tt.model + `", "input": "hi", "messages": [{"role": "user", "content": "hi"}]}`
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(body)))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s with %s: status %d, want %d: %s", tt.path, tt.model, rec.Code, tt.wantStatus, rec.Body)
+		}
+		if tt.wantStatus == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "does not support the") {
+			t.Errorf("%s with %s: unclear error %s", tt.path, tt.model, rec.Body)
+		}
+	}
+}
+
+func TestRequireEndpointReadsMultipartModel(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"text": "hi"}`))
+	})
+	h.modelsCache.SetModels("openai", []core.Model{
+		{ID: "openai/whisper-1", Endpoints: []string{config.EndpointTranscriptions}},
+		{ID: "openai/tts-1", Endpoints: []string{config.EndpointSpeech}},
+	})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	for model, want := range map[string]int{"openai/whisper-1": http.StatusOK, "openai/tts-1": http.StatusBadRequest} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("model", model)
+		fw, _ := mw.CreateFormFile("file", "speech.wav")
+		fw.Write([]byte("audio"))
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", model, rec.Code, want, rec.Body)
+		}
+	}
+}
@@ -2,31 +2,73 @@ package handlers
 
 import (
 	"encoding/json"
+	"llm-gateway/internal/batch"
+	"llm-gateway/internal/config"
 	"llm-gateway/internal/core"
+	"llm-gateway/internal/core/provider"
+	"llm-gateway/internal/jobs"
 	"net/http"
 )
 
 // GatewayHandler holds the dependencies for the HTTP handlers.
 type GatewayHandler struct {
-	modelsCache *core.ModelsCache
-	proxy       *core.Proxy
+	modelsCache     *core.ModelsCache
+	proxy           *core.Proxy
+	providerManager *provider.Manager
+	// embeddings serves /v1/embeddings; it is the proxy itself unless
+	// batching is enabled.
+	embeddings http.Handler
+	// images serves the image endpoints; see SetImages.
+	images       http.Handler
+	imagesConfig config.Images
+	imageStore   *core.ImageStore
+	// batches serves /v1/files and /v1/batches; nil when disabled.
+	batches *batch.Service
+	// jobs serves /v1/jobs; nil when disabled.
+	jobs *jobs.Service
 }
 
 // NewGatewayHandler creates a new gateway handler.
-func NewGatewayHandler(mc *core.ModelsCache, p *core.Proxy) *GatewayHandler {
+func NewGatewayHandler(mc *core.ModelsCache, p *core.Proxy, pm *provider.Manager) *GatewayHandler {
 	return &GatewayHandler{
-		modelsCache: mc,
-		proxy:       p,
+		modelsCache:     mc,
+		proxy:           p,
+		providerManager: pm,
+		embeddings:      p,
+		images:          p,
 	}
 }
 
+// SetEmbeddingBatcher makes /v1/embeddings coalesce requests through b.
+func (h *GatewayHandler) SetEmbeddingBatcher(b *core.EmbeddingBatcher) {
+	h.embeddings = b
+}
+
 // RegisterRoutes registers the API routes.
 func (h *GatewayHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/models", h.GetModels)
-	mux.HandleFunc("/v1/chat/completions", h.ChatCompletions)
+	mux.HandleFunc("/v1/chat/completions", h.requireEndpoint(config.EndpointChat, h.ChatCompletions))
+	mux.HandleFunc("/v1/messages", h.Messages)
+	mux.HandleFunc("/v1/completions", h.requireEndpoint(config.EndpointCompletions, h.Completions))
+	mux.HandleFunc("/v1/embeddings", h.requireEndpoint(config.EndpointEmbeddings, h.Embeddings))
+	mux.HandleFunc("/v1/moderations", h.requireEndpoint(config.EndpointModerations, h.Moderations))
+	mux.HandleFunc("/v1/rerank", h.requireEndpoint(config.EndpointRerank, h.Rerank))
+	mux.HandleFunc("/v1/audio/transcriptions", h.requireEndpoint(config.EndpointTranscriptions, h.AudioTranscriptions))
+	mux.HandleFunc("/v1/audio/speech", h.requireEndpoint(config.EndpointSpeech, h.AudioSpeech))
+	mux.HandleFunc("/v1/images/generations", h.requireEndpoint(config.EndpointImages, h.limitImages(h.ImageGenerations)))
+	mux.HandleFunc("/v1/images/edits", h.requireEndpoint(config.EndpointImages, h.limitImages(h.ImageEdits)))
 	mux.HandleFunc("/v1/info", h.GetInfo)
 }
 
+// RegisterStatusRoutes registers the operational endpoints and the stored
+// image files. They are meant to be mounted outside of the authentication
+// chain so that probes and image links can reach them.
+func (h *GatewayHandler) RegisterStatusRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/providers/status", h.GetProviderStatus)
+	mux.HandleFunc("/v1/ready", h.GetReadiness)
+	mux.HandleFunc(core.ImageFilesPath, h.ImageFiles)
+}
+
 // GetModels handles the /v1/models endpoint.
 func (h *GatewayHandler) GetModels(w http.ResponseWriter, r *http.Request) {
 	models := h.modelsCache.GetAllModels()
@@ -47,6 +89,38 @@ func (h *GatewayHandler) ChatCompletions(w http.ResponseWriter, r *http.Request)
 	h.proxy.ServeHTTP(w, r)
 }
 
+// Completions handles the legacy /v1/completions endpoint.
+func (h *GatewayHandler) Completions(w http.ResponseWriter, r *http.Request) {
+	h.proxy.ServeHTTP(w, r)
+}
+
+// Embeddings handles the /v1/embeddings endpoint.
+func (h *GatewayHandler) Embeddings(w http.ResponseWriter, r *http.Request) {
+	h.embeddings.ServeHTTP(w, r)
+}
+
+// Moderations handles the /v1/moderations endpoint.
+func (h *GatewayHandler) Moderations(w http.ResponseWriter, r *http.Request) {
+	h.proxy.ServeHTTP(w, r)
+}
+
+// Rerank handles the Cohere and Jina style /v1/rerank endpoint.
+func (h *GatewayHandler) Rerank(w http.ResponseWriter, r *http.Request) {
+	h.proxy.ServeHTTP(w, r)
+}
+
+// AudioTranscriptions handles the multipart /v1/audio/transcriptions
+// endpoint. The uploaded file is streamed to the provider from disk.
+func (h *GatewayHandler) AudioTranscriptions(w http.ResponseWriter, r *http.Request) {
+	h.proxy.ServeHTTP(w, r)
+}
+
+// AudioSpeech handles the /v1/audio/speech endpoint, whose audio response is
+// passed through as is.
+func (h *GatewayHandler) AudioSpeech(w http.ResponseWriter, r *http.Request) {
+	h.proxy.ServeHTTP(w, r)
+}
+
 // GetInfo handles the /v1/info endpoint.
 func (h *GatewayHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
 	response := struct {
@@ -59,3 +133,42 @@ func (h *GatewayHandler) GetInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// GetProviderStatus handles the /v1/providers/status endpoint, reporting the
+// availability and circuit breaker state of every enabled provider.
+func (h *GatewayHandler) GetProviderStatus(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Object string            `json:"object"`
+		Data   []provider.Status `json:"data"`
+	}{
+		Object: "list",
+		Data:   h.providerManager.Status(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetReadiness handles the /v1/ready endpoint. The gateway is ready when at
+// least one provider can take traffic; the response lists every provider.
+func (h *GatewayHandler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	statuses := h.providerManager.Status()
+
+	status, code := "not_ready", http.StatusServiceUnavailable
+	for _, s := range statuses {
+		if s.Available {
+			status, code = "ready", http.StatusOK
+			break
+		}
+	}
+
+	response := struct {
+		Status    string            `json:"status"`
+		Providers []provider.Status `json:"providers"`
+	}{
+		Status:    status,
+		Providers: statuses,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
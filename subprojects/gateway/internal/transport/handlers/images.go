@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"llm-gateway/internal/core/upload"
+	"math"
+	"net/http"
+)
+
+// SetImages configures the image endpoints: response conversion, the store
+// that serves converted images, and the per-group limits. The store may be
+// nil.
+func (h *GatewayHandler) SetImages(cfg config.Images, store *core.ImageStore) {
+	h.imagesConfig = cfg
+	h.imageStore = store
+	h.images = core.NewImageProcessor(h.proxy, cfg, store)
+}
+
+// ImageGenerations handles the /v1/images/generations endpoint.
+func (h *GatewayHandler) ImageGenerations(w http.ResponseWriter, r *http.Request) {
+	h.images.ServeHTTP(w, r)
+}
+
+// ImageEdits handles the multipart /v1/images/edits endpoint.
+func (h *GatewayHandler) ImageEdits(w http.ResponseWriter, r *http.Request) {
+	h.images.ServeHTTP(w, r)
+}
+
+// ImageFiles serves the images stored when converting b64_json responses to
+// url. It is mounted outside of the authentication chain.
+func (h *GatewayHandler) ImageFiles(w http.ResponseWriter, r *http.Request) {
+	if h.imageStore == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.imageStore.ServeHTTP(w, r)
+}
+
+// limitImages wraps an image handler so that requests for more or larger
+// images than the user's groups allow are rejected with 400. Requests that
+// leave n or size to the provider's default are not limited on it. When
+// limits apply, bodies, n and sizes that cannot be parsed are rejected too.
+func (h *GatewayHandler) limitImages(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groups, _ := r.Context().Value("user_groups").([]string)
+		limits := imageLimitsFor(h.imagesConfig, groups)
+		if limits == (imageLimits{}) {
+			next(w, r)
+			return
+		}
+		fields, err := upload.Fields(r)
+		if errors.Is(err, upload.ErrTooLarge) {
+			http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if message := limits.check(fields); message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// imageLimits are the effective limits of a request; zero means no limit.
+type imageLimits struct {
+	maxImages           int
+	maxWidth, maxHeight int
+}
+
+// imageLimitsFor returns the most restrictive combination of the default
+// limits and those of the user's groups.
+func imageLimitsFor(cfg config.Images, groups []string) imageLimits {
+	var limits imageLimits
+	apply := func(l config.ImageLimits) {
+		if l.MaxImages > 0 && (limits.maxImages == 0 || l.MaxImages < limits.maxImages) {
+			limits.maxImages = l.MaxImages
+		}
+		if width, height, ok := config.ParseImageSize(l.MaxSize); ok {
+			if limits.maxWidth == 0 || width < limits.maxWidth {
+				limits.maxWidth = width
+			}
+			if limits.maxHeight == 0 || height < limits.maxHeight {
+				limits.maxHeight = height
+			}
+		}
+	}
+	apply(cfg.Default)
+	for _, group := range groups {
+		if l, ok := cfg.Groups[group]; ok {
+			apply(l)
+		}
+	}
+	return limits
+}
+
+// check returns the reason a request exceeds the limits, or "" if it does not.
+func (l imageLimits) check(fields map[string]string) string {
+	if raw, ok := fields["n"]; ok && l.maxImages > 0 {
+		// n is parsed as a JSON number, so that 10.0 or 1e1 are not
+		// mistaken for a missing n; multipart values parse the same way.
+		var n float64
+		if err := json.Unmarshal([]byte(raw), &n); err != nil || n != math.Trunc(n) {
+			return fmt.Sprintf("Invalid number of images '%s'", raw)
+		}
+		if n > float64(l.maxImages) {
+			return fmt.Sprintf("Requested %g images, the limit is %d", n, l.maxImages)
+		}
+	}
+	if size, ok := fields["size"]; ok && (l.maxWidth > 0 || l.maxHeight > 0) {
+		width, height, ok := config.ParseImageSize(size)
+		if !ok {
+			return fmt.Sprintf("Invalid image size '%s'", size)
+		}
+		if (l.maxWidth > 0 && width > l.maxWidth) || (l.maxHeight > 0 && height > l.maxHeight) {
+			return fmt.Sprintf("Image size %s exceeds the limit of %dx%d", size, l.maxWidth, l.maxHeight)
+		}
+	}
+	return ""
+}
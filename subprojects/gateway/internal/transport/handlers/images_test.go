@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"llm-gateway/internal/config"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImageLimits(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"created": 1, "data": []}`))
+	})
+	h.SetImages(config.Images{
+		Default: config.ImageLimits{MaxImages: 4, MaxSize: "1792x1792"},
+		Groups: map[string]config.ImageLimits{
+			"free":    {MaxImages: 1, MaxSize: "1024x1024"},
+			"premium": {MaxImages: 10},
+		},
+	}, nil)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	tests := []struct {
+		groups     []string
+		body       string
+		wantStatus int
+	}{
+		{nil, `{"model": "openai/dall-e-3", "n": 4, "size": "1792x1024"}`, http.StatusOK},
+		{nil, `{"model": "openai/dall-e-3", "n": 5}`, http.StatusBadRequest},
+		{[]string{"free"}, `{"model": "openai/dall-e-3", "n": 2}`, http.StatusBadRequest},
+		{[]string{"free"}, `{"model": "openai/dall-e-3", "size": "1792x1024"}`, http.StatusBadRequest},
+		{[]string{"free"}, `{"model": "openai/dall-e-3", "n": 1, "size": "1024x1024"}`, http.StatusOK},
+		// Group limits only restrict the default ones further.
+		{[]string{"premium"}, `{"model": "openai/dall-e-3", "n": 5}`, http.StatusBadRequest},
+		{[]string{"premium", "free"}, `{"model": "openai/dall-e-3", "n": 2}`, http.StatusBadRequest},
+		// Values that cannot be parsed do not slip past the limits.
+		{nil, `{"model": "openai/dall-e-3", "n": 10.0}`, http.StatusBadRequest},
+		{nil, `{"model": "openai/dall-e-3", "n": 1e1}`, http.StatusBadRequest},
+		{nil, `{"model": "openai/dall-e-3", "n": 1.5}`, http.StatusBadRequest},
+		{nil, `{"model": "openai/dall-e-3", "n": "many"}`, http.StatusBadRequest},
+		{nil, `{"model": "openai/dall-e-3", "n": 2.0}`, http.StatusOK},
+		{nil, `{"model": "openai/dall-e-3", "size": "auto"}`, http.StatusBadRequest},
+		{nil, `{"model": "openai/dall-e-3", "n": 1`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/images/generations", strings.NewReader(tt.body))
+		req = req.WithContext(context.WithValue(req.Context(), "user_groups", tt.groups))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("groups %v with %s: status %d, want %d: %s", tt.groups, tt.body, rec.Code, tt.wantStatus, rec.Body)
+		}
+	}
+
+	// Edits are multipart forms.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("model", "openai/gpt-image-1")
+	mw.WriteField("n", "3")
+	fw, _ := mw.CreateFormFile("image", "cat.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+	req := httptest.NewRequest("POST", "/v1/images/edits", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), "user_groups", []string{"free"}))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "the limit is 1") {
+		t.Errorf("edit: status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"llm-gateway/internal/jobs"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetJobs enables /v1/jobs, served by s.
+func (h *GatewayHandler) SetJobs(s *jobs.Service) {
+	h.jobs = s
+}
+
+// RegisterJobRoutes registers the routes polling asynchronous requests. Like
+// the batch routes, they are meant to be mounted without model authorization.
+func (h *GatewayHandler) RegisterJobRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/jobs/{id}", h.jobsEnabled(h.GetJob))
+	mux.HandleFunc("GET /v1/jobs/{id}/content", h.jobsEnabled(h.GetJobContent))
+}
+
+func (h *GatewayHandler) jobsEnabled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.jobs == nil {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeJobError maps an error of the job service to a response.
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, jobs.ErrPending):
+		http.Error(w, "The job has not finished", http.StatusConflict)
+	default:
+		logrus.Errorf("Job service error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// GetJob handles GET /v1/jobs/{id}.
+func (h *GatewayHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Job(requestOwner(r), r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, job)
+}
+
+// GetJobContent handles GET /v1/jobs/{id}/content, replaying the response of
+// a finished job with its original status and content type.
+func (h *GatewayHandler) GetJobContent(w http.ResponseWriter, r *http.Request) {
+	job, body, err := h.jobs.Result(requestOwner(r), r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	if job.Response.ContentType != "" {
+		w.Header().Set("Content-Type", job.Response.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(job.Response.StatusCode)
+	w.Write(body)
+}
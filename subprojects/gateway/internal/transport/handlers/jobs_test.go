@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/jobs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobRoutes(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	h.RegisterJobRoutes(mux)
+	get := func(target, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user_id", user))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/v1/jobs/job_1", "alice"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with jobs disabled, got %d", rec.Code)
+	}
+
+	s, err := jobs.NewService(config.Jobs{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	h.SetJobs(s)
+
+	release := make(chan struct{})
+	r := httptest.NewRequest("POST", "/v1/audio/speech", strings.NewReader(`{}`))
+	r = r.WithContext(context.WithValue(r.Context(), "user_id", "alice"))
+	job, _ := s.Submit(r, []byte(`{}`), "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("mp3"))
+	}))
+
+	if rec := get("/v1/jobs/"+job.ID+"/content", "alice"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a running job, got %d", rec.Code)
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if rec := get("/v1/jobs/"+job.ID, "alice"); strings.Contains(rec.Body.String(), `"status":"completed"`) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := get("/v1/jobs/"+job.ID+"/content", "alice")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Type") != "audio/mpeg" || rec.Body.String() != "mp3" {
+		t.Errorf("unexpected content %d %v %q", rec.Code, rec.Header(), rec.Body)
+	}
+	if rec := get("/v1/jobs/"+job.ID, "bob"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected another user's job to be hidden, got %d", rec.Code)
+	}
+}
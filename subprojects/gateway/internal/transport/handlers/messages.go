@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core/adapter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Messages handles the Anthropic-compatible /v1/messages endpoint. The
+// request is translated into a chat completion and proxied like any other,
+// so routing, fallback and every provider type apply unchanged; the response
+// is translated back into the Messages API format.
+func (h *GatewayHandler) Messages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMessagesError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeMessagesError(w, http.StatusInternalServerError, "Failed to read request body")
+		return
+	}
+	r.Body.Close()
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &req)
+	if message := h.unsupportedEndpoint(req.Model, config.EndpointChat); message != "" {
+		writeMessagesError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	chat, err := adapter.MessagesToChat(body)
+	if err != nil {
+		writeMessagesError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.URL.Path = "/v1/chat/completions"
+	out.URL.RawPath = ""
+	out.Body = io.NopCloser(bytes.NewReader(chat))
+	out.ContentLength = int64(len(chat))
+	out.Header.Set("Content-Length", strconv.Itoa(len(chat)))
+	// Anthropic SDK headers are meant for this gateway, not for whichever
+	// provider ends up serving the request.
+	out.Header.Del("x-api-key")
+	for key := range out.Header {
+		if strings.HasPrefix(strings.ToLower(key), "anthropic-") {
+			out.Header.Del(key)
+		}
+	}
+
+	mw := &messagesWriter{ResponseWriter: w}
+	h.proxy.ServeHTTP(mw, out)
+	mw.finish()
+}
+
+// writeMessagesError writes an error in the Messages API format.
+func writeMessagesError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(adapter.MessagesError(status, []byte(message)))
+}
+
+// messagesWriter translates the chat completion written by the proxy into a
+// Messages API response. Event streams are translated as they are written;
+// JSON bodies and errors are buffered and translated once complete.
+type messagesWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	stream      *adapter.MessagesStream
+	buf         bytes.Buffer
+}
+
+func (m *messagesWriter) WriteHeader(status int) {
+	if m.wroteHeader {
+		return
+	}
+	m.wroteHeader = true
+	m.status = status
+
+	header := m.Header()
+	if status < 300 && strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		header.Del("Content-Length")
+		m.stream = adapter.NewMessagesStream(m.ResponseWriter)
+		m.ResponseWriter.WriteHeader(status)
+	}
+	// Buffered responses are written by finish, once their length is known.
+}
+
+func (m *messagesWriter) Write(p []byte) (int, error) {
+	if !m.wroteHeader {
+		m.WriteHeader(http.StatusOK)
+	}
+	if m.stream != nil {
+		return m.stream.Write(p)
+	}
+	return m.buf.Write(p)
+}
+
+// Flush passes flushes through for event streams, so that events reach the
+// client as soon as they are translated.
+func (m *messagesWriter) Flush() {
+	if m.stream == nil {
+		return
+	}
+	if f, ok := m.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish completes the response once the proxy is done with it.
+func (m *messagesWriter) finish() {
+	if m.stream != nil {
+		m.stream.Close()
+		m.Flush()
+		return
+	}
+	if !m.wroteHeader {
+		m.WriteHeader(http.StatusOK)
+	}
+
+	body := m.buf.Bytes()
+	if m.status < 300 {
+		translated, err := adapter.ChatToMessages(body)
+		if err != nil {
+			m.status = http.StatusBadGateway
+			body = adapter.MessagesError(m.status, []byte("Failed to translate response: "+err.Error()))
+		} else {
+			body = translated
+		}
+	} else {
+		body = adapter.MessagesError(m.status, body)
+	}
+
+	header := m.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	m.ResponseWriter.WriteHeader(m.status)
+	m.ResponseWriter.Write(body)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"llm-gateway/internal/core/provider"
+	"llm-gateway/internal/core/router"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestHandler creates a gateway handler proxying to a single OpenAI
+// provider served by handler.
+func newTestHandler(t *testing.T, handler http.HandlerFunc) *GatewayHandler {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	providers := []config.Provider{{
+		Name: "openai", Enabled: true, TargetURL: server.URL, APIKey: "test-api-key", Timeout: 5 * time.Second,
+	}}
+	strategies := []config.Strategy{{Name: "default", Providers: []string{"openai"}}}
+	pm := provider.NewManager(providers)
+	r := router.NewRouter(strategies, config.Routing{DefaultStrategy: "default"}, pm)
+	return NewGatewayHandler(core.NewModelsCache(), core.NewProxy(pm, r, nil), pm)
+}
+
+func TestMessages(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("x-api-key") != "" {
+			t.Errorf("unexpected upstream request %s with headers %v", r.URL.Path, r.Header)
+		}
+		var chat struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&chat); err != nil || len(chat.Messages) != 2 ||
+			chat.Messages[0].Role != "system" || chat.Messages[0].Content != "Be brief." {
+			t.Errorf("unexpected upstream messages %+v, %v", chat.Messages, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "chatcmpl-1", "model": "gpt-4o", "choices": [{"message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}}`))
+	})
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model": "gpt-4o", "max_tokens": 10, "system": "Be brief.", "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("x-api-key", "client-key")
+	rec := httptest.NewRecorder()
+	h.Messages(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	var msg struct {
+		Type    string `json:"type"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body, err)
+	}
+	if msg.Type != "message" || len(msg.Content) != 1 || msg.Content[0].Text != "Hello" || msg.StopReason != "end_turn" {
+		t.Errorf("unexpected message %s", rec.Body)
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Content-Length %s does not match body length %d", got, rec.Body.Len())
+	}
+}
+
+func TestMessagesStream(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n"))
+		w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	})
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model": "gpt-4o", "max_tokens": 10, "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`))
+	rec := httptest.NewRecorder()
+	h.Messages(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+	body := rec.Body.String()
+	for _, event := range []string{"message_start", "content_block_delta", "message_delta", "message_stop"} {
+		if !strings.Contains(body, "event: "+event+"\n") {
+			t.Errorf("missing %s event in %s", event, body)
+		}
+	}
+	if strings.Contains(body, "[DONE]") {
+		t.Errorf("chat completion stream leaked into the response: %s", body)
+	}
+}
+
+func TestMessagesUpstreamError(t *testing.T) {
+	h := newTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "context too long", "type": "invalid_request_error"}}`))
+	})
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`))
+	rec := httptest.NewRecorder()
+	h.Messages(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	want := `{"error":{"message":"context too long","type":"invalid_request_error"},"type":"error"}`
+	if rec.Body.String() != want {
+		t.Errorf("body = %s, want %s", rec.Body, want)
+	}
+}
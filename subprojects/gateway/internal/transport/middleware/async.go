@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"llm-gateway/internal/core/upload"
+	"llm-gateway/internal/jobs"
+	"net/http"
+	"strings"
+)
+
+// CallbackHeader carries the URL notified when an asynchronous request
+// finishes.
+const CallbackHeader = "X-Callback-Url"
+
+// Async accepts POST requests sent with "Prefer: respond-async" as jobs of s,
+// answering 202 with the job instead of waiting for the response. It should
+// come after authentication and rate limiting, so that the job runs as the
+// authenticated user and submitting it counts against the user's limit.
+func (m *Manager) Async(s *jobs.Service) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || !prefersAsync(r.Header) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			callback := r.Header.Get(CallbackHeader)
+			if callback != "" {
+				if err := s.CheckCallback(callback); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.MaxRequestSize()))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// Invalid bodies are left for the job's response to report.
+			// Multipart bodies are not parsed here, since parsing re-encodes
+			// them with a new boundary.
+			if !upload.IsMultipart(r) {
+				if fields, err := upload.Fields(r); err == nil && fields["stream"] == "true" {
+					http.Error(w, "Streaming requests cannot be asynchronous", http.StatusBadRequest)
+					return
+				}
+			}
+
+			job, err := s.Submit(r, body, callback, next)
+			if err != nil {
+				m.Logger.Errorf("Failed to submit job: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			m.Logger.Infof("Accepted %s as job %s", r.URL.Path, job.ID)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", "/v1/jobs/"+job.ID)
+			w.Header().Set("Preference-Applied", "respond-async")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(job)
+		})
+	}
+}
+
+// prefersAsync reports whether the Prefer headers (RFC 7240) ask for an
+// asynchronous response.
+func prefersAsync(header http.Header) bool {
+	for _, value := range header.Values("Prefer") {
+		for _, preference := range strings.Split(value, ",") {
+			token, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.TrimSpace(token), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"encoding/json"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/jobs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAsyncAcceptsPreferredRequests(t *testing.T) {
+	s, err := jobs.NewService(config.Jobs{Dir: t.TempDir(), MaxRequestSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	served := make(chan string, 1)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- r.URL.Path
+		w.Write([]byte(`{}`))
+	})
+	handler := NewManager(logrus.New()).Async(s)(next)
+
+	tests := []struct {
+		prefer     string
+		body       string
+		wantStatus int
+		wantServed bool
+	}{
+		{"", `{"model": "gpt-4"}`, http.StatusOK, true},
+		{"return=minimal", `{"model": "gpt-4"}`, http.StatusOK, true},
+		{"respond-async, wait=10", `{"model": "gpt-4"}`, http.StatusAccepted, true},
+		{"Respond-Async", `{"model": "gpt-4", "stream": true}`, http.StatusBadRequest, false},
+		{"respond-async", `{"model": "gpt-4", "messages": "` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+		if tt.prefer != "" {
+			req.Header.Set("Prefer", tt.prefer)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("Prefer %q with %s: status %d, want %d", tt.prefer, tt.body, rec.Code, tt.wantStatus)
+			continue
+		}
+
+		if rec.Code == http.StatusAccepted {
+			var job jobs.Job
+			json.Unmarshal(rec.Body.Bytes(), &job)
+			if rec.Header().Get("Location") != "/v1/jobs/"+job.ID || rec.Header().Get("Preference-Applied") != "respond-async" {
+				t.Errorf("unexpected headers %v", rec.Header())
+			}
+		}
+		select {
+		case <-served:
+			if !tt.wantServed {
+				t.Errorf("Prefer %q with %s: unexpectedly served", tt.prefer, tt.body)
+			}
+		case <-time.After(time.Second):
+			if tt.wantServed {
+				t.Errorf("Prefer %q with %s: not served", tt.prefer, tt.body)
+			}
+		}
+	}
+
+	// Callbacks are only accepted to allowed hosts.
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set("Prefer", "respond-async")
+	req.Header.Set(CallbackHeader, "http://169.254.169.254/")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected the callback to be rejected, got %d", rec.Code)
+	}
+}
@@ -1,13 +1,15 @@
 package middleware
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
+	"slices"
+	"sync"
 
+	"llm-gateway/internal/apikeys"
 	"llm-gateway/internal/config"
 	"llm-gateway/internal/core"
+	"llm-gateway/internal/core/upload"
 
 	"github.com/sirupsen/logrus"
 )
@@ -21,40 +23,46 @@ type ModelRequest struct {
 // is authorized to use a specific model.
 type Authorizer struct {
 	log         *logrus.Logger
+	mu          sync.RWMutex
 	providers   []config.Provider
+	aliases     []config.Alias
 	modelsCache *core.ModelsCache
 }
 
 // NewAuthorizer creates a new Authorizer middleware.
-func NewAuthorizer(log *logrus.Logger, providers []config.Provider, modelsCache *core.ModelsCache) *Authorizer {
+func NewAuthorizer(log *logrus.Logger, providers []config.Provider, aliases []config.Alias, modelsCache *core.ModelsCache) *Authorizer {
 	return &Authorizer{
 		log:         log,
 		providers:   providers,
+		aliases:     aliases,
 		modelsCache: modelsCache,
 	}
 }
 
+// SetProviders replaces the providers whose models' allowed_groups are
+// enforced.
+func (a *Authorizer) SetProviders(providers []config.Provider) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.providers = providers
+}
+
 // Authorization is the middleware handler for authorization.
 func (m *Manager) Authorization(authz *Authorizer) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 1. Read the request body to get the model name.
-			body, err := io.ReadAll(r.Body)
-			if err != nil {
-				authz.log.Errorf("Failed to read request body: %v", err)
-				http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			// 1. Read the model name from the JSON or multipart body, which
+			// stays readable for the next handler.
+			modelName, err := upload.Model(r)
+			if errors.Is(err, upload.ErrTooLarge) {
+				http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
 				return
 			}
-			// Restore the body so it can be read again by the next handler.
-			r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-			var req ModelRequest
-			if err := json.Unmarshal(body, &req); err != nil {
-				authz.log.Errorf("Failed to unmarshal request body: %v", err)
+			if err != nil {
+				authz.log.Errorf("Failed to read model from request body: %v", err)
 				http.Error(w, "Invalid request format", http.StatusBadRequest)
 				return
 			}
-			modelName := req.Model
 
 			// 2. Get the user's groups from the context.
 			userGroups, ok := r.Context().Value("user_groups").([]string)
@@ -73,17 +81,24 @@ func (m *Manager) Authorization(authz *Authorizer) Middleware {
 				return
 			}
 
-			// If allowed_groups is empty, access is permitted for all authenticated users.
-			if len(model.AllowedGroups) == 0 {
-				next.ServeHTTP(w, r)
+			// API keys may be restricted to some models, by requested or
+			// configured name.
+			if patterns, ok := r.Context().Value("allowed_models").([]string); ok && !apikeys.AllowsModel(patterns, modelName, model.Name) {
+				authz.log.Warnf("API key is not allowed to use model '%s'", modelName)
+				http.Error(w, "This API key is not allowed to use this model", http.StatusForbidden)
 				return
 			}
 
-			// 4. Check for group membership.
-			if !isAuthorized(userGroups, model.AllowedGroups) {
-				authz.log.Warnf("User with groups %v is not authorized for model '%s'", userGroups, modelName)
-				http.Error(w, "You are not authorized to use this model", http.StatusForbidden)
-				return
+			// 4. Check for group membership. If allowed_groups is empty, access
+			// is permitted for all authenticated users. An alias also requires
+			// the groups of every model it targets, so that it cannot widen
+			// access to them.
+			for _, rule := range append([]config.Model{model}, authz.aliasTargets(modelName)...) {
+				if len(rule.AllowedGroups) > 0 && !isAuthorized(userGroups, rule.AllowedGroups) {
+					authz.log.Warnf("User with groups %v is not authorized for model '%s'", userGroups, rule.Name)
+					http.Error(w, "You are not authorized to use this model", http.StatusForbidden)
+					return
+				}
 			}
 
 			authz.log.Infof("User with groups %v is authorized for model '%s'", userGroups, modelName)
@@ -114,7 +129,16 @@ func (a *Authorizer) findModel(modelName string) (config.Model, bool) {
 	// check its authorization rules from the static config if they exist.
 	// If the model is purely dynamic, it's allowed.
 
+	// Aliases carry their own allowed_groups.
+	for _, alias := range a.aliases {
+		if alias.Name == modelName {
+			return config.Model{Name: alias.Name, AllowedGroups: alias.AllowedGroups}, true
+		}
+	}
+
 	// Fallback to static config check to find allowed_groups
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	for _, p := range a.providers {
 		for _, m := range p.Models {
 			// Note: This assumes the dynamic model name matches the static config name.
@@ -129,6 +153,33 @@ func (a *Authorizer) findModel(modelName string) (config.Model, bool) {
 	return config.Model{Name: modelName, AllowedGroups: []string{}}, true
 }
 
+// aliasTargets returns the static configuration of the models an alias
+// targets. It returns nil if modelName is not an alias.
+func (a *Authorizer) aliasTargets(modelName string) []config.Model {
+	var targets []string
+	for _, alias := range a.aliases {
+		if alias.Name == modelName {
+			targets = alias.Targets
+			break
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var models []config.Model
+	for _, p := range a.providers {
+		for _, m := range p.Models {
+			if slices.Contains(targets, m.Name) {
+				models = append(models, m)
+			}
+		}
+	}
+	return models
+}
+
 // isAuthorized checks if any of the user's groups are in the list of allowed groups.
 func isAuthorized(userGroups, allowedGroups []string) bool {
 	allowedMap := make(map[string]struct{}, len(allowedGroups))
@@ -143,3 +194,19 @@ func isAuthorized(userGroups, allowedGroups []string) bool {
 	}
 	return false
 }
+
+// RequireGroup rejects requests from users who are not in group. It must come
+// after authentication.
+func (m *Manager) RequireGroup(group string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groups, _ := r.Context().Value("user_groups").([]string)
+			if !slices.Contains(groups, group) {
+				m.Logger.Warnf("Rejected %s %s from a user outside of group '%s'", r.Method, r.URL.Path, group)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthorizationAppliesAliasGroups(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	aliases := []config.Alias{
+		{Name: "chat-default", Targets: []string{"openai/gpt-4"}, AllowedGroups: []string{"premium-users"}},
+	}
+	cache := core.NewModelsCache()
+	cache.SetAliases(aliases)
+
+	authz := NewAuthorizer(logger, nil, aliases, cache)
+	handler := NewManager(logger).Authorization(authz)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		groups []string
+		want   int
+	}{
+		{groups: []string{"premium-users"}, want: http.StatusOK},
+		{groups: []string{"testgroup"}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "chat-default"}`))
+		req = req.WithContext(context.WithValue(req.Context(), "user_groups", tt.groups))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("groups %v: got status %d, want %d", tt.groups, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestAuthorizationAppliesAliasTargetGroups(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	providers := []config.Provider{
+		{Name: "openai", Models: []config.Model{{Name: "openai/gpt-4", AllowedGroups: []string{"premium-users"}}}},
+	}
+	aliases := []config.Alias{
+		{Name: "chat-default", Targets: []string{"openai/gpt-4"}},
+	}
+	cache := core.NewModelsCache()
+	cache.SetAliases(aliases)
+
+	authz := NewAuthorizer(logger, providers, aliases, cache)
+	handler := NewManager(logger).Authorization(authz)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		groups []string
+		want   int
+	}{
+		{groups: []string{"premium-users"}, want: http.StatusOK},
+		{groups: []string{"testgroup"}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "chat-default"}`))
+		req = req.WithContext(context.WithValue(req.Context(), "user_groups", tt.groups))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("groups %v: got status %d, want %d", tt.groups, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestAuthorizationReadsMultipartModel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	providers := []config.Provider{
+		{Name: "openai", Models: []config.Model{{Name: "openai/whisper-1", AllowedGroups: []string{"audio"}}}},
+	}
+	cache := core.NewModelsCache()
+	cache.SetModels("openai", []core.Model{{ID: "openai/whisper-1"}})
+	authz := NewAuthorizer(logger, providers, nil, cache)
+	var forwarded string
+	handler := NewManager(logger).Authorization(authz)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		forwarded = r.FormValue("model")
+	}))
+
+	for _, tt := range []struct {
+		groups []string
+		want   int
+	}{
+		{groups: []string{"audio"}, want: http.StatusOK},
+		{groups: []string{"testgroup"}, want: http.StatusForbidden},
+	} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("model", "openai/whisper-1")
+		fw, _ := mw.CreateFormFile("file", "speech.wav")
+		fw.Write([]byte("audio"))
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req = req.WithContext(context.WithValue(req.Context(), "user_groups", tt.groups))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("groups %v: got status %d, want %d", tt.groups, rr.Code, tt.want)
+		}
+	}
+	if forwarded != "openai/whisper-1" {
+		t.Errorf("expected the form to reach the next handler, got model %q", forwarded)
+	}
+}
+
+func TestRequireGroup(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	handler := NewManager(logger).RequireGroup("gateway-admins")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		groups []string
+		want   int
+	}{
+		{groups: []string{"users", "gateway-admins"}, want: http.StatusOK},
+		{groups: []string{"users"}, want: http.StatusForbidden},
+		{groups: nil, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/admin/v1/providers", nil)
+		if tt.groups != nil {
+			req = req.WithContext(context.WithValue(req.Context(), "user_groups", tt.groups))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("groups %v: got status %d, want %d", tt.groups, rr.Code, tt.want)
+		}
+	}
+}
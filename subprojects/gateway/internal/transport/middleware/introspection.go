@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIntrospectionCacheTTL    = 5 * time.Minute
+	defaultIntrospectionNegativeTTL = 30 * time.Second
+	introspectionTimeout            = 10 * time.Second
+	// maxIntrospectionCache is the number of cached results above which
+	// expired ones are removed.
+	maxIntrospectionCache = 10000
+)
+
+// introspector validates opaque tokens at an RFC 7662 token introspection
+// endpoint, caching the results by token hash.
+type introspector struct {
+	cfg config.Introspection
+	// mapping maps introspection responses to users like token claims.
+	mapping config.Issuer
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]introspected
+}
+
+// introspected is a cached introspection result. claims is nil for inactive
+// tokens.
+type introspected struct {
+	claims  map[string]any
+	expires time.Time
+}
+
+func newIntrospector(cfg config.Introspection) *introspector {
+	cfg.CacheTTL = cmp.Or(cfg.CacheTTL, defaultIntrospectionCacheTTL)
+	cfg.NegativeCacheTTL = cmp.Or(cfg.NegativeCacheTTL, defaultIntrospectionNegativeTTL)
+	return &introspector{
+		cfg: cfg,
+		mapping: config.Issuer{
+			Issuer:       cfg.URL,
+			Audiences:    cfg.Audiences,
+			GroupsClaim:  cmp.Or(cfg.GroupsClaim, "groups"),
+			SubjectClaim: cmp.Or(cfg.SubjectClaim, "sub"),
+			GroupPrefix:  cfg.GroupPrefix,
+		},
+		client: &http.Client{Timeout: introspectionTimeout},
+		cache:  make(map[string]introspected),
+	}
+}
+
+// introspect returns the claims of an active token, or nil for a token that
+// is inactive, expired or meant for another audience.
+func (i *introspector) introspect(ctx context.Context, token string) (map[string]any, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	now := time.Now()
+	i.mu.Lock()
+	result, ok := i.cache[key]
+	i.mu.Unlock()
+	if ok && now.Before(result.expires) {
+		return result.claims, nil
+	}
+
+	claims, err := i.fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	result = introspected{claims: claims, expires: now.Add(i.cfg.NegativeCacheTTL)}
+	if claims != nil {
+		result.expires = now.Add(i.cfg.CacheTTL)
+		// Active results never outlive the token.
+		if exp, ok := claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(result.expires) {
+			result.expires = time.Unix(int64(exp), 0)
+		}
+	}
+
+	i.mu.Lock()
+	if len(i.cache) >= maxIntrospectionCache {
+		for k, r := range i.cache {
+			if !now.Before(r.expires) {
+				delete(i.cache, k)
+			}
+		}
+		// Results that have not expired are dropped too rather than let
+		// the cache grow without bound.
+		if len(i.cache) >= maxIntrospectionCache {
+			clear(i.cache)
+		}
+	}
+	i.cache[key] = result
+	i.mu.Unlock()
+	return result.claims, nil
+}
+
+// fetch asks the introspection endpoint about a token.
+func (i *introspector) fetch(ctx context.Context, token string) (map[string]any, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749 has client credentials form-encoded before basic auth.
+	req.SetBasicAuth(url.QueryEscape(i.cfg.ClientID), url.QueryEscape(i.cfg.ClientSecret))
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %s", resp.Status)
+	}
+
+	var claims map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, nil
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(time.Now()) {
+		return nil, nil
+	}
+	if len(i.cfg.Audiences) > 0 && !slices.ContainsFunc(audiences(claims["aud"]), func(aud string) bool { return slices.Contains(i.cfg.Audiences, aud) }) {
+		return nil, nil
+	}
+	return claims, nil
+}
+
+// audiences returns the values of an "aud" claim, which is either a string
+// or a list of them.
+func audiences(aud any) []string {
+	switch aud := aud.(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var values []string
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthenticationIntrospectsOpaqueTokens(t *testing.T) {
+	exp := time.Now().Add(time.Minute).Unix()
+	responses := map[string]map[string]any{
+		"alice-token": {
+			"active": true, "sub": "alice", "aud": []string{"gateway"}, "exp": exp,
+			"realm_access": map[string]any{"roles": []string{"users"}},
+		},
+		"revoked-token": {"active": false},
+		"other-token":   {"active": true, "sub": "bob", "aud": "billing", "exp": exp},
+	}
+	var calls atomic.Int32
+	var failing atomic.Bool
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" || failing.Load() {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		response, ok := responses[r.PostForm.Get("token")]
+		if !ok {
+			response = map[string]any{"active": false}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer endpoint.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	auth := NewOIDCAuthenticator(logger, config.Auth{Introspection: config.Introspection{
+		Enabled:      true,
+		URL:          endpoint.URL,
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+		Audiences:    []string{"gateway"},
+		GroupsClaim:  "realm_access.roles",
+		GroupPrefix:  "sso:",
+		CacheTTL:     time.Hour,
+	}})
+	var user string
+	var groups []string
+	handler := NewManager(logger).Authentication(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = r.Context().Value("user_id").(string)
+		groups, _ = r.Context().Value("user_groups").([]string)
+	}))
+
+	tests := []struct {
+		token string
+		want  int
+		calls int32
+	}{
+		{"alice-token", http.StatusOK, 1},
+		// Results are cached, whether the token is active or not.
+		{"alice-token", http.StatusOK, 1},
+		{"revoked-token", http.StatusUnauthorized, 2},
+		{"revoked-token", http.StatusUnauthorized, 2},
+		{"other-token", http.StatusUnauthorized, 3},
+	}
+	for i, tt := range tests {
+		if code := authenticate(handler, tt.token); code != tt.want || calls.Load() != tt.calls {
+			t.Errorf("request %d with %s: got status %d after %d calls, want %d after %d", i, tt.token, code, calls.Load(), tt.want, tt.calls)
+		}
+	}
+	if user != "alice" || !slices.Equal(groups, []string{"sso:users"}) {
+		t.Errorf("unexpected user %q with groups %v", user, groups)
+	}
+
+	// Active results expire with the token rather than after the cache TTL.
+	sum := sha256.Sum256([]byte("alice-token"))
+	if cached := auth.introspector.cache[hex.EncodeToString(sum[:])]; cached.expires.After(time.Unix(exp, 0)) {
+		t.Errorf("cached until %v, after the token expires at %v", cached.expires, time.Unix(exp, 0))
+	}
+
+	// Failures of the endpoint are not cached.
+	failing.Store(true)
+	if code := authenticate(handler, "new-token"); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503 while the endpoint fails", code)
+	}
+	failing.Store(false)
+	responses["new-token"] = responses["alice-token"]
+	if code := authenticate(handler, "new-token"); code != http.StatusOK {
+		t.Errorf("got status %d, want 200 once the endpoint recovers", code)
+	}
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultJWKSRefresh is how often signing keys are refreshed when
+	// auth.cache_ttl is not set.
+	defaultJWKSRefresh = 10 * time.Minute
+	// minJWKSRefetch bounds how often tokens signed with an unknown key
+	// make the keys be fetched again.
+	minJWKSRefetch   = 10 * time.Second
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// signingAlgs are the accepted token signature algorithms.
+var signingAlgs = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// jwks holds the signing keys of an issuer in memory. The keys are loaded
+// from a local JWKS file, or fetched from the issuer's JWKS URL, discovered
+// through its OpenID configuration unless configured. When loading fails,
+// the last keys loaded successfully stay in use.
+type jwks struct {
+	issuer string
+	file   string
+	client *http.Client
+	logger *logrus.Logger
+
+	keys atomic.Pointer[jose.JSONWebKeySet]
+
+	// mu serializes loading; url and loaded are guarded by it.
+	mu     sync.Mutex
+	url    string
+	loaded time.Time
+}
+
+func newJWKS(logger *logrus.Logger, issuer, url, file string) *jwks {
+	return &jwks{
+		issuer: issuer,
+		file:   file,
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		logger: logger,
+	}
+}
+
+// VerifySignature implements oidc.KeySet. Tokens signed with a key that is
+// not known yet make the keys be fetched again, picking up rotated keys.
+func (k *jwks) VerifySignature(ctx context.Context, token string) ([]byte, error) {
+	jws, err := jose.ParseSigned(token, signingAlgs)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+	kid := jws.Signatures[0].Header.KeyID
+
+	set := k.keys.Load()
+	if set == nil || (kid != "" && len(set.Key(kid)) == 0) {
+		k.refetch(ctx, set)
+		set = k.keys.Load()
+	}
+	if set == nil {
+		return nil, errors.New("no signing keys available")
+	}
+	for _, key := range set.Keys {
+		if kid != "" && key.KeyID != kid {
+			continue
+		}
+		if payload, err := jws.Verify(key); err == nil {
+			return payload, nil
+		}
+	}
+	return nil, errors.New("no signing key matches the token")
+}
+
+// ready reports whether keys are available, loading them if none are.
+func (k *jwks) ready(ctx context.Context) bool {
+	if k.keys.Load() == nil {
+		k.refetch(ctx, nil)
+	}
+	return k.keys.Load() != nil
+}
+
+// refetch loads the keys again, unless another request already replaced
+// seen or they were loaded moments ago.
+func (k *jwks) refetch(ctx context.Context, seen *jose.JSONWebKeySet) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys.Load() != seen || time.Since(k.loaded) < minJWKSRefetch {
+		return
+	}
+	k.refresh(ctx)
+}
+
+// refresh loads the keys, keeping the current ones on failure. It must be
+// called with mu held.
+func (k *jwks) refresh(ctx context.Context) {
+	k.loaded = time.Now()
+	set, err := k.load(ctx)
+	if err != nil {
+		k.logger.Errorf("failed to load signing keys of %s: %v", k.issuer, err)
+		return
+	}
+	k.keys.Store(set)
+}
+
+func (k *jwks) load(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	var data []byte
+	if k.file != "" {
+		var err error
+		if data, err = os.ReadFile(k.file); err != nil {
+			return nil, err
+		}
+	} else {
+		if k.url == "" {
+			var discovery struct {
+				JWKSURI string `json:"jwks_uri"`
+			}
+			if err := k.get(ctx, strings.TrimSuffix(k.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+				return nil, fmt.Errorf("discovery failed: %w", err)
+			}
+			if discovery.JWKSURI == "" {
+				return nil, errors.New("discovery returned no jwks_uri")
+			}
+			k.url = discovery.JWKSURI
+		}
+		var raw json.RawMessage
+		if err := k.get(ctx, k.url, &raw); err != nil {
+			return nil, err
+		}
+		data = raw
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("the jwks holds no keys")
+	}
+	return &set, nil
+}
+
+// get fetches a JSON document. Fetches outlive the request that caused them,
+// so that other requests waiting for the keys do not fail with it.
+func (k *jwks) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// run refreshes the keys every interval until stop is closed.
+func (k *jwks) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		k.mu.Lock()
+		k.refresh(context.Background())
+		k.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"llm-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestAuthentication(t *testing.T, issuers ...config.Issuer) (*OIDCAuthenticator, http.Handler) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	auth := NewOIDCAuthenticator(logger, config.Auth{Issuers: issuers})
+	handler := NewManager(logger).Authentication(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	return auth, handler
+}
+
+func authenticate(handler http.Handler, token string) int {
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestJWKSRefetchesOnUnknownKey(t *testing.T) {
+	iss := newTestIssuer(t)
+	auth, handler := newTestAuthentication(t, config.Issuer{Issuer: iss.URL, Audiences: []string{"gateway"}})
+
+	if code := authenticate(handler, iss.token(t, map[string]any{"sub": "alice", "aud": "gateway"})); code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", code)
+	}
+	if code := authenticate(handler, iss.token(t, map[string]any{"sub": "alice", "aud": "gateway"})); code != http.StatusOK || iss.fetches.Load() != 1 {
+		t.Fatalf("expected the keys to be cached, got status %d after %d fetches", code, iss.fetches.Load())
+	}
+
+	// A token signed with a rotated key is accepted once the keys are
+	// fetched again, which happens at most every minJWKSRefetch.
+	iss.rotate(t)
+	rotated := iss.token(t, map[string]any{"sub": "alice", "aud": "gateway"})
+	if code := authenticate(handler, rotated); code != http.StatusUnauthorized || iss.fetches.Load() != 1 {
+		t.Fatalf("expected an immediate refetch to be skipped, got status %d after %d fetches", code, iss.fetches.Load())
+	}
+	keys := auth.issuers[iss.URL].keys
+	keys.mu.Lock()
+	keys.loaded = time.Now().Add(-minJWKSRefetch)
+	keys.mu.Unlock()
+	if code := authenticate(handler, rotated); code != http.StatusOK || iss.fetches.Load() != 2 {
+		t.Errorf("expected the rotated key to be fetched, got status %d after %d fetches", code, iss.fetches.Load())
+	}
+}
+
+func TestJWKSKeepsLastKnownGoodKeys(t *testing.T) {
+	iss := newTestIssuer(t)
+	auth, handler := newTestAuthentication(t, config.Issuer{Issuer: iss.URL, Audiences: []string{"gateway"}})
+	auth.refresh = 10 * time.Millisecond
+	auth.Start()
+	defer auth.Stop()
+
+	token := iss.token(t, map[string]any{"sub": "alice", "aud": "gateway"})
+	if code := authenticate(handler, token); code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", code)
+	}
+
+	// Background refreshes keep failing while the issuer is down.
+	iss.down.Store(true)
+	fetches := iss.fetches.Load()
+	time.Sleep(50 * time.Millisecond)
+	if code := authenticate(handler, token); code != http.StatusOK {
+		t.Errorf("expected the last known keys to be used, got status %d", code)
+	}
+	if iss.fetches.Load() != fetches {
+		t.Errorf("expected no successful fetch while the issuer is down")
+	}
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.down.Store(true)
+	_, handler := newTestAuthentication(t, config.Issuer{Issuer: iss.URL, Audiences: []string{"gateway"}})
+
+	if code := authenticate(handler, iss.token(t, map[string]any{"sub": "alice", "aud": "gateway"})); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503 without any keys", code)
+	}
+}
+
+func TestJWKSFromFile(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.down.Store(true)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	data, _ := json.Marshal(iss.jwks())
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, handler := newTestAuthentication(t, config.Issuer{Issuer: iss.URL, Audiences: []string{"gateway"}, JWKSFile: file})
+
+	if code := authenticate(handler, iss.token(t, map[string]any{"sub": "alice", "aud": "gateway"})); code != http.StatusOK {
+		t.Errorf("got status %d, want 200 with keys from the file", code)
+	}
+}
@@ -1,10 +1,16 @@
 package middleware
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"llm-gateway/internal/apikeys"
+	"llm-gateway/internal/config"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,52 +19,84 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// OIDCAuthenticator is a struct that holds the OIDC provider and verifier.
+// OIDCAuthenticator verifies OIDC tokens of the configured issuers, and
+// optionally gateway API keys.
 type OIDCAuthenticator struct {
-	issuerURL    string
-	clientID     string
-	logger       *logrus.Logger
-	cacheTTL     time.Duration
-	verifier     *oidc.IDTokenVerifier
-	verifierMu   sync.RWMutex
-	lastVerified time.Time
+	logger *logrus.Logger
+	// refresh is how often the signing keys of the issuers are refreshed.
+	refresh time.Duration
+	// issuers maps the "iss" claim of accepted tokens to their issuer.
+	issuers map[string]*issuer
+	// keys authenticates gateway API keys; nil when they are disabled.
+	keys *apikeys.Service
+	// introspector validates opaque tokens; nil when introspection is
+	// disabled.
+	introspector *introspector
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
 }
 
-// NewOIDCAuthenticator creates a new OIDC authenticator.
-func NewOIDCAuthenticator(logger *logrus.Logger, issuerURL, clientID string, cacheTTL time.Duration) *OIDCAuthenticator {
-	return &OIDCAuthenticator{
-		issuerURL: issuerURL,
-		clientID:  clientID,
-		logger:    logger,
-		cacheTTL:  cacheTTL,
-	}
+// issuer is an accepted OIDC issuer with its signing keys.
+type issuer struct {
+	cfg      config.Issuer
+	keys     *jwks
+	verifier *oidc.IDTokenVerifier
 }
 
-func (a *OIDCAuthenticator) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
-	a.verifierMu.RLock()
-	if a.verifier != nil && time.Since(a.lastVerified) < a.cacheTTL {
-		a.verifierMu.RUnlock()
-		return a.verifier, nil
+// NewOIDCAuthenticator creates a new OIDC authenticator for the issuers of
+// cfg. Signing keys are loaded when first needed; Start keeps them fresh.
+func NewOIDCAuthenticator(logger *logrus.Logger, cfg config.Auth) *OIDCAuthenticator {
+	a := &OIDCAuthenticator{
+		logger:   logger,
+		refresh:  cmp.Or(cfg.CacheTTL, defaultJWKSRefresh),
+		issuers:  make(map[string]*issuer),
+		stopChan: make(chan struct{}),
 	}
-	a.verifierMu.RUnlock()
-
-	a.verifierMu.Lock()
-	defer a.verifierMu.Unlock()
-
-	// Double check if another goroutine has already refreshed the verifier
-	if a.verifier != nil && time.Since(a.lastVerified) < a.cacheTTL {
-		return a.verifier, nil
+	algs := make([]string, len(signingAlgs))
+	for i, alg := range signingAlgs {
+		algs[i] = string(alg)
 	}
+	for _, c := range cfg.OIDCIssuers() {
+		c.GroupsClaim = cmp.Or(c.GroupsClaim, "groups")
+		c.SubjectClaim = cmp.Or(c.SubjectClaim, "sub")
+		keys := newJWKS(logger, c.Issuer, c.JWKSURL, c.JWKSFile)
+		a.issuers[c.Issuer] = &issuer{
+			cfg:  c,
+			keys: keys,
+			// Audiences are checked by Authentication, since tokens may
+			// carry any of several.
+			verifier: oidc.NewVerifier(c.Issuer, keys, &oidc.Config{SkipClientIDCheck: true, SupportedSigningAlgs: algs}),
+		}
+	}
+	if cfg.Introspection.Enabled {
+		a.introspector = newIntrospector(cfg.Introspection)
+	}
+	return a
+}
 
-	provider, err := oidc.NewProvider(ctx, a.issuerURL)
-	if err != nil {
-		return nil, err
+// SetAPIKeys makes the authenticator accept the API keys of keys alongside
+// OIDC tokens.
+func (a *OIDCAuthenticator) SetAPIKeys(keys *apikeys.Service) {
+	a.keys = keys
+}
+
+// Start loads the signing keys of every issuer and refreshes them in the
+// background.
+func (a *OIDCAuthenticator) Start() {
+	for _, iss := range a.issuers {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			iss.keys.run(a.refresh, a.stopChan)
+		}()
 	}
-	verifier := provider.Verifier(&oidc.Config{ClientID: a.clientID})
-	a.verifier = verifier
-	a.lastVerified = time.Now()
+}
 
-	return a.verifier, nil
+// Stop halts the background refreshes and waits for them to finish.
+func (a *OIDCAuthenticator) Stop() {
+	close(a.stopChan)
+	a.wg.Wait()
 }
 
 // Authentication is the middleware handler for OIDC authentication.
@@ -66,64 +104,198 @@ func (m *Manager) Authentication(auth *OIDCAuthenticator) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
+			// Anthropic SDKs send their credential in x-api-key, so the
+			// Anthropic-compatible endpoint accepts it there as well.
+			apiKeyHeader := r.Header.Get("x-api-key")
+			if authHeader == "" && (r.URL.Path != "/v1/messages" || apiKeyHeader == "") {
 				http.Error(w, "Authorization header is required", http.StatusUnauthorized)
 				return
 			}
 
-			tokenParts := strings.Split(authHeader, " ")
-			if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
-				http.Error(w, "Authorization header must be in the format 'Bearer {token}'", http.StatusUnauthorized)
+			rawToken := apiKeyHeader
+			if authHeader != "" {
+				tokenParts := strings.Split(authHeader, " ")
+				if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
+					http.Error(w, "Authorization header must be in the format 'Bearer {token}'", http.StatusUnauthorized)
+					return
+				}
+				rawToken = tokenParts[1]
+			}
+
+			if auth.keys != nil && strings.HasPrefix(rawToken, apikeys.Prefix) {
+				auth.serveAPIKey(w, r, next, rawToken)
 				return
 			}
-			rawToken := tokenParts[1]
 
-			verifier, err := auth.getVerifier(r.Context())
+			// The token signature is verified below, by the verifier of the
+			// issuer the token claims to come from. We manually decode the
+			// payload to robustly extract claims, as the go-oidc library's
+			// Claims() method can be unreliable for custom claims in access
+			// tokens.
+			payload, err := decodeJWTPayload(rawToken)
+			var claims map[string]any
+			if err == nil {
+				err = json.Unmarshal(payload, &claims)
+			}
 			if err != nil {
-				auth.logger.Errorf("failed to initialize oidc verifier: %v", err)
+				// Tokens that are not JWTs are opaque.
+				if auth.introspector != nil {
+					auth.serveIntrospected(w, r, next, rawToken)
+					return
+				}
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			issuerURL, _ := claims["iss"].(string)
+			iss, ok := auth.issuers[issuerURL]
+			if !ok {
+				auth.logger.Errorf("rejected token of unknown issuer %q", issuerURL)
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			// Signing keys are only missing if they could never be loaded.
+			if !iss.keys.ready(r.Context()) {
 				http.Error(w, "OIDC provider is unavailable", http.StatusServiceUnavailable)
 				return
 			}
 
-			idToken, err := verifier.Verify(r.Context(), rawToken)
+			idToken, err := iss.verifier.Verify(r.Context(), rawToken)
 			if err != nil {
 				auth.logger.Errorf("failed to verify token: %v", err)
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
-
-			// The token signature is now verified. We will manually decode the payload
-			// to robustly extract claims, as the go-oidc library's Claims() method
-			// can be unreliable for custom claims in access tokens.
-			payload, err := decodeJWTPayload(rawToken)
-			if err != nil {
-				auth.logger.Errorf("failed to decode token payload: %v", err)
-				http.Error(w, "Failed to parse token claims", http.StatusUnauthorized)
+			if !slices.ContainsFunc(idToken.Audience, func(aud string) bool { return slices.Contains(iss.cfg.Audiences, aud) }) {
+				auth.logger.Errorf("rejected token of %s for audience %v", issuerURL, idToken.Audience)
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			var claims struct {
-				Groups []string `json:"groups"`
-			}
-			if err := json.Unmarshal(payload, &claims); err != nil {
-				auth.logger.Errorf("failed to unmarshal custom claims: %v", err)
+			subject, groups, err := userClaims(claims, iss.cfg)
+			if err != nil {
+				auth.logger.Errorf("failed to map token claims: %v", err)
 				http.Error(w, "Failed to parse token claims", http.StatusUnauthorized)
 				return
 			}
 
 			// Store the user's groups and ID in the request context for downstream middleware.
-			ctxWithGroups := context.WithValue(r.Context(), "user_groups", claims.Groups)
-			ctxWithUserID := context.WithValue(ctxWithGroups, "user_id", idToken.Subject)
+			ctxWithGroups := context.WithValue(r.Context(), "user_groups", groups)
+			ctxWithUserID := context.WithValue(ctxWithGroups, "user_id", subject)
 			r = r.WithContext(ctxWithUserID)
 
-			// Token is valid, you can access claims from idToken if needed
-			auth.logger.Infof("successfully authenticated user: %s", idToken.Subject)
+			auth.logger.Infof("successfully authenticated user: %s", subject)
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// userClaims maps the claims of a token to the user's subject and groups, as
+// configured for its issuer.
+func userClaims(claims map[string]any, cfg config.Issuer) (string, []string, error) {
+	subject, _ := claims[cfg.SubjectClaim].(string)
+	if subject == "" {
+		return "", nil, fmt.Errorf("missing subject claim %q", cfg.SubjectClaim)
+	}
+
+	// Walk the dotted path down nested objects; a missing claim means no
+	// groups.
+	var value any = claims
+	for _, key := range strings.Split(cfg.GroupsClaim, ".") {
+		object, _ := value.(map[string]any)
+		value = object[key]
+	}
+	var groups []string
+	switch value := value.(type) {
+	case nil:
+	case string:
+		groups = []string{value}
+	case []any:
+		for _, group := range value {
+			name, ok := group.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("groups claim %q holds a non-string value", cfg.GroupsClaim)
+			}
+			groups = append(groups, name)
+		}
+	default:
+		return "", nil, fmt.Errorf("groups claim %q is not a list", cfg.GroupsClaim)
+	}
+	if cfg.GroupPrefix != "" {
+		for i := range groups {
+			groups[i] = cfg.GroupPrefix + groups[i]
+		}
+	}
+	return subject, groups, nil
+}
+
+// serveAPIKey authenticates a request with a gateway API key, storing the
+// key's subject and groups like those of a token, along with its model
+// restrictions and rate limit.
+func (a *OIDCAuthenticator) serveAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, secret string) {
+	key, err := a.keys.Authenticate(r.Context(), secret)
+	switch {
+	case errors.Is(err, apikeys.ErrInvalidKey):
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	case errors.Is(err, apikeys.ErrExpired):
+		http.Error(w, "API key has expired", http.StatusUnauthorized)
+		return
+	case err != nil:
+		a.logger.Errorf("failed to look up api key: %v", err)
+		http.Error(w, "API key store is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The store may share the key's groups between requests, and later
+	// middleware sorts them in place.
+	groups := slices.Clone(key.Groups)
+	if groups == nil {
+		groups = []string{}
+	}
+	ctx := context.WithValue(r.Context(), "user_groups", groups)
+	ctx = context.WithValue(ctx, "user_id", key.Subject)
+	if len(key.Models) > 0 {
+		ctx = context.WithValue(ctx, "allowed_models", key.Models)
+	}
+	if key.RateLimit != nil {
+		limit := *key.RateLimit
+		limit.Name = "key:" + key.ID
+		ctx = context.WithValue(ctx, "rate_limit", limit)
+	}
+
+	a.logger.Infof("successfully authenticated api key %s of %s", key.ID, key.Subject)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// serveIntrospected authenticates a request with an opaque token, mapping
+// the claims returned by the introspection endpoint like those of a JWT.
+func (a *OIDCAuthenticator) serveIntrospected(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	claims, err := a.introspector.introspect(r.Context(), token)
+	if err != nil {
+		a.logger.Errorf("failed to introspect token: %v", err)
+		http.Error(w, "Token introspection is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if claims == nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	subject, groups, err := userClaims(claims, a.introspector.mapping)
+	if err != nil {
+		a.logger.Errorf("failed to map introspected claims: %v", err)
+		http.Error(w, "Failed to parse token claims", http.StatusUnauthorized)
+		return
+	}
+	ctx := context.WithValue(r.Context(), "user_groups", groups)
+	ctx = context.WithValue(ctx, "user_id", subject)
+
+	a.logger.Infof("successfully authenticated user with an opaque token: %s", subject)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // decodeJWTPayload decodes the payload part of a JWT string.
 func decodeJWTPayload(token string) ([]byte, error) {
 	parts := strings.Split(token, ".")
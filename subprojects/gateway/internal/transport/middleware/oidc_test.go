@@ -0,0 +1,347 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"llm-gateway/internal/apikeys"
+	"llm-gateway/internal/config"
+	"llm-gateway/internal/core"
+	"llm-gateway/internal/ratelimit"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthenticationAcceptsAPIKeys(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	ctx := context.Background()
+
+	keys := apikeys.NewService(apikeys.NewMemoryStore())
+	secret, _, _ := keys.Create(ctx, apikeys.Key{
+		Subject:   "ci-bot",
+		Groups:    []string{"ci"},
+		Models:    []string{"openai/*"},
+		RateLimit: &config.RateLimitConfig{Requests: 2, Window: time.Minute},
+	})
+	expired, key, _ := keys.Create(ctx, apikeys.Key{Subject: "old-bot"})
+	past := time.Now().Add(-time.Hour)
+	key.ExpiresAt = &past
+	keys.Store().Put(ctx, key)
+
+	// API keys work without an OIDC issuer.
+	auth := NewOIDCAuthenticator(logger, config.Auth{CacheTTL: time.Minute})
+	auth.SetAPIKeys(keys)
+	cache := core.NewModelsCache()
+	cache.SetModels("openai", []core.Model{{ID: "openai/gpt-4"}})
+	cache.SetModels("anthropic", []core.Model{{ID: "anthropic/claude-3"}})
+	authz := NewAuthorizer(logger, nil, nil, cache)
+
+	var user string
+	var groups []string
+	m := NewManager(logger)
+	handler := Chain(
+		m.Authentication(auth),
+		m.Authorization(authz),
+		// The default limit would reject every request.
+		m.RateLimiter(ratelimit.NewMemoryStore(), ratelimit.NewLimits(config.RateLimit{Default: config.RateLimitConfig{Requests: 0, Window: time.Minute}})),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = r.Context().Value("user_id").(string)
+		groups, _ = r.Context().Value("user_groups").([]string)
+	}))
+
+	tests := []struct {
+		token string
+		model string
+		want  int
+	}{
+		{secret, "openai/gpt-4", http.StatusOK},
+		{secret, "anthropic/claude-3", http.StatusForbidden},
+		{expired, "openai/gpt-4", http.StatusUnauthorized},
+		{"sk-gw-unknown", "openai/gpt-4", http.StatusUnauthorized},
+		{"eyJhbGciOiJSUzI1NiJ9.e30.sig", "openai/gpt-4", http.StatusUnauthorized},
+		{secret, "openai/gpt-4", http.StatusOK},
+		// The key's own limit of 2 requests applies.
+		{secret, "openai/gpt-4", http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+tt.model+`"}`))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("request %d for %s: got status %d, want %d: %s", i, tt.model, rr.Code, tt.want, rr.Body)
+		}
+	}
+	if user != "ci-bot" || len(groups) != 1 || groups[0] != "ci" {
+		t.Errorf("unexpected user %q with groups %v", user, groups)
+	}
+}
+
+// testIssuer is an OIDC provider serving discovery and a JWKS, and signing
+// tokens with its key.
+type testIssuer struct {
+	*httptest.Server
+	// down makes every request fail.
+	down atomic.Bool
+	// fetches counts the requests for the JWKS.
+	fetches atomic.Int32
+
+	mu  sync.Mutex
+	key *rsa.PrivateKey
+	kid string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{}
+	iss.rotate(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                iss.URL,
+			"jwks_uri":                              iss.URL + "/certs",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		json.NewEncoder(w).Encode(iss.jwks())
+	})
+	iss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if iss.down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// rotate replaces the signing key with a new one.
+func (iss *testIssuer) rotate(t *testing.T) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.key = key
+	iss.kid = fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+func (iss *testIssuer) jwks() jose.JSONWebKeySet {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &iss.key.PublicKey, KeyID: iss.kid, Algorithm: "RS256", Use: "sig"},
+	}}
+}
+
+// token signs claims, adding the issuer and an expiry.
+func (iss *testIssuer) token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	claims = maps.Clone(claims)
+	claims["iss"] = iss.URL
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	payload, _ := json.Marshal(claims)
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: iss.key}, (&jose.SignerOptions{}).WithHeader("kid", iss.kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := signed.CompactSerialize()
+	return token
+}
+
+func TestAuthenticationAcceptsAnthropicAPIKeyHeader(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	keys := apikeys.NewService(apikeys.NewMemoryStore())
+	secret, _, _ := keys.Create(context.Background(), apikeys.Key{Subject: "sdk-user", Groups: []string{"users"}})
+	auth := NewOIDCAuthenticator(logger, config.Auth{CacheTTL: time.Minute})
+	auth.SetAPIKeys(keys)
+
+	var user string
+	handler := NewManager(logger).Authentication(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = r.Context().Value("user_id").(string)
+	}))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/v1/messages", http.StatusOK},
+		// Other endpoints still require the Authorization header.
+		{"/v1/chat/completions", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		user = ""
+		// Shaped like a request of the Anthropic SDK.
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"model": "anthropic/claude-3", "max_tokens": 1024, "messages": [{"role": "user", "content": "Hello"}]}`))
+		req.Header.Set("x-api-key", secret)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("content-type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body)
+		}
+		if tt.want == http.StatusOK && user != "sdk-user" {
+			t.Errorf("%s: authenticated as %q, want sdk-user", tt.path, user)
+		}
+	}
+}
+
+func TestAuthenticationWithOneAPIKeyInParallel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	ctx := context.Background()
+
+	keys := apikeys.NewService(apikeys.NewMemoryStore())
+	secret, key, _ := keys.Create(ctx, apikeys.Key{Subject: "ci-bot", Groups: []string{"ci", "builds"}})
+	auth := NewOIDCAuthenticator(logger, config.Auth{CacheTTL: time.Minute})
+	auth.SetAPIKeys(keys)
+
+	m := NewManager(logger)
+	handler := Chain(
+		m.Authentication(auth),
+		m.RateLimiter(ratelimit.NewMemoryStore(), ratelimit.NewLimits(config.RateLimit{Default: config.RateLimitConfig{Requests: 1000, Window: time.Minute}})),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			req.Header.Set("Authorization", "Bearer "+secret)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Sorting the groups of a request must not reorder those of the key.
+	stored, _ := keys.Store().Get(ctx, key.ID)
+	if !slices.Equal(stored.Groups, []string{"ci", "builds"}) {
+		t.Errorf("expected the stored groups to be unchanged, got %v", stored.Groups)
+	}
+}
+
+func TestAuthenticationSelectsIssuer(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	staff, partners, unknown := newTestIssuer(t), newTestIssuer(t), newTestIssuer(t)
+	auth := NewOIDCAuthenticator(logger, config.Auth{
+		Issuer:   staff.URL,
+		Audience: "account",
+		Issuers: []config.Issuer{{
+			Issuer:       partners.URL,
+			Audiences:    []string{"gateway", "partner-api"},
+			GroupsClaim:  "resource_access.gateway.roles",
+			SubjectClaim: "client_id",
+			GroupPrefix:  "partner:",
+		}},
+		CacheTTL: time.Minute,
+	})
+
+	var user string
+	var groups []string
+	handler := NewManager(logger).Authentication(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = r.Context().Value("user_id").(string)
+		groups, _ = r.Context().Value("user_groups").([]string)
+	}))
+
+	tests := []struct {
+		name       string
+		token      string
+		want       int
+		wantUser   string
+		wantGroups []string
+	}{
+		{
+			name:       "staff",
+			token:      staff.token(t, map[string]any{"sub": "alice", "aud": "account", "groups": []string{"users"}}),
+			want:       http.StatusOK,
+			wantUser:   "alice",
+			wantGroups: []string{"users"},
+		},
+		{
+			name: "partner",
+			token: partners.token(t, map[string]any{"sub": "f81d4fae", "client_id": "acme-sync", "aud": []string{"partner-api", "account"},
+				"resource_access": map[string]any{"gateway": map[string]any{"roles": []string{"batch", "chat"}}}}),
+			want:       http.StatusOK,
+			wantUser:   "acme-sync",
+			wantGroups: []string{"partner:batch", "partner:chat"},
+		},
+		{
+			name:  "wrong audience",
+			token: partners.token(t, map[string]any{"client_id": "acme-sync", "aud": "account"}),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "missing subject",
+			token: partners.token(t, map[string]any{"sub": "f81d4fae", "aud": "gateway"}),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "unknown issuer",
+			token: unknown.token(t, map[string]any{"sub": "mallory", "aud": "account"}),
+			want:  http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		user, groups = "", nil
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, rr.Code, tt.want, rr.Body)
+			continue
+		}
+		if user != tt.wantUser || !slices.Equal(groups, tt.wantGroups) {
+			t.Errorf("%s: got user %q with groups %v", tt.name, user, groups)
+		}
+	}
+
+	// A token signed by another key is rejected, even with a known issuer.
+	forged := unknown.token(t, map[string]any{"sub": "mallory", "aud": "account"})
+	payload, _ := json.Marshal(map[string]any{"iss": staff.URL, "sub": "mallory", "aud": "account", "exp": time.Now().Add(time.Hour).Unix()})
+	parts := strings.Split(forged, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer "+strings.Join(parts, "."))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("forged token: got status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -10,10 +10,19 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// RateLimiter is the middleware handler for rate limiting.
-func (m *Manager) RateLimiter(store ratelimit.RateLimiterStore, cfg config.RateLimit) Middleware {
+// RateLimiter is the middleware handler for rate limiting. Limits are read on
+// every request, so that changes to them apply right away.
+func (m *Manager) RateLimiter(store ratelimit.RateLimiterStore, limits *ratelimit.Limits) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := limits.Get()
+
+			// API keys may carry their own limit, replacing the group limits.
+			if limit, ok := r.Context().Value("rate_limit").(config.RateLimitConfig); ok {
+				handleRateLimit(w, r, next, store, "ratelimit:"+limit.Name, limit, m.Logger)
+				return
+			}
+
 			// 1. Extract user groups from request context (set by OIDC middleware).
 			groups, ok := r.Context().Value("user_groups").([]string)
 			if !ok {
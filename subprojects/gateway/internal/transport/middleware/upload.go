@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"llm-gateway/internal/core/upload"
+)
+
+// LimitUploads caps multipart request bodies at maxSize bytes. Reading past
+// the limit fails, and the request is rejected with 413.
+func (m *Manager) LimitUploads(maxSize int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upload.Limit(w, r, maxSize)
+			next.ServeHTTP(w, r)
+		})
+	}
+}